@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// errInvalidPath is returned for document paths outside of the documents root
+var errInvalidPath = errors.New("invalid document path")
+
+// DocumentStatus is an ingested document along with the pending or failed change
+// of its file, if any
+type DocumentStatus struct {
+	File      string `json:"file"`
+	Crc       uint32 `json:"crc"`
+	Profile   string `json:"profile,omitempty"`
+	Version   string `json:"version,omitempty"`
+	Status    string `json:"status"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// Documents lists the ingested documents. Documents of files with a queued change
+// are reported as pending, or failed once the change is dead-lettered.
+func (dr *DocRegistry) Documents(ctx context.Context) ([]DocumentStatus, error) {
+	docs, err := dr.storer.GetIngested(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pending, dead, err := dr.queuedJobs()
+	if err != nil {
+		return nil, err
+	}
+
+	status := make(map[string]DocumentStatus)
+	for _, j := range pending {
+		status[dr.relPath(j.Path)] = DocumentStatus{Status: "pending", LastError: j.LastError}
+	}
+	for _, j := range dead {
+		status[dr.relPath(j.Path)] = DocumentStatus{Status: "failed", LastError: j.LastError}
+	}
+
+	res := make([]DocumentStatus, 0, len(docs))
+	for _, d := range docs {
+		s := DocumentStatus{
+			File:    d.File,
+			Crc:     d.Crc,
+			Profile: d.Profile,
+			Version: d.Version,
+			Status:  "indexed",
+		}
+
+		file, _, _ := strings.Cut(d.File, archiveSep)
+		if js, ok := status[file]; ok {
+			s.Status = js.Status
+			s.LastError = js.LastError
+		}
+
+		res = append(res, s)
+	}
+
+	return res, nil
+}
+
+// queuedJobs returns the pending and the dead jobs of the queue. Commands not
+// running the queue read them from its file, which the server owns.
+func (dr *DocRegistry) queuedJobs() (pending, dead []queueJob, err error) {
+	if dr.queue != nil {
+		pending, dead = dr.queue.Jobs()
+		return pending, dead, nil
+	}
+	if dr.queueFile == "" {
+		return nil, nil, nil
+	}
+
+	state, err := readQueueState(dr.queueFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, j := range state.Pending {
+		pending = append(pending, *j)
+	}
+	for _, j := range state.Dead {
+		dead = append(dead, *j)
+	}
+
+	return pending, dead, nil
+}
+
+// SyncPath re-ingests a file or archive given relative to the documents root, through
+// the queue if any
+func (dr *DocRegistry) SyncPath(ctx context.Context, rel string) error {
+	path, err := dr.absPath(rel)
+	if err != nil {
+		return err
+	}
+
+	op := jobReplace
+	if dr.traverseArchive(path) {
+		op = jobArchive
+	}
+
+	if dr.queue != nil {
+		return dr.queue.Push(path, op)
+	}
+
+	return dr.applyChange(ctx, path, op)
+}
+
+// ForgetPath removes the documents of a file given relative to the documents root
+// from the store, whether the file still exists or not
+func (dr *DocRegistry) ForgetPath(ctx context.Context, rel string) error {
+	path, err := dr.absPath(rel)
+	if err != nil {
+		return err
+	}
+
+	dr.syncMu.Lock()
+	defer dr.syncMu.Unlock()
+
+	return dr.forgetFile(ctx, path)
+}
+
+// absPath resolves a path relative to the documents root, rejecting paths outside of it
+func (dr *DocRegistry) absPath(rel string) (string, error) {
+	if !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("%w %q", errInvalidPath, rel)
+	}
+
+	return filepath.Join(dr.root, rel), nil
+}
+
+func (dr *DocRegistry) relPath(path string) string {
+	rel, err := filepath.Rel(dr.root, path)
+	if err != nil {
+		return path
+	}
+
+	return rel
+}
+
+type adminRegistry interface {
+	Documents(ctx context.Context) ([]DocumentStatus, error)
+	StartSync(ctx context.Context, done func(error)) bool
+	SyncPath(ctx context.Context, rel string) error
+	ForgetPath(ctx context.Context, rel string) error
+	Status() IndexStatus
+}
+
+// adminServer serves the admin API managing the index. All requests must carry the
+// configured token as a bearer token.
+type adminServer struct {
+	registry  adminRegistry
+	retriever docRetriever
+	queue     queueAdmin
+	log       *slog.Logger
+	token     string
+	// ctx bounds the full syncs started by the API
+	ctx context.Context
+}
+
+func (s *adminServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /documents", s.handleDocuments)
+	mux.HandleFunc("DELETE /documents/{path...}", s.handleForget)
+	mux.HandleFunc("POST /sync", s.handleSync)
+	mux.HandleFunc("POST /sync/{path...}", s.handleSyncPath)
+	mux.HandleFunc("GET /failures", s.handleFailures)
+	mux.HandleFunc("POST /failures/retry", s.handleRetry)
+	mux.HandleFunc("GET /search", s.handleSearch)
+	mux.HandleFunc("GET /status", s.handleStatus)
+
+	return s.authenticate(mux)
+}
+
+func (s *adminServer) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *adminServer) handleDocuments(w http.ResponseWriter, r *http.Request) {
+	docs, err := s.registry.Documents(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, docs)
+}
+
+func (s *adminServer) handleForget(w http.ResponseWriter, r *http.Request) {
+	path := r.PathValue("path")
+	s.log.Info("admin forget", "file", path)
+
+	if err := s.registry.ForgetPath(r.Context(), path); err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleSync starts a full resync in the background, unless a sync, a rebuild or a
+// file change is writing the index
+func (s *adminServer) handleSync(w http.ResponseWriter, r *http.Request) {
+	started := s.registry.StartSync(s.ctx, func(err error) {
+		if err != nil {
+			s.log.Error("admin resync failed", "error", err)
+		}
+	})
+	if !started {
+		writeError(w, http.StatusConflict, errors.New("the index is being updated, retry later"))
+		return
+	}
+
+	s.log.Info("admin resync")
+	writeJSON(w, http.StatusAccepted, s.registry.Status())
+}
+
+func (s *adminServer) handleSyncPath(w http.ResponseWriter, r *http.Request) {
+	path := r.PathValue("path")
+	s.log.Info("admin resync", "file", path)
+
+	if err := s.registry.SyncPath(r.Context(), path); err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *adminServer) handleFailures(w http.ResponseWriter, r *http.Request) {
+	dead := []queueJob{}
+	if s.queue != nil {
+		_, failed := s.queue.Jobs()
+		dead = append(dead, failed...)
+	}
+
+	writeJSON(w, http.StatusOK, dead)
+}
+
+func (s *adminServer) handleRetry(w http.ResponseWriter, r *http.Request) {
+	if s.queue == nil {
+		writeError(w, http.StatusNotFound, errors.New("the ingestion queue is disabled"))
+		return
+	}
+
+	n, err := s.queue.Retry(r.URL.Query().Get("file"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]int{"retried": n})
+}
+
+func (s *adminServer) handleSearch(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query().Get("q")
+	if q == "" {
+		writeError(w, http.StatusBadRequest, errors.New("missing query parameter q"))
+		return
+	}
+
+	res, err := s.retriever.Retrieve(r.Context(), q)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	hits := make([]searchHit, 0, len(res))
+	for _, r := range res {
+		hits = append(hits, newSearchHit(r))
+	}
+
+	writeJSON(w, http.StatusOK, hits)
+}
+
+func (s *adminServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.registry.Status())
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func errorStatus(err error) int {
+	if errors.Is(err, errInvalidPath) {
+		return http.StatusBadRequest
+	}
+
+	return http.StatusInternalServerError
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
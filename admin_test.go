@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gamma-omg/rag-mcp/docstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeRetriever struct {
+	queries []string
+}
+
+func (r *fakeRetriever) Retrieve(ctx context.Context, query string) ([]docstore.SearchResult, error) {
+	r.queries = append(r.queries, query)
+	return []docstore.SearchResult{{File: "f1.txt", Text: "hello", Score: 0.5}}, nil
+}
+
+func newTestAdmin(t *testing.T) (*adminServer, *DocRegistry, *fakeDocStore) {
+	tmp := t.TempDir()
+	store := &fakeDocStore{ingested: []docstore.IngestedDoc{
+		{File: "f1.txt", Crc: 1, Version: "1"},
+		{File: "f2.txt", Crc: 2, Version: "1"},
+	}}
+	reg := &DocRegistry{
+		log:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		root:   tmp,
+		storer: store,
+		queue:  newTestQueue(t, filepath.Join(tmp, "queue.json")),
+	}
+
+	admin := &adminServer{
+		registry:  reg,
+		retriever: &fakeRetriever{},
+		queue:     reg.queue,
+		log:       reg.log,
+		token:     "secret",
+		ctx:       context.Background(),
+	}
+	return admin, reg, store
+}
+
+func adminRequest(t *testing.T, admin *adminServer, method, target, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	rec := httptest.NewRecorder()
+	admin.Handler().ServeHTTP(rec, req)
+	return rec
+}
+
+func Test_adminServer_Unauthorized(t *testing.T) {
+	admin, _, _ := newTestAdmin(t)
+
+	assert.Equal(t, http.StatusUnauthorized, adminRequest(t, admin, "GET", "/documents", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, adminRequest(t, admin, "GET", "/documents", "wrong").Code)
+	assert.Equal(t, http.StatusOK, adminRequest(t, admin, "GET", "/documents", "secret").Code)
+}
+
+func Test_adminServer_Documents(t *testing.T) {
+	admin, reg, _ := newTestAdmin(t)
+	require.NoError(t, reg.queue.Push(filepath.Join(reg.root, "f2.txt"), jobReplace))
+
+	rec := adminRequest(t, admin, "GET", "/documents", "secret")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var docs []DocumentStatus
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &docs))
+	require.Len(t, docs, 2)
+	assert.Equal(t, "indexed", docs[0].Status)
+	assert.Equal(t, "f2.txt", docs[1].File)
+	assert.Equal(t, "pending", docs[1].Status)
+}
+
+func Test_Documents_QueueFile(t *testing.T) {
+	admin, reg, _ := newTestAdmin(t)
+	require.NoError(t, reg.queue.Push(filepath.Join(reg.root, "f2.txt"), jobReplace))
+	reg.queueFile = filepath.Join(reg.root, "queue.json")
+	reg.queue = nil
+
+	docs, err := admin.registry.Documents(context.Background())
+	require.NoError(t, err)
+	require.Len(t, docs, 2)
+	assert.Equal(t, "indexed", docs[0].Status)
+	assert.Equal(t, "pending", docs[1].Status)
+}
+
+func Test_adminServer_Forget(t *testing.T) {
+	admin, _, store := newTestAdmin(t)
+
+	rec := adminRequest(t, admin, "DELETE", "/documents/f1.txt", "secret")
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, []string{"f1.txt"}, store.getForgetCalls())
+
+	rec = adminRequest(t, admin, "DELETE", "/documents/..%2Fetc%2Fpasswd", "secret")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Len(t, store.foregetCalls, 1)
+}
+
+func Test_adminServer_SyncPath(t *testing.T) {
+	admin, reg, _ := newTestAdmin(t)
+
+	rec := adminRequest(t, admin, "POST", "/sync/sub/f3.txt", "secret")
+	require.Equal(t, http.StatusAccepted, rec.Code)
+
+	pending, _ := reg.queue.Jobs()
+	require.Len(t, pending, 1)
+	assert.Equal(t, filepath.Join(reg.root, "sub", "f3.txt"), pending[0].Path)
+	assert.Equal(t, jobReplace, pending[0].Op)
+}
+
+func Test_adminServer_SyncWhileUpdating(t *testing.T) {
+	admin, reg, _ := newTestAdmin(t)
+
+	reg.syncMu.Lock()
+	assert.Equal(t, http.StatusConflict, adminRequest(t, admin, "POST", "/sync", "secret").Code)
+	reg.syncMu.Unlock()
+
+	done := make(chan error, 1)
+	require.True(t, reg.StartSync(context.Background(), func(err error) { done <- err }))
+	assert.NoError(t, <-done)
+}
+
+func Test_adminServer_Search(t *testing.T) {
+	admin, _, _ := newTestAdmin(t)
+
+	rec := adminRequest(t, admin, "GET", "/search?q=hello+world", "secret")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `[{"score":0.5,"file":"f1.txt","text":"hello"}]`, rec.Body.String())
+	assert.Equal(t, []string{"hello world"}, admin.retriever.(*fakeRetriever).queries)
+
+	assert.Equal(t, http.StatusBadRequest, adminRequest(t, admin, "GET", "/search", "secret").Code)
+}
+
+func Test_adminServer_Failures(t *testing.T) {
+	admin, _, _ := newTestAdmin(t)
+	admin.queue = nil
+
+	rec := adminRequest(t, admin, "GET", "/failures", "secret")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `[]`, rec.Body.String())
+	assert.Equal(t, http.StatusNotFound, adminRequest(t, admin, "POST", "/failures/retry", "secret").Code)
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/gamma-omg/rag-mcp/readers"
+)
+
+// archiveSep separates an archive path from the path of a member inside it,
+// e.g. bundle.zip!/spec/intro.pdf
+const archiveSep = "!/"
+
+var errArchiveTooLarge = errors.New("archive exceeds extraction size limit")
+
+func isArchive(file string) bool {
+	name := strings.ToLower(file)
+	return strings.HasSuffix(name, ".zip") ||
+		strings.HasSuffix(name, ".tar") ||
+		strings.HasSuffix(name, ".tar.gz") ||
+		strings.HasSuffix(name, ".tgz")
+}
+
+func archiveExt(file string) string {
+	name := strings.ToLower(file)
+	if strings.HasSuffix(name, ".tar.gz") {
+		return ".tar.gz"
+	}
+
+	return filepath.Ext(name)
+}
+
+// walkArchive calls fn for every regular file stored in the archive
+func walkArchive(file string, fn func(name string, r io.Reader) error) error {
+	if archiveExt(file) == ".zip" {
+		return walkZip(file, fn)
+	}
+
+	return walkTar(file, fn)
+}
+
+func walkZip(file string, fn func(name string, r io.Reader) error) error {
+	zr, err := zip.OpenReader(file)
+	if err != nil {
+		return fmt.Errorf("open zip archive: %w", err)
+	}
+	defer zr.Close()
+
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+
+		name, ok := cleanMemberName(f.Name)
+		if !ok {
+			continue
+		}
+
+		var r io.Reader
+		rc, err := f.Open()
+		if err != nil {
+			// reported when the member is read, so that the other members are not lost
+			r = failedReader{fmt.Errorf("open zip member %s: %w", f.Name, err)}
+		} else {
+			r = rc
+		}
+
+		err = fn(name, r)
+		if rc != nil {
+			rc.Close()
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func walkTar(file string, fn func(name string, r io.Reader) error) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("open tar archive: %w", err)
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if ext := archiveExt(file); ext == ".tar.gz" || ext == ".tgz" {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("open gzip stream: %w", err)
+		}
+		defer gz.Close()
+
+		r = gz
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read tar header: %w", err)
+		}
+
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name, ok := cleanMemberName(hdr.Name)
+		if !ok {
+			continue
+		}
+
+		err = fn(name, tr)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// failedReader fails every read with the error of opening an archive member
+type failedReader struct {
+	err error
+}
+
+func (r failedReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+// cleanMemberName normalizes a member name and rejects names escaping the archive root
+func cleanMemberName(name string) (string, bool) {
+	name = path.Clean(strings.ReplaceAll(name, "\\", "/"))
+	if path.IsAbs(name) || name == "." || name == ".." || strings.HasPrefix(name, "../") {
+		return "", false
+	}
+
+	return name, true
+}
+
+// extractMember copies r into a temporary file with the same extension as name,
+// so that extension based readers can handle it. budget holds the number of bytes
+// that may still be extracted; a negative budget means no limit.
+func extractMember(name string, r io.Reader, budget *int64) (string, error) {
+	tmp, err := os.CreateTemp("", "rag-mcp-*"+archiveExt(name))
+	if err != nil {
+		return "", fmt.Errorf("create temp file: %w", err)
+	}
+	defer tmp.Close()
+
+	if *budget >= 0 {
+		r = io.LimitReader(r, *budget+1)
+	}
+
+	n, err := io.Copy(tmp, r)
+	if err == nil && *budget >= 0 {
+		if n > *budget {
+			err = errArchiveTooLarge
+		} else {
+			*budget -= n
+		}
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("extract %s: %w", name, err)
+	}
+
+	return tmp.Name(), nil
+}
+
+func (dr *DocRegistry) archiveBudget() int64 {
+	if dr.archiveMaxSize <= 0 {
+		return -1
+	}
+
+	return dr.archiveMaxSize
+}
+
+// readArchive reads the documents of the supported members of an archive in a
+// single pass, naming them by their path inside the archive. Nested archives are
+// traversed up to archiveMaxDepth levels. Members that cannot be read are skipped,
+// only exceeding the extraction budget fails the archive as a whole.
+func (dr *DocRegistry) readArchive(file, virtual string, depth int, budget *int64) (docs []readers.Document, err error) {
+	if depth > dr.archiveMaxDepth {
+		dr.log.Warn("archive nesting limit reached", "file", virtual)
+		return nil, nil
+	}
+
+	err = walkArchive(file, func(name string, r io.Reader) error {
+		member := virtual + archiveSep + name
+
+		tmp, e := extractMember(name, r, budget)
+		var members []readers.Document
+		if e == nil {
+			defer os.Remove(tmp)
+			members, e = dr.readFile(tmp, name, member, depth, budget)
+		}
+		if errors.Is(e, errArchiveTooLarge) {
+			return e
+		}
+		if e != nil {
+			dr.log.Warn("unable to read archive member, skipping it", "error", e, "file", member)
+			return nil
+		}
+
+		for _, d := range members {
+			d.Name = memberPath(name, d.Name)
+			docs = append(docs, d)
+		}
+		return nil
+	})
+
+	return
+}
+
+// syncArchive re-synchronizes the members of a single archive with the store
+func (dr *DocRegistry) syncArchive(ctx context.Context, path string) error {
+	rel, err := filepath.Rel(dr.root, path)
+	if err != nil {
+		return fmt.Errorf("syncArchive invalid file path %s: %w", path, err)
+	}
+
+	budget := dr.archiveBudget()
+	members, err := dr.collectFile(path, rel, rel, 0, &budget)
+	if err != nil {
+		return fmt.Errorf("syncArchive failed to collect members of %s: %w", rel, err)
+	}
+
+	disk := make(diskDocs)
+	for _, d := range members {
+		disk[d.File] = d
+	}
+
+	ingested, err := dr.storer.GetIngested(ctx)
+	if err != nil {
+		return fmt.Errorf("syncArchive failed to get ingested files: %w", err)
+	}
+
+	db := make(dbDocs)
+	for _, d := range ingested {
+		if strings.HasPrefix(d.File, rel+archiveSep) {
+			db[d.File] = d
+		}
+	}
+
+	err = dr.ingestNewDocuments(ctx, disk, db)
+	if err != nil {
+		return fmt.Errorf("syncArchive failed to ingest members of %s: %w", rel, err)
+	}
+
+	err = dr.forgetRemovedDocuments(ctx, disk, db)
+	if err != nil {
+		return fmt.Errorf("syncArchive failed to forget members of %s: %w", rel, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gamma-omg/rag-mcp/docstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func makeZip(t *testing.T, files map[string][]byte) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write(content)
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+
+	return buf.Bytes()
+}
+
+func makeTarGz(t *testing.T, files map[string][]byte) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{
+			Name:     name,
+			Mode:     0o644,
+			Size:     int64(len(content)),
+			Typeflag: tar.TypeReg,
+		}))
+		_, err := tw.Write(content)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+
+	return buf.Bytes()
+}
+
+func createBundle(t *testing.T) string {
+	tmp, err := os.MkdirTemp(os.TempDir(), "test_")
+	require.NoError(t, err)
+
+	inner := makeTarGz(t, map[string][]byte{
+		"deep.txt": []byte("deep"),
+	})
+	bundle := makeZip(t, map[string][]byte{
+		"spec/intro.txt":  []byte("intro"),
+		"notes.txt":       []byte("notes"),
+		"inner.tar.gz":    inner,
+		"../escape.txt":   []byte("escape"),
+		"spec/empty_dir/": nil,
+	})
+	require.NoError(t, os.WriteFile(filepath.Join(tmp, "bundle.zip"), bundle, 0o644))
+
+	return tmp
+}
+
+func Test_collectDocs_Archives(t *testing.T) {
+	tmp := createBundle(t)
+
+	reg := DocRegistry{
+		log:             slog.New(slog.NewTextHandler(io.Discard, nil)),
+		root:            tmp,
+		archiveMaxDepth: 2,
+	}
+	reg.RegisterReader(&mockTextReader{})
+
+	docs, err := reg.collectDocs()
+	require.NoError(t, err)
+
+	assert.ElementsMatch(t, []DiskDoc{
+		{File: "bundle.zip!/spec/intro.txt", Crc: crc32.ChecksumIEEE([]byte("intro"))},
+		{File: "bundle.zip!/notes.txt", Crc: crc32.ChecksumIEEE([]byte("notes"))},
+		{File: "bundle.zip!/inner.tar.gz!/deep.txt", Crc: crc32.ChecksumIEEE([]byte("deep"))},
+	}, docs)
+}
+
+func Test_collectDocs_ArchiveDepthLimit(t *testing.T) {
+	tmp := createBundle(t)
+
+	reg := DocRegistry{
+		log:             slog.New(slog.NewTextHandler(io.Discard, nil)),
+		root:            tmp,
+		archiveMaxDepth: 1,
+	}
+	reg.RegisterReader(&mockTextReader{})
+
+	docs, err := reg.collectDocs()
+	require.NoError(t, err)
+
+	var files []string
+	for _, d := range docs {
+		files = append(files, d.File)
+	}
+	assert.ElementsMatch(t, []string{"bundle.zip!/spec/intro.txt", "bundle.zip!/notes.txt"}, files)
+}
+
+func Test_collectDocs_ArchiveSizeLimit(t *testing.T) {
+	tmp := createBundle(t)
+
+	reg := DocRegistry{
+		log:             slog.New(slog.NewTextHandler(io.Discard, nil)),
+		root:            tmp,
+		archiveMaxDepth: 2,
+		archiveMaxSize:  8,
+	}
+	reg.RegisterReader(&mockTextReader{})
+
+	budget := reg.archiveBudget()
+	_, err := reg.readArchive(filepath.Join(tmp, "bundle.zip"), "bundle.zip", 1, &budget)
+	assert.ErrorIs(t, err, errArchiveTooLarge)
+
+	docs, err := reg.collectDocs()
+	require.NoError(t, err)
+	assert.Empty(t, docs)
+}
+
+func Test_readFileDocs_Archive(t *testing.T) {
+	tmp := createBundle(t)
+
+	reg := DocRegistry{
+		log:             slog.New(slog.NewTextHandler(io.Discard, nil)),
+		root:            tmp,
+		archiveMaxDepth: 2,
+	}
+	reg.RegisterReader(&mockTextReader{})
+
+	docs, err := reg.readFileDocs("bundle.zip")
+	require.NoError(t, err)
+
+	texts := make(map[string]string)
+	for _, d := range docs {
+		texts[d.Name] = d.Text
+	}
+	assert.Equal(t, map[string]string{
+		"spec/intro.txt":         "intro",
+		"notes.txt":              "notes",
+		"inner.tar.gz!/deep.txt": "deep",
+	}, texts)
+}
+
+// failingReader fails to read the files named broken.txt
+type failingReader struct {
+	mockTextReader
+}
+
+func (r *failingReader) ReadText(path string) (string, error) {
+	text, err := r.mockTextReader.ReadText(path)
+	if text == "broken" {
+		return "", errors.New("unreadable")
+	}
+
+	return text, err
+}
+
+func Test_collectDocs_UnreadableMember(t *testing.T) {
+	tmp := t.TempDir()
+	bundle := makeZip(t, map[string][]byte{
+		"broken.txt":   []byte("broken"),
+		"notes.txt":    []byte("notes"),
+		"inner.tar.gz": []byte("not a tar"),
+	})
+	require.NoError(t, os.WriteFile(filepath.Join(tmp, "bundle.zip"), bundle, 0o644))
+
+	reg := DocRegistry{
+		log:             slog.New(slog.NewTextHandler(io.Discard, nil)),
+		root:            tmp,
+		archiveMaxDepth: 2,
+	}
+	reg.RegisterReader(&failingReader{})
+
+	docs, err := reg.collectDocs()
+	require.NoError(t, err)
+	assert.Equal(t, []DiskDoc{{File: "bundle.zip!/notes.txt", Crc: crc32.ChecksumIEEE([]byte("notes"))}}, docs)
+}
+
+func Test_syncArchive(t *testing.T) {
+	tmp := createBundle(t)
+
+	store := &fakeDocStore{
+		ingested: []docstore.IngestedDoc{
+			{File: "bundle.zip!/notes.txt", Crc: crc32.ChecksumIEEE([]byte("notes"))},
+			{File: "bundle.zip!/removed.txt", Crc: 1},
+			{File: "bundle.zip!/spec/intro.txt", Crc: 2},
+			{File: "other.txt", Crc: 3},
+		},
+	}
+
+	reg := DocRegistry{
+		log:             slog.New(slog.NewTextHandler(io.Discard, nil)),
+		root:            tmp,
+		storer:          store,
+		chunkifier:      &DefaultChunkfier{chunkSize: 16},
+		archiveMaxDepth: 2,
+	}
+	reg.RegisterReader(&mockTextReader{})
+
+	require.NoError(t, reg.syncArchive(context.Background(), filepath.Join(tmp, "bundle.zip")))
+
+	assert.ElementsMatch(t, []string{"bundle.zip!/spec/intro.txt", "bundle.zip!/inner.tar.gz!/deep.txt"}, store.getIngestCalls())
+	assert.ElementsMatch(t, []string{"bundle.zip!/removed.txt", "bundle.zip!/spec/intro.txt"}, store.getForgetCalls())
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// anonymousClient names the clients of an MCP endpoint without keys in logs
+const anonymousClient = "anonymous"
+
+type clientKey struct{}
+
+// clientName returns the name of the key the MCP client authenticated with
+func clientName(ctx context.Context) string {
+	if name, ok := ctx.Value(clientKey{}).(string); ok {
+		return name
+	}
+
+	return anonymousClient
+}
+
+type apiKey struct {
+	name string
+	hash [sha256.Size]byte
+}
+
+// mcpAuth authenticates MCP clients with named API keys, sent as bearer tokens or
+// in the X-API-Key header. Requests are let through when no keys are configured.
+type mcpAuth struct {
+	log *slog.Logger
+
+	mu   sync.RWMutex
+	keys []apiKey
+}
+
+func newMCPAuth(keys []APIKeyConfig, logger *slog.Logger) *mcpAuth {
+	a := &mcpAuth{log: logger}
+	a.SetKeys(keys)
+	return a
+}
+
+// SetKeys replaces the accepted keys, requests of clients already connected are
+// checked against the new ones
+func (a *mcpAuth) SetKeys(keys []APIKeyConfig) {
+	hashed := make([]apiKey, 0, len(keys))
+	for _, k := range keys {
+		hashed = append(hashed, apiKey{name: k.Name, hash: sha256.Sum256([]byte(k.Key))})
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.keys = hashed
+}
+
+// Enabled reports whether clients must authenticate
+func (a *mcpAuth) Enabled() bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return len(a.keys) > 0
+}
+
+// lookup returns the name of the key matching token. Keys are compared by hash, so
+// that comparisons take the same time whatever the length of the token, and all
+// keys are compared, so that the time does not tell which one matched.
+func (a *mcpAuth) lookup(token string) (string, bool) {
+	hash := sha256.Sum256([]byte(token))
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	name, found := "", false
+	for _, k := range a.keys {
+		if subtle.ConstantTimeCompare(hash[:], k.hash[:]) == 1 {
+			name, found = k.name, true
+		}
+	}
+
+	return name, found
+}
+
+// Handler rejects the requests without a valid key and records the name of the key
+// in the context of the others
+func (a *mcpAuth) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.Enabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			token = r.Header.Get("X-API-Key")
+		}
+
+		name, found := a.lookup(token)
+		if token == "" || !found {
+			a.log.WarnContext(r.Context(), "rejected unauthenticated MCP request", "remote", r.RemoteAddr, "path", r.URL.Path)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+			return
+		}
+
+		if r.Method == http.MethodGet {
+			a.log.InfoContext(r.Context(), "MCP client connected", "client", name, "remote", r.RemoteAddr)
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientKey{}, name)))
+	})
+}
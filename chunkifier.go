@@ -1,5 +1,14 @@
 package main
 
+import (
+	"strings"
+
+	"github.com/gamma-omg/rag-mcp/docstore"
+	"github.com/gamma-omg/rag-mcp/readers"
+)
+
+const sectionSeparator = "\n\n"
+
 type DefaultChunkfier struct {
 	chunkSize    int
 	chunkOverlap int
@@ -27,3 +36,101 @@ func (c *DefaultChunkfier) Chunkify(text string) []string {
 
 	return res
 }
+
+// ChunkifySections packs consecutive sections into chunks of up to chunkSize bytes
+// without splitting them. Sections larger than a chunk are split as plain text.
+func (c *DefaultChunkfier) ChunkifySections(sections []readers.Section) []docstore.Chunk {
+	return packSections(sections, c.chunkSize, func(text string) int { return len(text) }, c.Chunkify)
+}
+
+// packSections packs consecutive sections into chunks of up to size, as measured
+// by measure. Sections larger than a chunk are split with split.
+func packSections(sections []readers.Section, size int, measure func(string) int, split func(string) []string) []docstore.Chunk {
+	var chunks []docstore.Chunk
+	var pack []readers.Section
+	total := 0
+	sep := measure(sectionSeparator)
+
+	flush := func() {
+		if len(pack) == 0 {
+			return
+		}
+
+		texts := make([]string, 0, len(pack))
+		for _, s := range pack {
+			texts = append(texts, s.Text)
+		}
+
+		location := pack[0].Location
+		if len(pack) > 1 {
+			location += " - " + pack[len(pack)-1].Location
+		}
+
+		chunks = append(chunks, docstore.Chunk{
+			Text:     strings.Join(texts, sectionSeparator),
+			Location: location,
+		})
+		pack = nil
+		total = 0
+	}
+
+	for _, s := range sections {
+		n := measure(s.Text)
+		if n > size {
+			flush()
+			for _, text := range split(s.Text) {
+				chunks = append(chunks, docstore.Chunk{Text: text, Location: s.Location})
+			}
+			continue
+		}
+
+		if len(pack) > 0 && total+sep+n > size {
+			flush()
+		}
+
+		if len(pack) > 0 {
+			total += sep
+		}
+		pack = append(pack, s)
+		total += n
+	}
+
+	flush()
+	return chunks
+}
+
+// ParentChildChunkifier cuts documents into large parent chunks, then splits every
+// parent into small children. Children are embedded and matched by searches, while
+// their parent is returned as the result.
+type ParentChildChunkifier struct {
+	parents  chunkifier
+	children chunkifier
+}
+
+func (c *ParentChildChunkifier) Chunkify(text string) []string {
+	return c.parents.Chunkify(text)
+}
+
+// splitParents turns parent chunks into children referencing them. Parents too
+// small to be split are stored as they are.
+func (c *ParentChildChunkifier) splitParents(parents []docstore.Chunk) []docstore.Chunk {
+	var res []docstore.Chunk
+	for i, p := range parents {
+		children := c.children.Chunkify(p.Text)
+		if len(children) == 1 && children[0] == p.Text {
+			res = append(res, p)
+			continue
+		}
+
+		for _, text := range children {
+			res = append(res, docstore.Chunk{
+				Text:     text,
+				Location: p.Location,
+				Parent:   p.Text,
+				ParentID: i,
+			})
+		}
+	}
+
+	return res
+}
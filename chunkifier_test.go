@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/gamma-omg/rag-mcp/docstore"
+	"github.com/gamma-omg/rag-mcp/readers"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -31,3 +33,59 @@ func Test_Chunkify(t *testing.T) {
 		})
 	}
 }
+
+func Test_ChunkifySections(t *testing.T) {
+	dc := DefaultChunkfier{
+		chunkSize:    10,
+		chunkOverlap: 0,
+	}
+
+	out := dc.ChunkifySections([]readers.Section{
+		{Location: "cell 1", Text: "abc"},
+		{Location: "cell 2", Text: "def"},
+		{Location: "cell 3", Text: "ghijkl"},
+		{Location: "cell 4", Text: "0123456789abc"},
+		{Location: "cell 5", Text: "xyz"},
+	})
+
+	assert.Equal(t, []docstore.Chunk{
+		{Text: "abc\n\ndef", Location: "cell 1 - cell 2"},
+		{Text: "ghijkl", Location: "cell 3"},
+		{Text: "0123456789", Location: "cell 4"},
+		{Text: "abc", Location: "cell 4"},
+		{Text: "xyz", Location: "cell 5"},
+	}, out)
+}
+
+func Test_ParentChildChunkifier(t *testing.T) {
+	c := &ParentChildChunkifier{
+		parents:  &DefaultChunkfier{chunkSize: 6},
+		children: &DefaultChunkfier{chunkSize: 3},
+	}
+
+	chunks := chunkify(c, readers.Document{Text: "abcdefgh"})
+	assert.Equal(t, []docstore.Chunk{
+		{Text: "abc", Parent: "abcdef", ParentID: 0},
+		{Text: "def", Parent: "abcdef", ParentID: 0},
+		{Text: "gh"},
+	}, chunks)
+}
+
+func Test_ParentChildChunkifier_Sections(t *testing.T) {
+	c := &ParentChildChunkifier{
+		parents:  &DefaultChunkfier{chunkSize: 100},
+		children: &DefaultChunkfier{chunkSize: 4},
+	}
+
+	chunks := chunkify(c, readers.Document{
+		Sections: []readers.Section{
+			{Location: "slide 1", Text: "abcdef"},
+			{Location: "slide 2", Text: "xyz"},
+		},
+	})
+	assert.Equal(t, []docstore.Chunk{
+		{Text: "abcd", Location: "slide 1", Parent: "abcdef", ParentID: 0},
+		{Text: "ef", Location: "slide 1", Parent: "abcdef", ParentID: 0},
+		{Text: "xyz", Location: "slide 2"},
+	}, chunks)
+}
@@ -0,0 +1,741 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/amikos-tech/chroma-go/pkg/embeddings"
+	"github.com/gamma-omg/rag-mcp/docstore"
+	"github.com/gamma-omg/rag-mcp/metrics"
+	"github.com/gamma-omg/rag-mcp/tracing"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const usage = `Usage: rag-mcp <command> [flags]
+
+Commands:
+  serve             index the documents directory and serve MCP searches (default)
+  sync              bring the index in line with the documents directory and exit
+  query "<text>"    search the index
+  ls                list the ingested documents
+  forget <path>     remove the documents of a file from the index
+  stats             summarize the index
+  export            dump the index with its vectors to a JSON lines file
+  import <file>     replace the index with an export, without embedding again
+  eval <file>       score searches against a file of queries with expected results
+
+Run rag-mcp <command> -h for the flags of a command.
+`
+
+// command runs a subcommand with its arguments, writing its output to out
+type command func(ctx context.Context, args []string, out io.Writer) error
+
+var commands = map[string]command{
+	"serve":  runServe,
+	"sync":   runSync,
+	"query":  runQuery,
+	"ls":     runList,
+	"forget": runForget,
+	"stats":  runStats,
+	"export": runExport,
+	"import": runImport,
+	"eval":   runEval,
+}
+
+// run dispatches the command line to a subcommand, flags alone start the server
+func run(ctx context.Context, args []string, out io.Writer) error {
+	name := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("unknown command %q", name)
+	}
+
+	return cmd(ctx, args, out)
+}
+
+// app holds the configuration and the services shared by the commands
+type app struct {
+	cfg   *Config
+	log   *slog.Logger
+	level *slog.LevelVar
+	ef    embeddings.EmbeddingFunction
+	store *docstore.ChromaStore
+	reg   *DocRegistry
+
+	closers []func()
+}
+
+type appOptions struct {
+	cfgPath string
+	reset   bool
+	// logStdout copies logs to stdout, other commands keep stdout for their output
+	logStdout bool
+	// results overrides the number of search results when positive
+	results int
+	// queryCache is a file caching query embeddings, if any
+	queryCache string
+	// lockIndex takes the index lock, for the commands writing the index
+	lockIndex bool
+	// queue opens the ingestion queue, which only the server applies and saves
+	queue bool
+}
+
+// openApp reads the configuration and connects to the store
+func openApp(opts appOptions) (_ *app, err error) {
+	cfg, err := readConfig(opts.cfgPath)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Results = cmp.Or(opts.results, cfg.Results)
+
+	a := &app{cfg: cfg}
+	defer func() {
+		if err != nil {
+			a.Close()
+		}
+	}()
+
+	logFile, err := os.OpenFile(cfg.LogFile, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log file: %w", err)
+	}
+	a.closers = append(a.closers, func() { logFile.Close() })
+
+	var logOut io.Writer = logFile
+	if opts.logStdout {
+		logOut = io.MultiWriter(logFile, os.Stdout)
+	}
+	a.level = new(slog.LevelVar)
+	a.level.Set(cfg.logLevel())
+	a.log = slog.New(tracing.LogHandler(slog.NewJSONHandler(logOut, &slog.HandlerOptions{Level: a.level})))
+
+	shutdownTracing, err := initTracing(context.Background(), cfg.Tracing)
+	if err != nil {
+		return nil, err
+	}
+	a.closers = append(a.closers, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			a.log.Warn("failed to flush traces", "error", err)
+		}
+	})
+
+	a.ef, err = createEmbeddingFunction(cfg, a.log)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create embedding function: %w", err)
+	}
+
+	if opts.queryCache != "" {
+		cache, err := openQueryCache(opts.queryCache, embeddingID(cfg), a.ef)
+		if err != nil {
+			return nil, err
+		}
+		a.ef = cache
+		a.closers = append(a.closers, func() {
+			if err := cache.Save(); err != nil {
+				a.log.Warn("failed to save query cache", "error", err)
+			}
+		})
+	}
+
+	if opts.lockIndex {
+		lock, err := lockIndex(cfg.IndexLock)
+		if err != nil {
+			return nil, err
+		}
+		a.closers = append(a.closers, func() {
+			if err := lock.Unlock(); err != nil {
+				a.log.Warn("failed to release index lock", "error", err)
+			}
+		})
+	}
+
+	a.store, err = initDocStore(cfg, a.ef, opts.reset, a.log)
+	if err != nil {
+		return nil, err
+	}
+
+	a.reg, err = createRegistry(cfg, a.store, a.log)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.queue && cfg.Queue.File != "" {
+		a.reg.queue, err = openQueue(queueConfig{
+			File:        cfg.Queue.File,
+			MaxAttempts: cfg.Queue.MaxAttempts,
+			Backoff:     time.Duration(cfg.Queue.BackoffMs) * time.Millisecond,
+			MaxBackoff:  time.Duration(cfg.Queue.MaxBackoffMs) * time.Millisecond,
+		}, a.log)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return a, nil
+}
+
+// Close flushes the traces and closes the log file
+func (a *app) Close() {
+	for _, c := range slices.Backward(a.closers) {
+		c()
+	}
+}
+
+func createRegistry(cfg *Config, store *docstore.ChromaStore, logger *slog.Logger) (*DocRegistry, error) {
+	dflt, err := createChunkProfile(cfg, ChunkProfileConfig{
+		Name:          defaultProfileName,
+		Size:          cfg.ChunkSize,
+		Overlap:       cfg.ChunkOverlap,
+		ParentSize:    cfg.ParentChunkSize,
+		ParentOverlap: cfg.ParentChunkOverlap,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	profiles, err := createChunkProfiles(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	reg := &DocRegistry{
+		log:              logger,
+		root:             cfg.DocRoot,
+		mergeEventsDelay: time.Duration(cfg.MergeEventsMs) * time.Millisecond,
+		storer:           store,
+		chunkifier:       dflt.chunkifier,
+		defaultProfile:   dflt.id,
+		profiles:         profiles,
+		fingerprint:      createFingerprint(cfg, append([]chunkProfile{dflt}, profiles...)),
+		rebuildInShadow:  cfg.Reindex != "in_place",
+		archiveMaxSize:   int64(cfg.Archives.MaxSizeMb) << 20,
+		archiveMaxDepth:  cfg.Archives.MaxDepth,
+		queueFile:        cfg.Queue.File,
+	}
+	registerReaders(reg, cfg)
+
+	return reg, nil
+}
+
+func newFlagSet(name, args string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: rag-mcp %s [flags] %s\n", name, args)
+		fs.PrintDefaults()
+	}
+
+	return fs, fs.String("config", "cfg/config.yaml", "Configuration file for the MCP server")
+}
+
+func runServe(ctx context.Context, args []string, out io.Writer) error {
+	fs, cfgPath := newFlagSet("serve", "")
+	reset := fs.Bool("reset", false, "Reinitialized the database from scratch if set")
+	reindex := fs.Bool("reindex", false, "Rebuild the index in a shadow collection while serving searches from the current one")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *reset && *reindex {
+		return errors.New("-reset and -reindex are mutually exclusive")
+	}
+
+	a, err := openApp(appOptions{cfgPath: *cfgPath, reset: *reset, logStdout: true, lockIndex: true, queue: true})
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	auth := newMCPAuth(a.cfg.Auth.Keys, a.log)
+	if !auth.Enabled() {
+		a.log.Warn("no auth keys configured, the MCP endpoint accepts any client")
+	}
+
+	reloader := &configReloader{
+		path:    *cfgPath,
+		log:     a.log,
+		level:   a.level,
+		store:   a.store,
+		ef:      a.ef,
+		auth:    auth,
+		current: a.cfg,
+	}
+	go reloader.Run(ctx)
+
+	reg := a.reg
+	failed := make(chan error, 3)
+	go func() {
+		var err error
+		if *reindex {
+			err = reg.Reindex(ctx)
+		} else {
+			err = reg.Sync(ctx)
+		}
+		if err != nil {
+			failed <- err
+			return
+		}
+
+		if reg.queue != nil {
+			go reg.queue.Run(ctx, reg.applyChange)
+		}
+
+		if err := reg.Watch(ctx); err != nil {
+			failed <- err
+		}
+	}()
+
+	var adminSrv *http.Server
+	if a.cfg.Admin.Addr != "" {
+		if a.cfg.Admin.Token == "" {
+			return errors.New("the admin API requires a token")
+		}
+
+		admin := &adminServer{
+			registry:  reg,
+			retriever: a.store,
+			log:       a.log,
+			token:     a.cfg.Admin.Token,
+			ctx:       ctx,
+		}
+		if reg.queue != nil {
+			admin.queue = reg.queue
+		}
+
+		adminSrv = &http.Server{Addr: a.cfg.Admin.Addr, Handler: admin.Handler()}
+		go func() {
+			failed <- listen(adminSrv, a.cfg)
+		}()
+	}
+
+	srv := NewRagServer(a.store, a.log)
+	if reg.queue != nil {
+		addQueueTools(srv, reg.queue, a.log)
+	}
+	scheme := "http"
+	if a.cfg.TLS.CertFile != "" {
+		scheme = "https"
+	}
+	sse := server.NewSSEServer(srv, server.WithBaseURL(fmt.Sprintf("%s://%s", scheme, a.cfg.ServerAddr)))
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	health := &healthServer{store: a.store, ef: a.ef, registry: reg}
+	health.register(mux)
+	mux.Handle("/", auth.Handler(sse))
+
+	httpSrv := &http.Server{Addr: a.cfg.ServerAddr, Handler: mux}
+	go func() {
+		failed <- listen(httpSrv, a.cfg)
+	}()
+
+	select {
+	case err := <-failed:
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		err := httpSrv.Shutdown(shutdownCtx)
+		if adminSrv != nil {
+			err = errors.Join(err, adminSrv.Shutdown(shutdownCtx))
+		}
+		return err
+	}
+}
+
+// listen serves over TLS when a certificate is configured
+func listen(srv *http.Server, cfg *Config) error {
+	if cfg.TLS.CertFile != "" {
+		return srv.ListenAndServeTLS(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+	}
+
+	return srv.ListenAndServe()
+}
+
+func runSync(ctx context.Context, args []string, out io.Writer) error {
+	fs, cfgPath := newFlagSet("sync", "")
+	reset := fs.Bool("reset", false, "Reinitialized the database from scratch if set")
+	reindex := fs.Bool("reindex", false, "Rebuild the index in a shadow collection")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *reset && *reindex {
+		return errors.New("-reset and -reindex are mutually exclusive")
+	}
+
+	a, err := openApp(appOptions{cfgPath: *cfgPath, reset: *reset, lockIndex: true})
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	if *reindex {
+		err = a.reg.Reindex(ctx)
+	} else {
+		err = a.reg.Sync(ctx)
+	}
+	if err != nil {
+		return err
+	}
+
+	status := a.reg.Status()
+	fmt.Fprintf(out, "%d document(s) ingested in %s\n", status.Done, time.Since(status.Started).Round(time.Millisecond))
+	return nil
+}
+
+func runQuery(ctx context.Context, args []string, out io.Writer) error {
+	fs, cfgPath := newFlagSet("query", `"<text>"`)
+	asJSON := fs.Bool("json", false, "Print the results as JSON")
+	results := fs.Int("n", 0, "Number of results, defaults to the results setting of the config")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("missing query")
+	}
+
+	a, err := openApp(appOptions{cfgPath: *cfgPath, results: *results})
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	res, err := a.store.Retrieve(ctx, strings.Join(fs.Args(), " "))
+	if err != nil {
+		return err
+	}
+
+	hits := make([]searchHit, 0, len(res))
+	for _, r := range res {
+		hits = append(hits, newSearchHit(r))
+	}
+
+	if *asJSON {
+		return printJSON(out, hits)
+	}
+
+	return printTable(out, []string{"SCORE", "FILE", "LOCATION", "TEXT"}, len(hits), func(i int) []any {
+		h := hits[i]
+		return []any{fmt.Sprintf("%.4f", h.Score), h.File, h.Location, snippet(h.Text, 80)}
+	})
+}
+
+func runList(ctx context.Context, args []string, out io.Writer) error {
+	fs, cfgPath := newFlagSet("ls", "")
+	asJSON := fs.Bool("json", false, "Print the documents as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	a, err := openApp(appOptions{cfgPath: *cfgPath})
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	docs, err := a.reg.Documents(ctx)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		return printJSON(out, docs)
+	}
+
+	return printTable(out, []string{"FILE", "CRC", "STATUS", "LAST ERROR"}, len(docs), func(i int) []any {
+		d := docs[i]
+		return []any{d.File, fmt.Sprintf("%08x", d.Crc), d.Status, d.LastError}
+	})
+}
+
+func runForget(ctx context.Context, args []string, out io.Writer) error {
+	fs, cfgPath := newFlagSet("forget", "<path>...")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("missing path")
+	}
+
+	a, err := openApp(appOptions{cfgPath: *cfgPath, lockIndex: true})
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	for _, path := range fs.Args() {
+		if err := a.reg.ForgetPath(ctx, path); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(out, "forgot %s\n", path)
+	}
+
+	return nil
+}
+
+// indexStats summarizes the index
+type indexStats struct {
+	Documents   int            `json:"documents"`
+	Files       int            `json:"files"`
+	Chunks      int            `json:"chunks"`
+	Profiles    map[string]int `json:"profiles"`
+	Pending     int            `json:"pending"`
+	Failed      int            `json:"failed"`
+	Fingerprint string         `json:"fingerprint"`
+}
+
+func runStats(ctx context.Context, args []string, out io.Writer) error {
+	fs, cfgPath := newFlagSet("stats", "")
+	asJSON := fs.Bool("json", false, "Print the statistics as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	a, err := openApp(appOptions{cfgPath: *cfgPath})
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	docs, err := a.store.GetIngested(ctx)
+	if err != nil {
+		return err
+	}
+
+	stats := indexStats{
+		Documents:   len(docs),
+		Profiles:    make(map[string]int),
+		Fingerprint: a.store.Fingerprint(),
+	}
+
+	files := make(map[string]struct{})
+	for _, d := range docs {
+		file, _, _ := strings.Cut(d.File, archiveSep)
+		files[file] = struct{}{}
+		stats.Profiles[d.Profile]++
+	}
+	stats.Files = len(files)
+
+	stats.Chunks, err = a.store.CountChunks(ctx)
+	if err != nil {
+		return err
+	}
+
+	pending, dead, err := a.reg.queuedJobs()
+	if err != nil {
+		return err
+	}
+	stats.Pending, stats.Failed = len(pending), len(dead)
+
+	if *asJSON {
+		return printJSON(out, stats)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "documents\t%d\n", stats.Documents)
+	fmt.Fprintf(w, "files\t%d\n", stats.Files)
+	fmt.Fprintf(w, "chunks\t%d\n", stats.Chunks)
+	fmt.Fprintf(w, "pending changes\t%d\n", stats.Pending)
+	fmt.Fprintf(w, "failed changes\t%d\n", stats.Failed)
+	fmt.Fprintf(w, "fingerprint\t%s\n", stats.Fingerprint)
+	for _, p := range slices.Sorted(maps.Keys(stats.Profiles)) {
+		fmt.Fprintf(w, "profile %s\t%d\n", cmp.Or(p, "(none)"), stats.Profiles[p])
+	}
+
+	return w.Flush()
+}
+
+func runExport(ctx context.Context, args []string, out io.Writer) (err error) {
+	fs, cfgPath := newFlagSet("export", "")
+	output := fs.String("o", "", "Output file, gzip compressed if it ends with .gz, defaults to stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	a, err := openApp(appOptions{cfgPath: *cfgPath})
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	w := out
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("failed to create export file: %w", err)
+		}
+		defer func() {
+			if cerr := f.Close(); cerr != nil && err == nil {
+				err = fmt.Errorf("failed to write export file: %w", cerr)
+			}
+		}()
+		w = f
+
+		if strings.HasSuffix(*output, ".gz") {
+			zw := gzip.NewWriter(f)
+			defer func() {
+				if cerr := zw.Close(); cerr != nil && err == nil {
+					err = fmt.Errorf("failed to write export file: %w", cerr)
+				}
+			}()
+			w = zw
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	n, err := a.store.Export(ctx, bw)
+	if err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write export: %w", err)
+	}
+
+	if *output != "" {
+		fmt.Fprintf(out, "exported %d chunk(s) to %s\n", n, *output)
+	}
+	return nil
+}
+
+func runImport(ctx context.Context, args []string, out io.Writer) error {
+	fs, cfgPath := newFlagSet("import", "<file>")
+	force := fs.Bool("force", false, "Import an index embedded with a different model than the configured one")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected a single export file")
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("failed to open export file: %w", err)
+	}
+	defer f.Close()
+
+	r, err := decompress(f)
+	if err != nil {
+		return err
+	}
+
+	a, err := openApp(appOptions{cfgPath: *cfgPath, lockIndex: true})
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	n, err := a.store.Import(ctx, r, func(h docstore.ExportHeader) error {
+		return a.reg.acceptExport(h, *force)
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "imported %d chunk(s)\n", n)
+	return nil
+}
+
+// acceptExport checks that an export was embedded with the configured model, since
+// queries embedded with another one would not match its vectors
+func (dr *DocRegistry) acceptExport(h docstore.ExportHeader, force bool) error {
+	if h.Fingerprint == "" {
+		if force {
+			return nil
+		}
+		return errors.New("the export does not record its embedding model, use -force to import it anyway")
+	}
+
+	fp, err := parseFingerprint(h.Fingerprint)
+	if err != nil {
+		return err
+	}
+
+	if fp.Embedding != dr.fingerprint.Embedding && !force {
+		return fmt.Errorf("the export was embedded with %q but %q is configured, use -force to import it anyway", fp.Embedding, dr.fingerprint.Embedding)
+	}
+	if fp.Chunking != dr.fingerprint.Chunking {
+		dr.log.Warn("the export was chunked with other settings, its documents are re-chunked on the next sync", "export", fp.Chunking, "configured", dr.fingerprint.Chunking)
+	}
+
+	return nil
+}
+
+// decompress transparently unpacks gzip compressed exports
+func decompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(2)
+	if err != nil || magic[0] != 0x1f || magic[1] != 0x8b {
+		return br, nil
+	}
+
+	zr, err := gzip.NewReader(br)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read compressed export: %w", err)
+	}
+
+	return zr, nil
+}
+
+func printJSON(out io.Writer, v any) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func printTable(out io.Writer, header []string, rows int, row func(i int) []any) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for i := range rows {
+		cells := row(i)
+		for j, c := range cells {
+			if j > 0 {
+				fmt.Fprint(w, "\t")
+			}
+			fmt.Fprint(w, c)
+		}
+		fmt.Fprintln(w)
+	}
+
+	return w.Flush()
+}
+
+// snippet shortens text to a single line of at most n runes
+func snippet(text string, n int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if r := []rune(text); len(r) > n {
+		return string(r[:n-1]) + "…"
+	}
+
+	return text
+}
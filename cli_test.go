@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"flag"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/gamma-omg/rag-mcp/docstore"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_run_UnknownCommand(t *testing.T) {
+	err := run(context.Background(), []string{"frobnicate"}, &bytes.Buffer{})
+	assert.EqualError(t, err, `unknown command "frobnicate"`)
+}
+
+func Test_run_MissingArguments(t *testing.T) {
+	assert.EqualError(t, run(context.Background(), []string{"query"}, &bytes.Buffer{}), "missing query")
+	assert.EqualError(t, run(context.Background(), []string{"forget", "-config", "x.yaml"}, &bytes.Buffer{}), "missing path")
+	assert.EqualError(t, run(context.Background(), []string{"import"}, &bytes.Buffer{}), "expected a single export file")
+}
+
+func Test_run_Help(t *testing.T) {
+	err := run(context.Background(), []string{"ls", "-h"}, &bytes.Buffer{})
+	assert.ErrorIs(t, err, flag.ErrHelp)
+}
+
+func Test_run_ServeIsDefault(t *testing.T) {
+	err := run(context.Background(), []string{"-reset", "-reindex"}, &bytes.Buffer{})
+	assert.EqualError(t, err, "-reset and -reindex are mutually exclusive")
+}
+
+func Test_acceptExport(t *testing.T) {
+	reg := &DocRegistry{
+		log:         slog.New(slog.NewTextHandler(io.Discard, nil)),
+		fingerprint: indexFingerprint{Embedding: "openai/text-embedding-3-small/0", Chunking: "default@1"},
+	}
+	header := func(f indexFingerprint) docstore.ExportHeader {
+		return docstore.ExportHeader{Fingerprint: f.String()}
+	}
+
+	assert.NoError(t, reg.acceptExport(header(indexFingerprint{Embedding: "openai/text-embedding-3-small/0", Chunking: "code@2"}), false))
+	assert.ErrorContains(t, reg.acceptExport(header(indexFingerprint{Embedding: "gemini/embedding-001"}), false), "-force")
+	assert.NoError(t, reg.acceptExport(header(indexFingerprint{Embedding: "gemini/embedding-001"}), true))
+	assert.Error(t, reg.acceptExport(docstore.ExportHeader{}, false))
+}
+
+func Test_decompress(t *testing.T) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte("{}\n"))
+	require.NoError(t, zw.Close())
+
+	for _, in := range []io.Reader{&buf, strings.NewReader("{}\n")} {
+		r, err := decompress(in)
+		require.NoError(t, err)
+		raw, err := io.ReadAll(r)
+		require.NoError(t, err)
+		assert.Equal(t, "{}\n", string(raw))
+	}
+}
+
+func Test_printTable(t *testing.T) {
+	rows := [][]any{{"a.txt", 1}, {"long/name.pdf", 22}}
+
+	var out bytes.Buffer
+	require.NoError(t, printTable(&out, []string{"FILE", "N"}, len(rows), func(i int) []any { return rows[i] }))
+	assert.Equal(t, "FILE           N\na.txt          1\nlong/name.pdf  22\n", out.String())
+}
+
+func Test_snippet(t *testing.T) {
+	assert.Equal(t, "one two three", snippet("one\n two\tthree ", 20))
+	assert.Equal(t, "héllo…", snippet("héllo world", 6))
+}
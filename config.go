@@ -1,45 +1,581 @@
 package main
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
-	LogFile       string `yaml:"log"`
-	DocRoot       string `yaml:"doc_root"`
-	MergeEventsMs int    `yaml:"write_debounce_ms"`
-	ChunkSize     int    `yaml:"chunk_size"`
-	ChunkOverlap  int    `yaml:"chunk_overlap"`
-	RequestSize   int    `yaml:"request_size"`
-	Results       int    `yaml:"results"`
-	ServerAddr    string `yaml:"server_addr"`
-	ChromaAddr    string `yaml:"chroma_addr"`
-	OpenAI        *struct {
-		Model  string `yaml:"model"`
-		ApiKey string `yaml:"api_key"`
+	LogFile            string `yaml:"log"`
+	LogLevel           string `yaml:"log_level"`
+	DocRoot            string `yaml:"doc_root"`
+	MergeEventsMs      int    `yaml:"write_debounce_ms"`
+	ChunkSize          int    `yaml:"chunk_size"`
+	ChunkOverlap       int    `yaml:"chunk_overlap"`
+	ChunkUnit          string `yaml:"chunk_unit"`
+	ParentChunkSize    int    `yaml:"parent_chunk_size"`
+	ParentChunkOverlap int    `yaml:"parent_chunk_overlap"`
+	Tokenizer          string `yaml:"tokenizer"`
+	MaxTokens          int    `yaml:"max_tokens"`
+	RequestSize        int    `yaml:"request_size"`
+	Results            int    `yaml:"results"`
+	ServerAddr         string `yaml:"server_addr"`
+	ChromaAddr         string `yaml:"chroma_addr"`
+	Archives           struct {
+		MaxSizeMb int `yaml:"max_size_mb"`
+		MaxDepth  int `yaml:"max_depth"`
+	} `yaml:"archives"`
+	Email struct {
+		Attachments bool `yaml:"attachments"`
+	} `yaml:"email"`
+	Notebook struct {
+		Outputs bool `yaml:"outputs"`
+	} `yaml:"notebook"`
+	Queue struct {
+		File         string `yaml:"file"`
+		MaxAttempts  int    `yaml:"max_attempts"`
+		BackoffMs    int    `yaml:"backoff_ms"`
+		MaxBackoffMs int    `yaml:"max_backoff_ms"`
+	} `yaml:"queue"`
+	CommandReaders []CommandReaderConfig `yaml:"command_readers"`
+	ChunkProfiles  []ChunkProfileConfig  `yaml:"chunk_profiles"`
+	Reindex        string                `yaml:"reindex"`
+	IndexLock      string                `yaml:"index_lock"`
+	Tracing        TracingConfig         `yaml:"tracing"`
+	Admin          struct {
+		Addr  string `yaml:"addr"`
+		Token string `yaml:"token"`
+	} `yaml:"admin"`
+	Auth struct {
+		Keys []APIKeyConfig `yaml:"keys"`
+	} `yaml:"auth"`
+	TLS struct {
+		CertFile string `yaml:"cert_file"`
+		KeyFile  string `yaml:"key_file"`
+	} `yaml:"tls"`
+	OpenAI *struct {
+		Model      string          `yaml:"model"`
+		ApiKey     string          `yaml:"api_key"`
+		ApiKeyFile string          `yaml:"api_key_file"`
+		Dimensions int             `yaml:"dimensions"`
+		RateLimit  RateLimitConfig `yaml:"rate_limit"`
 	} `yaml:"open_ai"`
 	Gemini *struct {
-		Model  string `yaml:"model"`
-		ApiKey string `yaml:"api_key"`
+		Model      string          `yaml:"model"`
+		ApiKey     string          `yaml:"api_key"`
+		ApiKeyFile string          `yaml:"api_key_file"`
+		RateLimit  RateLimitConfig `yaml:"rate_limit"`
 	}
 }
 
+type CommandReaderConfig struct {
+	Name        string   `yaml:"name"`
+	Command     string   `yaml:"command"`
+	Args        []string `yaml:"args"`
+	Extensions  []string `yaml:"extensions"`
+	MimeTypes   []string `yaml:"mime_types"`
+	Input       string   `yaml:"input"`
+	TimeoutMs   int      `yaml:"timeout_ms"`
+	MaxOutputKb int      `yaml:"max_output_kb"`
+	ExitCodes   []int    `yaml:"exit_codes"`
+	Priority    int      `yaml:"priority"`
+}
+
+// APIKeyConfig grants a client access to the MCP endpoint, the name identifies the
+// client in logs
+type APIKeyConfig struct {
+	Name    string `yaml:"name"`
+	Key     string `yaml:"key"`
+	KeyFile string `yaml:"key_file"`
+}
+
+// RateLimitConfig bounds the embedding requests sent to a provider, zero values
+// leave the corresponding limit off
+type RateLimitConfig struct {
+	RequestsPerMinute int `yaml:"requests_per_minute"`
+	TokensPerMinute   int `yaml:"tokens_per_minute"`
+	BatchSize         int `yaml:"batch_size"`
+	BatchTokens       int `yaml:"batch_tokens"`
+	MaxRetries        int `yaml:"max_retries"`
+	BackoffMs         int `yaml:"backoff_ms"`
+}
+
+// TracingConfig selects where spans are exported: "otlp" sends them to a collector
+// over grpc or http, "file" writes them as JSON to File
+type TracingConfig struct {
+	Exporter    string  `yaml:"exporter"`
+	Protocol    string  `yaml:"protocol"`
+	Endpoint    string  `yaml:"endpoint"`
+	Insecure    bool    `yaml:"insecure"`
+	File        string  `yaml:"file"`
+	ServiceName string  `yaml:"service_name"`
+	SampleRatio float64 `yaml:"sample_ratio"`
+}
+
+// ChunkProfileConfig overrides chunking for the files matching Globs or MimeTypes,
+// profiles are tried in order
+type ChunkProfileConfig struct {
+	Name          string   `yaml:"name"`
+	Strategy      string   `yaml:"strategy"`
+	Size          int      `yaml:"size"`
+	Overlap       int      `yaml:"overlap"`
+	ParentSize    int      `yaml:"parent_size"`
+	ParentOverlap int      `yaml:"parent_overlap"`
+	Globs         []string `yaml:"globs"`
+	MimeTypes     []string `yaml:"mime_types"`
+}
+
+// embeddingModel returns the name of the configured embedding model
+func (cfg *Config) embeddingModel() string {
+	switch {
+	case cfg.OpenAI != nil:
+		return cfg.OpenAI.Model
+	case cfg.Gemini != nil:
+		return cfg.Gemini.Model
+	}
+
+	return ""
+}
+
+// logLevel returns the minimum level of the logged records
+func (cfg *Config) logLevel() slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
+		return slog.LevelInfo
+	}
+
+	return level
+}
+
+// maxTokens returns the token limit of chunks, defaulting to the input limit of
+// the embedding model
+func (cfg *Config) maxTokens() int {
+	if cfg.MaxTokens > 0 {
+		return cfg.MaxTokens
+	}
+
+	return modelMaxTokens[cfg.embeddingModel()]
+}
+
+// parentChunks reports whether documents are chunked with parent sections by
+// default or by any profile
+func (cfg *Config) parentChunks() bool {
+	return cfg.ParentChunkSize > 0 || slices.ContainsFunc(cfg.ChunkProfiles, func(p ChunkProfileConfig) bool {
+		return p.ParentSize > 0
+	})
+}
+
+// minAPIKeyLength is the minimum length of the keys of MCP clients
+const minAPIKeyLength = 16
+
+// envPrefix prefixes the environment variables overriding config settings
+const envPrefix = "RAG"
+
+var envRef = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// defaultConfig holds the settings used for the keys missing from the config file
+func defaultConfig() *Config {
+	cfg := &Config{
+		LogFile:       "log.json",
+		LogLevel:      "info",
+		DocRoot:       "docs",
+		MergeEventsMs: 500,
+		ChunkSize:     512,
+		ChunkOverlap:  64,
+		ChunkUnit:     "bytes",
+		Tokenizer:     defaultTokenizer,
+		RequestSize:   150000,
+		Results:       5,
+		ServerAddr:    ":3001",
+		ChromaAddr:    "http://localhost:8000",
+		Reindex:       "shadow",
+		IndexLock:     "index.lock",
+	}
+	cfg.Archives.MaxSizeMb = 512
+	cfg.Archives.MaxDepth = 2
+	cfg.Email.Attachments = true
+	cfg.Queue.MaxAttempts = 8
+	cfg.Queue.BackoffMs = 1000
+	cfg.Queue.MaxBackoffMs = 600000
+	cfg.Tracing.Protocol = "grpc"
+	cfg.Tracing.ServiceName = "rag-mcp"
+	cfg.Tracing.SampleRatio = 1
+
+	return cfg
+}
+
+// readConfig reads the config file over the defaults. ${VAR} and ${VAR:-default}
+// references are expanded in values, then RAG_* environment variables override the
+// settings, e.g. RAG_CHUNK_SIZE or RAG_OPEN_AI_API_KEY.
 func readConfig(cfgPath string) (*Config, error) {
-	cfgFile, err := os.Open(cfgPath)
+	raw, err := os.ReadFile(cfgPath)
 	if err != nil {
 		return nil, fmt.Errorf("unable to open config file: %w", err)
 	}
-	defer cfgFile.Close()
 
-	cfg := &Config{}
-	dec := yaml.NewDecoder(cfgFile)
-	err = dec.Decode(cfg)
+	cfg, err := parseConfig(raw, os.LookupEnv)
 	if err != nil {
-		return nil, fmt.Errorf("unable to parse config file: %w", err)
+		return nil, fmt.Errorf("invalid config file %s: %w", cfgPath, err)
 	}
 
 	return cfg, nil
 }
+
+func parseConfig(raw []byte, lookupEnv func(string) (string, bool)) (*Config, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("unable to parse config: %w", err)
+	}
+	if err := expandEnv(&doc, lookupEnv); err != nil {
+		return nil, err
+	}
+
+	// unknown keys are only rejected when decoding bytes, so the expanded document
+	// is encoded again
+	expanded, err := yaml.Marshal(&doc)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse config: %w", err)
+	}
+
+	cfg := defaultConfig()
+	dec := yaml.NewDecoder(bytes.NewReader(expanded))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("unable to parse config: %w", err)
+	}
+
+	// provider sections are only allocated when configured, so their defaults are
+	// filled in after decoding, for the keys left out of the file
+	if cfg.OpenAI != nil {
+		cfg.OpenAI.RateLimit.setDefaults(lookupNode(&doc, "open_ai", "rate_limit"))
+	}
+	if cfg.Gemini != nil {
+		cfg.Gemini.RateLimit.setDefaults(lookupNode(&doc, "gemini", "rate_limit"))
+	}
+
+	if err := overrideFromEnv(reflect.ValueOf(cfg).Elem(), envPrefix, lookupEnv); err != nil {
+		return nil, err
+	}
+	if err := cfg.loadSecrets(); err != nil {
+		return nil, err
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// lookupNode returns the value of a key path in a YAML document, nil if missing
+func lookupNode(n *yaml.Node, path ...string) *yaml.Node {
+	if n != nil && n.Kind == yaml.DocumentNode && len(n.Content) > 0 {
+		n = n.Content[0]
+	}
+
+	for _, key := range path {
+		if n == nil || n.Kind != yaml.MappingNode {
+			return nil
+		}
+
+		var next *yaml.Node
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Value == key {
+				next = n.Content[i+1]
+				break
+			}
+		}
+		n = next
+	}
+
+	return n
+}
+
+// expandEnv replaces ${VAR} and ${VAR:-default} in the scalar values of a YAML
+// document, comments are left alone
+func expandEnv(n *yaml.Node, lookupEnv func(string) (string, bool)) error {
+	if n.Kind == yaml.ScalarNode && strings.Contains(n.Value, "${") {
+		var missing []string
+		n.Value = envRef.ReplaceAllStringFunc(n.Value, func(ref string) string {
+			m := envRef.FindStringSubmatch(ref)
+			if v, ok := lookupEnv(m[1]); ok {
+				return v
+			}
+			if m[2] == "" {
+				missing = append(missing, m[1])
+			}
+			return m[3]
+		})
+		if len(missing) > 0 {
+			return fmt.Errorf("line %d: undefined environment variable %s", n.Line, strings.Join(missing, ", "))
+		}
+
+		// unquoted values are typed again, so that ${PORT} may fill an int
+		if n.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle) == 0 {
+			n.Tag = ""
+		}
+	}
+
+	for _, c := range n.Content {
+		if err := expandEnv(c, lookupEnv); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// overrideFromEnv sets the fields of v from the environment variables named after
+// their YAML path, e.g. RAG_QUEUE_MAX_ATTEMPTS for queue.max_attempts. Provider
+// sections are only overridden when present in the config file, and lists never.
+func overrideFromEnv(v reflect.Value, prefix string, lookupEnv func(string) (string, bool)) error {
+	t := v.Type()
+	for i := range t.NumField() {
+		key, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		if key == "" {
+			key = strings.ToLower(t.Field(i).Name)
+		}
+		name := prefix + "_" + strings.ToUpper(key)
+
+		f := v.Field(i)
+		switch f.Kind() {
+		case reflect.Struct:
+			if err := overrideFromEnv(f, name, lookupEnv); err != nil {
+				return err
+			}
+			continue
+		case reflect.Pointer:
+			if !f.IsNil() && f.Elem().Kind() == reflect.Struct {
+				if err := overrideFromEnv(f.Elem(), name, lookupEnv); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		s, ok := lookupEnv(name)
+		if !ok {
+			continue
+		}
+
+		var err error
+		switch f.Kind() {
+		case reflect.String:
+			f.SetString(s)
+		case reflect.Int:
+			var n int64
+			n, err = strconv.ParseInt(s, 10, 0)
+			f.SetInt(n)
+		case reflect.Float64:
+			var x float64
+			x, err = strconv.ParseFloat(s, 64)
+			f.SetFloat(x)
+		case reflect.Bool:
+			var b bool
+			b, err = strconv.ParseBool(s)
+			f.SetBool(b)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid value %q of %s: %w", s, name, err)
+		}
+	}
+
+	return nil
+}
+
+// loadSecrets reads the API keys given as files, such as Docker secrets
+func (cfg *Config) loadSecrets() error {
+	var err error
+	if cfg.OpenAI != nil {
+		cfg.OpenAI.ApiKey, err = readSecret("open_ai.api_key", cfg.OpenAI.ApiKey, cfg.OpenAI.ApiKeyFile)
+		if err != nil {
+			return err
+		}
+	}
+	if cfg.Gemini != nil {
+		cfg.Gemini.ApiKey, err = readSecret("gemini.api_key", cfg.Gemini.ApiKey, cfg.Gemini.ApiKeyFile)
+		if err != nil {
+			return err
+		}
+	}
+	for i := range cfg.Auth.Keys {
+		k := &cfg.Auth.Keys[i]
+		k.Key, err = readSecret(fmt.Sprintf("auth.keys[%d].key", i), k.Key, k.KeyFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readSecret returns the secret given by a setting or read from the file given by
+// the same setting suffixed with _file
+func readSecret(setting, secret, file string) (string, error) {
+	if file == "" {
+		return secret, nil
+	}
+	if secret != "" {
+		return "", fmt.Errorf("%s and %s_file are mutually exclusive", setting, setting)
+	}
+
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("unable to read %s_file: %w", setting, err)
+	}
+
+	return strings.TrimSpace(string(raw)), nil
+}
+
+// validate reports all the invalid settings at once
+func (cfg *Config) validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	var level slog.Level
+	check(level.UnmarshalText([]byte(cfg.LogLevel)) == nil, "log_level must be debug, info, warn or error, not %q", cfg.LogLevel)
+	check(cfg.DocRoot != "", "doc_root is required")
+	check(cfg.MergeEventsMs >= 0, "write_debounce_ms must not be negative")
+	check(cfg.MaxTokens >= 0, "max_tokens must not be negative")
+	check(cfg.RequestSize > 0, "request_size must be positive")
+	check(cfg.Results > 0, "results must be positive")
+	check(cfg.ServerAddr != "", "server_addr is required")
+	check(cfg.ChromaAddr != "", "chroma_addr is required")
+	check(slices.Contains([]string{"shadow", "in_place"}, cfg.Reindex), "reindex must be shadow or in_place, not %q", cfg.Reindex)
+	check(cfg.Archives.MaxSizeMb >= 0, "archives.max_size_mb must not be negative")
+	check(cfg.Archives.MaxDepth >= 0, "archives.max_depth must not be negative")
+
+	errs = append(errs, validateChunking("", cfg.ChunkUnit, cfg.ChunkSize, cfg.ChunkOverlap, cfg.ParentChunkSize, cfg.ParentChunkOverlap)...)
+	names := make(map[string]bool)
+	for i, p := range cfg.ChunkProfiles {
+		prefix := fmt.Sprintf("chunk_profiles[%d]: ", i)
+		check(p.Name != "", prefix+"name is required")
+		check(!names[p.Name], prefix+"duplicate name %q", p.Name)
+		names[p.Name] = true
+		check(len(p.Globs) > 0 || len(p.MimeTypes) > 0, prefix+"globs or mime_types are required")
+
+		unit := p.Strategy
+		if unit == "" {
+			unit = cfg.ChunkUnit
+		}
+		errs = append(errs, validateChunking(prefix, unit, p.Size, p.Overlap, p.ParentSize, p.ParentOverlap)...)
+	}
+
+	for i, c := range cfg.CommandReaders {
+		prefix := fmt.Sprintf("command_readers[%d]: ", i)
+		check(c.Name != "", prefix+"name is required")
+		check(c.Command != "", prefix+"command is required")
+		check(c.Input == "" || c.Input == "stdin", prefix+"input must be stdin or empty, not %q", c.Input)
+		check(len(c.Extensions) > 0 || len(c.MimeTypes) > 0, prefix+"extensions or mime_types are required")
+		check(c.TimeoutMs >= 0 && c.MaxOutputKb >= 0, prefix+"timeout_ms and max_output_kb must not be negative")
+	}
+
+	if cfg.Queue.File != "" {
+		check(cfg.Queue.MaxAttempts > 0, "queue.max_attempts must be positive")
+		check(cfg.Queue.BackoffMs > 0, "queue.backoff_ms must be positive")
+		check(cfg.Queue.MaxBackoffMs >= cfg.Queue.BackoffMs, "queue.max_backoff_ms must not be smaller than queue.backoff_ms")
+	}
+
+	t := cfg.Tracing
+	switch t.Exporter {
+	case "", "none":
+	case "otlp":
+		check(t.Protocol == "grpc" || t.Protocol == "http", "tracing.protocol must be grpc or http, not %q", t.Protocol)
+	case "file":
+		check(t.File != "", "tracing.file is required by the file exporter")
+	default:
+		check(false, "tracing.exporter must be otlp, file or none, not %q", t.Exporter)
+	}
+	check(t.SampleRatio >= 0 && t.SampleRatio <= 1, "tracing.sample_ratio must be between 0 and 1")
+
+	check(cfg.Admin.Addr == "" || cfg.Admin.Token != "", "admin.token is required when admin.addr is set")
+	check((cfg.TLS.CertFile == "") == (cfg.TLS.KeyFile == ""), "tls.cert_file and tls.key_file must be set together")
+
+	keyNames := make(map[string]bool)
+	for i, k := range cfg.Auth.Keys {
+		prefix := fmt.Sprintf("auth.keys[%d]: ", i)
+		check(k.Name != "", prefix+"name is required")
+		check(!keyNames[k.Name], prefix+"duplicate name %q", k.Name)
+		keyNames[k.Name] = true
+		check(len(k.Key) >= minAPIKeyLength, prefix+"key must be at least %d characters long", minAPIKeyLength)
+	}
+
+	switch {
+	case cfg.OpenAI != nil && cfg.Gemini != nil:
+		check(false, "open_ai and gemini are mutually exclusive")
+	case cfg.OpenAI != nil:
+		check(cfg.OpenAI.Model != "", "open_ai.model is required")
+		check(cfg.OpenAI.ApiKey != "", "open_ai.api_key or open_ai.api_key_file is required")
+		check(cfg.OpenAI.Dimensions >= 0, "open_ai.dimensions must not be negative")
+		errs = append(errs, cfg.OpenAI.RateLimit.validate("open_ai")...)
+	case cfg.Gemini != nil:
+		check(cfg.Gemini.Model != "", "gemini.model is required")
+		check(cfg.Gemini.ApiKey != "", "gemini.api_key or gemini.api_key_file is required")
+		errs = append(errs, cfg.Gemini.RateLimit.validate("gemini")...)
+	default:
+		check(false, "an embedding provider is required, open_ai or gemini")
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateChunking checks the chunk sizes of the default chunking or of a profile.
+// Overlaps must be smaller than chunks, otherwise chunking never advances.
+func validateChunking(prefix, unit string, size, overlap, parentSize, parentOverlap int) []error {
+	var errs []error
+	if unit != "" && unit != "bytes" && unit != "tokens" {
+		errs = append(errs, fmt.Errorf("%schunk unit must be bytes or tokens, not %q", prefix, unit))
+	}
+	if size <= 0 {
+		errs = append(errs, fmt.Errorf("%schunk size must be positive, got %d", prefix, size))
+	}
+	if overlap < 0 || overlap >= size {
+		errs = append(errs, fmt.Errorf("%schunk overlap (%d) must be between 0 and the chunk size (%d)", prefix, overlap, size))
+	}
+	if parentSize == 0 {
+		return errs
+	}
+
+	if parentSize <= size {
+		errs = append(errs, fmt.Errorf("%sparent chunk size (%d) must be larger than the chunk size (%d)", prefix, parentSize, size))
+	}
+	if parentOverlap < 0 || parentOverlap >= parentSize {
+		errs = append(errs, fmt.Errorf("%sparent chunk overlap (%d) must be between 0 and the parent chunk size (%d)", prefix, parentOverlap, parentSize))
+	}
+
+	return errs
+}
+
+// setDefaults sets the retry settings missing from the rate_limit section, explicit
+// zeros are kept so that max_retries: 0 disables retries
+func (rl *RateLimitConfig) setDefaults(section *yaml.Node) {
+	if lookupNode(section, "max_retries") == nil {
+		rl.MaxRetries = defaultRateLimitRetries
+	}
+	if lookupNode(section, "backoff_ms") == nil {
+		rl.BackoffMs = int(defaultRateLimitBackoff / time.Millisecond)
+	}
+}
+
+func (rl RateLimitConfig) validate(section string) []error {
+	if rl.RequestsPerMinute < 0 || rl.TokensPerMinute < 0 || rl.BatchSize < 0 || rl.BatchTokens < 0 || rl.MaxRetries < 0 || rl.BackoffMs < 0 {
+		return []error{fmt.Errorf("%s.rate_limit settings must not be negative", section)}
+	}
+
+	return nil
+}
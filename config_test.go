@@ -0,0 +1,166 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		v, ok := vars[name]
+		return v, ok
+	}
+}
+
+func Test_readConfig_Template(t *testing.T) {
+	cfg, err := readConfig("cfg/template.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, 512, cfg.ChunkSize)
+	assert.Equal(t, "text-embedding-3-large", cfg.OpenAI.Model)
+}
+
+func Test_parseConfig_Defaults(t *testing.T) {
+	cfg, err := parseConfig([]byte("gemini:\n  model: text-embedding-004\n  api_key: secret\n"), env(nil))
+	require.NoError(t, err)
+	assert.Equal(t, 5, cfg.Results)
+	assert.Equal(t, 512, cfg.ChunkSize)
+	assert.Equal(t, "shadow", cfg.Reindex)
+	assert.Equal(t, 8, cfg.Queue.MaxAttempts)
+	assert.Empty(t, cfg.Queue.File)
+}
+
+func Test_parseConfig_RateLimitDefaults(t *testing.T) {
+	cfg, err := parseConfig([]byte("gemini:\n  model: m\n  api_key: k\n"), env(nil))
+	require.NoError(t, err)
+	assert.Equal(t, 5, cfg.Gemini.RateLimit.MaxRetries)
+	assert.Equal(t, 1000, cfg.Gemini.RateLimit.BackoffMs)
+
+	cfg, err = parseConfig([]byte("gemini:\n  model: m\n  api_key: k\n  rate_limit:\n    max_retries: 0\n"), env(nil))
+	require.NoError(t, err)
+	assert.Equal(t, 0, cfg.Gemini.RateLimit.MaxRetries)
+	assert.Equal(t, 1000, cfg.Gemini.RateLimit.BackoffMs)
+}
+
+func Test_parseConfig_UnknownKey(t *testing.T) {
+	_, err := parseConfig([]byte("chunk_sise: 100\ngemini:\n  model: m\n  api_key: k\n"), env(nil))
+	assert.ErrorContains(t, err, "field chunk_sise not found")
+}
+
+func Test_parseConfig_Validation(t *testing.T) {
+	_, err := parseConfig([]byte(`
+chunk_size: 100
+chunk_overlap: 100
+results: 0
+reindex: sometimes
+chunk_profiles:
+  - name: code
+    size: 50
+    overlap: 10
+    parent_size: 40
+admin:
+  addr: ":3002"
+`), env(nil))
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "chunk overlap (100) must be between 0 and the chunk size (100)")
+	assert.ErrorContains(t, err, "results must be positive")
+	assert.ErrorContains(t, err, `reindex must be shadow or in_place, not "sometimes"`)
+	assert.ErrorContains(t, err, "chunk_profiles[0]: globs or mime_types are required")
+	assert.ErrorContains(t, err, "chunk_profiles[0]: parent chunk size (40) must be larger than the chunk size (50)")
+	assert.ErrorContains(t, err, "admin.token is required")
+	assert.ErrorContains(t, err, "an embedding provider is required")
+}
+
+func Test_parseConfig_Env(t *testing.T) {
+	raw := []byte(`
+server_addr: ":${PORT}"
+results: ${RESULTS:-7}
+chroma_addr: "${CHROMA}"
+queue:
+  max_attempts: ${ATTEMPTS}
+open_ai:
+  model: text-embedding-3-small
+  api_key: ${OPENAI_KEY}
+`)
+	cfg, err := parseConfig(raw, env(map[string]string{
+		"PORT":                     "4000",
+		"CHROMA":                   "http://db:8000",
+		"ATTEMPTS":                 "3",
+		"OPENAI_KEY":               "from-file-env",
+		"RAG_CHUNK_SIZE":           "256",
+		"RAG_EMAIL_ATTACHMENTS":    "false",
+		"RAG_OPEN_AI_API_KEY":      "from-override",
+		"RAG_TRACING_SAMPLE_RATIO": "0.5",
+		"RAG_GEMINI_API_KEY":       "ignored",
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, ":4000", cfg.ServerAddr)
+	assert.Equal(t, 7, cfg.Results)
+	assert.Equal(t, "http://db:8000", cfg.ChromaAddr)
+	assert.Equal(t, 3, cfg.Queue.MaxAttempts)
+	assert.Equal(t, 256, cfg.ChunkSize)
+	assert.False(t, cfg.Email.Attachments)
+	assert.Equal(t, "from-override", cfg.OpenAI.ApiKey)
+	assert.Equal(t, 0.5, cfg.Tracing.SampleRatio)
+	assert.Nil(t, cfg.Gemini)
+
+	_, err = parseConfig(raw, env(nil))
+	assert.ErrorContains(t, err, "undefined environment variable PORT")
+
+	_, err = parseConfig([]byte("results: ${RESULTS:-7}\n"), env(map[string]string{"RAG_RESULTS": "many"}))
+	assert.ErrorContains(t, err, `invalid value "many" of RAG_RESULTS`)
+}
+
+func Test_parseConfig_ApiKeyFile(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "openai_key")
+	require.NoError(t, os.WriteFile(secret, []byte("sk-secret\n"), 0o600))
+
+	cfg, err := parseConfig([]byte("open_ai:\n  model: m\n  api_key_file: "+secret+"\n"), env(nil))
+	require.NoError(t, err)
+	assert.Equal(t, "sk-secret", cfg.OpenAI.ApiKey)
+
+	_, err = parseConfig([]byte("open_ai:\n  model: m\n  api_key: k\n  api_key_file: "+secret+"\n"), env(nil))
+	assert.ErrorContains(t, err, "mutually exclusive")
+}
+
+func Test_parseConfig_AuthKeys(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "cursor_key")
+	require.NoError(t, os.WriteFile(secret, []byte("cursor-0123456789abcdef\n"), 0o600))
+
+	cfg, err := parseConfig([]byte(`
+gemini:
+  model: m
+  api_key: k
+auth:
+  keys:
+    - name: cursor
+      key_file: `+secret+`
+    - name: claude
+      key: ${CLAUDE_KEY}
+`), env(map[string]string{"CLAUDE_KEY": "claude-0123456789abcdef"}))
+	require.NoError(t, err)
+	assert.Equal(t, []APIKeyConfig{
+		{Name: "cursor", Key: "cursor-0123456789abcdef", KeyFile: secret},
+		{Name: "claude", Key: "claude-0123456789abcdef"},
+	}, cfg.Auth.Keys)
+
+	_, err = parseConfig([]byte(`
+gemini:
+  model: m
+  api_key: k
+tls:
+  cert_file: server.crt
+auth:
+  keys:
+    - name: cursor
+      key: short
+    - name: cursor
+      key: cursor-0123456789abcdef
+`), env(nil))
+	assert.ErrorContains(t, err, "tls.cert_file and tls.key_file must be set together")
+	assert.ErrorContains(t, err, "auth.keys[0]: key must be at least 16 characters long")
+	assert.ErrorContains(t, err, `auth.keys[1]: duplicate name "cursor"`)
+}
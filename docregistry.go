@@ -9,10 +9,18 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/gamma-omg/rag-mcp/docstore"
+	"github.com/gamma-omg/rag-mcp/metrics"
+	"github.com/gamma-omg/rag-mcp/readers"
+	"github.com/gamma-omg/rag-mcp/tracing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type docStorer interface {
@@ -21,37 +29,114 @@ type docStorer interface {
 	GetIngested(ctx context.Context) ([]docstore.IngestedDoc, error)
 }
 
+// versionCleaner is implemented by stores keeping the versions of replaced
+// documents and interrupted ingestions until they are cleaned up
+type versionCleaner interface {
+	CleanupVersions(ctx context.Context, grace time.Duration) (int, error)
+}
+
+// staleVersionGrace is how long an incomplete version is kept, as it may still be
+// written by another process
+const staleVersionGrace = time.Hour
+
 type fileReader interface {
 	CanRead(path string) bool
 	ReadText(path string) (string, error)
 }
 
+// documentReader is implemented by readers of formats storing several logical
+// documents in a single file, or providing document metadata
+type documentReader interface {
+	ReadDocuments(path string) ([]readers.Document, error)
+}
+
 type chunkifier interface {
 	Chunkify(text string) []string
 }
 
+// sectionChunkifier is implemented by chunkifiers able to keep sections whole,
+// packing consecutive small sections into a single chunk
+type sectionChunkifier interface {
+	ChunkifySections(sections []readers.Section) []docstore.Chunk
+}
+
 type DocRegistry struct {
 	log              *slog.Logger
 	root             string
 	storer           docStorer
 	chunkifier       chunkifier
-	readers          []fileReader
+	readers          readers.Registry
 	mergeEventsDelay time.Duration
+	archiveMaxSize   int64
+	archiveMaxDepth  int
+	// profiles select the chunkifier per file, documents matching none of them
+	// are chunked by chunkifier and recorded under defaultProfile
+	profiles       []chunkProfile
+	defaultProfile string
+	// fingerprint describes the configuration of the index, rebuildInShadow
+	// rebuilds outdated indexes in a shadow collection instead of in place
+	fingerprint     indexFingerprint
+	rebuildInShadow bool
+	// indexChunking is the chunking recorded by the index being synced, empty for
+	// indexes built before fingerprints were recorded
+	indexChunking string
+	progress      indexProgress
+	health        registryHealth
+	// queue holds file changes until they are applied, they are applied right away
+	// if it is nil. Only the server opens it, other commands read queueFile.
+	queue     *ingestQueue
+	queueFile string
+	// syncMu serializes the syncs, rebuilds and file changes writing the index,
+	// whether started on startup, by the queue, the watcher or the admin API
+	syncMu sync.Mutex
 }
 
 type DiskDoc struct {
-	File string
-	Crc  uint32
+	File    string
+	Crc     uint32
+	Profile string
 }
 
 type diskDocs map[string]DiskDoc
 type dbDocs map[string]docstore.IngestedDoc
 
-func (dr *DocRegistry) RegisterReader(readers ...fileReader) {
-	dr.readers = append(dr.readers, readers...)
+func (dr *DocRegistry) RegisterReader(rs ...fileReader) {
+	dr.RegisterPriorityReader(0, rs...)
 }
 
+// RegisterPriorityReader registers readers tried before the readers of lower
+// priority, regardless of the registration order
+func (dr *DocRegistry) RegisterPriorityReader(priority int, rs ...fileReader) {
+	for _, r := range rs {
+		dr.readers.Register(r, priority)
+	}
+}
+
+// Sync brings the index in line with the documents directory, then deletes stale
+// document versions. Only the process holding the index lock may call it.
 func (dr *DocRegistry) Sync(ctx context.Context) error {
+	dr.syncMu.Lock()
+	defer dr.syncMu.Unlock()
+
+	return dr.sync(ctx)
+}
+
+// StartSync starts a sync in the background unless the index is being written,
+// done is called with its result
+func (dr *DocRegistry) StartSync(ctx context.Context, done func(error)) bool {
+	if !dr.syncMu.TryLock() {
+		return false
+	}
+
+	go func() {
+		defer dr.syncMu.Unlock()
+		done(dr.sync(ctx))
+	}()
+
+	return true
+}
+
+func (dr *DocRegistry) sync(ctx context.Context) error {
 	dr.log.Info("syncing documents directory", "root", dr.root)
 
 	err := ensureDir(dr.root)
@@ -59,6 +144,38 @@ func (dr *DocRegistry) Sync(ctx context.Context) error {
 		return fmt.Errorf("failed to create documents directory: %w", err)
 	}
 
+	if is, ok := dr.storer.(indexStorer); ok && !dr.fingerprint.isZero() {
+		err = dr.syncIndex(ctx, is)
+	} else {
+		err = dr.syncDocs(ctx)
+	}
+	if err != nil {
+		return err
+	}
+
+	dr.cleanupVersions(ctx)
+	return nil
+}
+
+// cleanupVersions deletes the stale versions of documents, failures are only logged
+// as they are retried on the next sync
+func (dr *DocRegistry) cleanupVersions(ctx context.Context) {
+	vc, ok := dr.storer.(versionCleaner)
+	if !ok {
+		return
+	}
+
+	deleted, err := vc.CleanupVersions(ctx, staleVersionGrace)
+	if err != nil {
+		dr.log.Warn("failed to clean up stale document versions", "error", err)
+	}
+	if deleted > 0 {
+		dr.log.Info("deleted stale document versions", "versions", deleted)
+	}
+}
+
+// syncDocs brings the store in line with the documents on disk
+func (dr *DocRegistry) syncDocs(ctx context.Context) error {
 	disk, err := dr.collectDocs()
 	if err != nil {
 		return fmt.Errorf("collect docs from disk: %w", err)
@@ -90,6 +207,7 @@ func (dr *DocRegistry) Sync(ctx context.Context) error {
 	}
 
 	dr.log.Info("documents registry synchronized", "root", dr.root)
+	dr.setSynced()
 	return nil
 }
 
@@ -105,8 +223,10 @@ func (dr *DocRegistry) Watch(ctx context.Context) error {
 		return fmt.Errorf("add %s to watcher: %w", dr.root, err)
 	}
 
+	dr.setWatching(true)
 	go func() {
 		defer w.Close()
+		defer dr.setWatching(false)
 
 		events := mergeEvents(w.Events, dr.mergeEventsDelay)
 		for {
@@ -114,6 +234,7 @@ func (dr *DocRegistry) Watch(ctx context.Context) error {
 			case e := <-events:
 				dr.processFsEvent(e)
 			case e := <-w.Errors:
+				dr.recordError(fmt.Errorf("watch docs: %w", e))
 				dr.log.Error(fmt.Sprintf("error watching docs: %s", e.Error()))
 			case <-ctx.Done():
 				return
@@ -172,92 +293,160 @@ func mergeEvents(in <-chan fsnotify.Event, dt time.Duration) <-chan fsnotify.Eve
 }
 
 func (dr *DocRegistry) processFsEvent(evt fsnotify.Event) {
-	if evt.Op.Has(fsnotify.Write) || evt.Op.Has(fsnotify.Create) {
-		dr.log.Debug("fsevent write", "file", evt.Name)
-
-		err := dr.forgetFile(evt.Name)
-		if err != nil {
-			dr.log.Warn("failed to handle write file: failed to forget file", "error", err, "file", evt.Name)
-			return
-		}
-
-		err = dr.ingestFile(evt.Name)
-		if err != nil {
-			dr.log.Warn("failed to handle write file: failed to ingest file", "error", err, "file", evt.Name)
-			return
+	for _, op := range []fsnotify.Op{fsnotify.Create, fsnotify.Write, fsnotify.Remove, fsnotify.Rename, fsnotify.Chmod} {
+		if evt.Op.Has(op) {
+			metrics.FsEvents.WithLabelValues(strings.ToLower(op.String())).Inc()
 		}
 	}
 
-	if evt.Op.Has(fsnotify.Rename) {
+	var op jobOp
+	switch {
+	case dr.traverseArchive(evt.Name) && (evt.Op.Has(fsnotify.Write) || evt.Op.Has(fsnotify.Create)):
+		dr.log.Debug("fsevent archive write", "file", evt.Name)
+		op = jobArchive
+	case evt.Op.Has(fsnotify.Rename):
 		dr.log.Debug("fsevent rename", "file", evt.Name)
+		op = jobForget
+	case evt.Op.Has(fsnotify.Remove):
+		dr.log.Debug("fsevent remove", "file", evt.Name)
+		op = jobForget
+	case evt.Op.Has(fsnotify.Write) || evt.Op.Has(fsnotify.Create):
+		dr.log.Debug("fsevent write", "file", evt.Name)
+		op = jobReplace
+	default:
+		return
+	}
 
-		err := dr.forgetFile(evt.Name)
+	if dr.queue != nil {
+		err := dr.queue.Push(evt.Name, op)
 		if err != nil {
-			dr.log.Warn("failed to handle write rename file", "error", err, "file", evt.Name)
+			dr.recordError(err)
+			dr.log.Error("failed to queue file change", "error", err, "file", evt.Name, "op", op)
 		}
 		return
 	}
 
-	if evt.Op.Has(fsnotify.Remove) {
-		dr.log.Debug("fsevent remove", "file", evt.Name)
+	err := dr.applyChange(context.Background(), evt.Name, op)
+	if err != nil {
+		dr.log.Warn("failed to apply file change", "error", err, "file", evt.Name, "op", op)
+	}
+}
 
-		err := dr.forgetFile(evt.Name)
+// applyChange brings the store in line with a changed file
+func (dr *DocRegistry) applyChange(ctx context.Context, path string, op jobOp) (err error) {
+	dr.syncMu.Lock()
+	defer dr.syncMu.Unlock()
+
+	defer func() {
 		if err != nil {
-			dr.log.Warn("forget file failed", "error", err, "file", evt.Name)
+			dr.recordError(fmt.Errorf("apply change to %s: %w", path, err))
+		}
+	}()
+
+	if op != jobForget {
+		// the file may be gone by the time a queued change is applied
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			op = jobForget
 		}
 	}
+
+	switch op {
+	case jobArchive:
+		return dr.syncArchive(ctx, path)
+	case jobReplace:
+		return dr.replaceFile(ctx, path)
+	case jobForget:
+		return dr.forgetFile(ctx, path)
+	}
+
+	return fmt.Errorf("unknown file change %q", op)
 }
 
-func (dr *DocRegistry) ingestFile(path string) error {
-	reader, err := dr.findReader(path)
+// replaceFile ingests the current version of a file before forgetting the previous
+// one, so that the file stays searchable while it is re-embedded. If ingestion fails
+// the previous version of the documents not yet replaced is kept.
+func (dr *DocRegistry) replaceFile(ctx context.Context, path string) error {
+	old, err := dr.ingestedDocs(ctx, path)
 	if err != nil {
-		dr.log.Warn("unable to ingest file: reader not found", "error", err, "file", path)
-		return nil
+		return fmt.Errorf("replaceFile failed to get ingested files: %w", err)
 	}
 
-	text, err := reader.ReadText(path)
-	if err != nil {
-		return fmt.Errorf("ingestFile unable to read %s: %w", path, err)
+	replaced, ingestErr := dr.ingestFile(ctx, path)
+	for _, d := range old {
+		if ingestErr != nil && !slices.Contains(replaced, d.File) {
+			continue
+		}
+
+		err := dr.forget(ctx, d)
+		if err != nil {
+			return errors.Join(ingestErr, fmt.Errorf("replaceFile failed to remove previous version of %s from db: %w", d.File, err))
+		}
+
+		dr.log.InfoContext(ctx, "previous version removed", "file", d.File, "crc", d.Crc)
 	}
 
+	return ingestErr
+}
+
+// ingestFile ingests the documents of a file, returning the ones stored before an
+// error, if any
+func (dr *DocRegistry) ingestFile(ctx context.Context, path string) (_ []string, err error) {
 	rel, err := filepath.Rel(dr.root, path)
 	if err != nil {
-		return fmt.Errorf("ingestFile invalid file path %s: %w", path, err)
+		return nil, fmt.Errorf("ingestFile invalid file path %s: %w", path, err)
 	}
 
-	doc := docstore.Doc{
-		File:   rel,
-		Crc:    crc32.Checksum([]byte(text), crc32.IEEETable),
-		Chunks: dr.chunkifier.Chunkify(text),
+	ctx, span := tracing.Start(ctx, "ingest file", attribute.String("file", rel))
+	defer func() { tracing.End(span, err) }()
+
+	reader, mimeType, err := dr.findReader(path, rel)
+	if err != nil {
+		dr.log.WarnContext(ctx, "unable to ingest file: reader not found", "error", err, "file", path)
+		return nil, nil
 	}
-	err = dr.storer.Ingest(context.Background(), doc)
+
+	docs, err := dr.read(ctx, rel, func() ([]readers.Document, error) {
+		return readDocuments(reader, path, mimeType)
+	})
 	if err != nil {
-		return fmt.Errorf("ingestFile failed to store %s content to db: %w", path, err)
+		return nil, fmt.Errorf("ingestFile unable to read %s: %w", path, err)
 	}
 
-	dr.log.Info("document ingested", "file", doc.File, "crc", doc.Crc)
-	return nil
-}
+	var ingested []string
 
-func (dr *DocRegistry) forgetFile(path string) error {
-	docs, err := dr.storer.GetIngested(context.Background())
-	if err != nil {
-		return fmt.Errorf("forgetFile failed to get ingested files: %w", err)
+	for _, d := range docs {
+		file := memberPath(rel, d.Name)
+		profile := dr.profileFor(file, d.MimeType)
+		doc := docstore.Doc{
+			File:     file,
+			Crc:      crc32.Checksum([]byte(d.Text), crc32.IEEETable),
+			MimeType: d.MimeType,
+			Profile:  profile.id,
+			Meta:     d.Meta,
+			Chunks:   chunkifyTraced(ctx, profile.chunkifier, d),
+		}
+		err = dr.ingest(ctx, doc, d.Reader)
+		if err != nil {
+			return ingested, fmt.Errorf("ingestFile failed to store %s content to db: %w", doc.File, err)
+		}
+
+		ingested = append(ingested, doc.File)
+		dr.log.InfoContext(ctx, "document ingested", "file", doc.File, "crc", doc.Crc)
 	}
 
-	rel, err := filepath.Rel(dr.root, path)
+	return ingested, nil
+}
+
+func (dr *DocRegistry) forgetFile(ctx context.Context, path string) error {
+	docs, err := dr.ingestedDocs(ctx, path)
 	if err != nil {
-		return fmt.Errorf("forgetFile failed to get relative path for %s: %w", path, err)
+		return fmt.Errorf("forgetFile failed to get ingested files: %w", err)
 	}
 
 	for _, d := range docs {
-		if d.File != rel {
-			continue
-		}
-
-		err := dr.storer.Forget(context.Background(), d)
+		err := dr.forget(ctx, d)
 		if err != nil {
-			return fmt.Errorf("forgetFile failed to remove %s from db: %w", rel, err)
+			return fmt.Errorf("forgetFile failed to remove %s from db: %w", d.File, err)
 		}
 
 		dr.log.Info("document removed", "file", d.File, "crc", d.Crc)
@@ -266,33 +455,46 @@ func (dr *DocRegistry) forgetFile(path string) error {
 	return nil
 }
 
+// ingestedDocs returns the ingested documents of a file, including the documents
+// it contains when it is an archive or a container
+func (dr *DocRegistry) ingestedDocs(ctx context.Context, path string) ([]docstore.IngestedDoc, error) {
+	rel, err := filepath.Rel(dr.root, path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid file path %s: %w", path, err)
+	}
+
+	docs, err := dr.storer.GetIngested(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.DeleteFunc(docs, func(d docstore.IngestedDoc) bool {
+		return d.File != rel && !strings.HasPrefix(d.File, rel+archiveSep)
+	}), nil
+}
+
 func (dr *DocRegistry) collectDocs() (docs []DiskDoc, err error) {
 	err = filepath.Walk(dr.root, func(path string, info fs.FileInfo, err error) error {
 		if info.IsDir() {
 			return nil
 		}
 
-		reader, e := dr.findReader(path)
-		if e != nil {
-			dr.log.Warn("undupported file", "file", path)
-			return nil
-		}
-
-		text, e := reader.ReadText(path)
+		rel, e := filepath.Rel(dr.root, path)
 		if e != nil {
 			return e
 		}
 
-		rel, e := filepath.Rel(dr.root, path)
+		budget := dr.archiveBudget()
+		files, e := dr.collectFile(path, rel, rel, 0, &budget)
+		if e != nil && dr.traverseArchive(path) {
+			dr.log.Warn("unable to read archive", "error", e, "file", path)
+			return nil
+		}
 		if e != nil {
-			return err
+			return e
 		}
 
-		docs = append(docs, DiskDoc{
-			File: rel,
-			Crc:  crc32.Checksum([]byte(text), crc32.IEEETable),
-		})
-
+		docs = append(docs, files...)
 		return nil
 	})
 	if err != nil {
@@ -302,38 +504,170 @@ func (dr *DocRegistry) collectDocs() (docs []DiskDoc, err error) {
 	return
 }
 
+// collectFile lists the documents stored in a file. name is used to select the reader
+// and virtual is the path the documents are registered under.
+func (dr *DocRegistry) collectFile(path, name, virtual string, depth int, budget *int64) ([]DiskDoc, error) {
+	docs, err := dr.readFile(path, name, virtual, depth, budget)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]DiskDoc, 0, len(docs))
+	for _, d := range docs {
+		file := memberPath(virtual, d.Name)
+		res = append(res, DiskDoc{
+			File:    file,
+			Crc:     crc32.Checksum([]byte(d.Text), crc32.IEEETable),
+			Profile: dr.profileFor(file, d.MimeType).id,
+		})
+	}
+
+	return res, nil
+}
+
+// readFile reads the documents stored in a file, named by their path inside it.
+// name is used to select the reader and virtual is the path of the file in the
+// documents tree. Unsupported files have no documents.
+func (dr *DocRegistry) readFile(path, name, virtual string, depth int, budget *int64) ([]readers.Document, error) {
+	if dr.traverseArchive(name) {
+		return dr.readArchive(path, virtual, depth+1, budget)
+	}
+
+	reader, mimeType, err := dr.findReader(path, name)
+	if err != nil {
+		dr.log.Warn("undupported file", "file", virtual, "mime_type", mimeType)
+		return nil, nil
+	}
+
+	docs, err := readDocuments(reader, path, mimeType)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", virtual, err)
+	}
+
+	return docs, nil
+}
+
 func (dr *DocRegistry) ingestNewDocuments(ctx context.Context, disk diskDocs, db dbDocs) error {
+	var pending []DiskDoc
 	for _, diskDoc := range disk {
 		dbDoc, ok := db[diskDoc.File]
-		if ok && dbDoc.Crc == diskDoc.Crc {
+		if ok && dbDoc.Crc == diskDoc.Crc && dr.sameProfile(dbDoc.Profile, diskDoc.Profile) {
 			continue
 		}
 
-		reader, err := dr.findReader(diskDoc.File)
-		if err != nil {
-			return fmt.Errorf("failed to find reader for document %s: %w", diskDoc.File, err)
+		pending = append(pending, diskDoc)
+	}
+
+	// the documents stored in the same file, such as the members of an archive,
+	// are read in a single pass over the file
+	var files []string
+	byFile := make(map[string][]DiskDoc)
+	for _, d := range pending {
+		file, _, _ := strings.Cut(d.File, archiveSep)
+		if _, ok := byFile[file]; !ok {
+			files = append(files, file)
 		}
+		byFile[file] = append(byFile[file], d)
+	}
 
-		text, err := reader.ReadText(filepath.Join(dr.root, diskDoc.File))
-		if err != nil {
-			return fmt.Errorf("failed to read document %s: %w", diskDoc.File, err)
+	dr.startProgress(len(pending))
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return err
 		}
 
-		err = dr.storer.Ingest(ctx, docstore.Doc{
-			File:   diskDoc.File,
-			Crc:    diskDoc.Crc,
-			Chunks: dr.chunkifier.Chunkify(text),
-		})
+		if err := dr.ingestDocuments(ctx, file, byFile[file], db); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ingestDocuments stores the new or changed documents found on disk in file
+func (dr *DocRegistry) ingestDocuments(ctx context.Context, file string, pending []DiskDoc, db dbDocs) (err error) {
+	ctx, span := tracing.Start(ctx, "ingest document",
+		attribute.String("file", file),
+		attribute.Int("documents", len(pending)),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	docs, err := dr.read(ctx, file, func() ([]readers.Document, error) {
+		return dr.readFileDocs(file)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read document %s: %w", file, err)
+	}
+
+	byPath := make(map[string]readers.Document, len(docs))
+	for _, d := range docs {
+		byPath[memberPath(file, d.Name)] = d
+	}
+
+	for _, diskDoc := range pending {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		doc, ok := byPath[diskDoc.File]
+		if !ok {
+			return fmt.Errorf("failed to read document %s: not found in %s", diskDoc.File, file)
+		}
+
+		if err := dr.storeDocument(ctx, diskDoc, doc, db); err != nil {
+			return err
+		}
+
+		dr.stepProgress()
+	}
+
+	return nil
+}
+
+// storeDocument stores a document read from disk, replacing its previous chunks
+// when only its chunking profile changed
+func (dr *DocRegistry) storeDocument(ctx context.Context, diskDoc DiskDoc, doc readers.Document, db dbDocs) error {
+	profile := dr.profileFor(diskDoc.File, doc.MimeType)
+	err := dr.ingest(ctx, docstore.Doc{
+		File:     diskDoc.File,
+		Crc:      diskDoc.Crc,
+		MimeType: doc.MimeType,
+		Profile:  profile.id,
+		Meta:     doc.Meta,
+		Chunks:   chunkifyTraced(ctx, profile.chunkifier, doc),
+	}, doc.Reader)
+	if err != nil {
+		return fmt.Errorf("failed to store document %s: %w", diskDoc.File, err)
+	}
+
+	dr.log.InfoContext(ctx, "document ingested", "file", diskDoc.File, "crc", diskDoc.Crc)
+
+	dbDoc, ok := db[diskDoc.File]
+	if ok && dbDoc.Crc == diskDoc.Crc {
+		// the content is unchanged, but the chunking profile is not, so
+		// forgetRemovedDocuments keeps the previous version
+		err := dr.forget(ctx, dbDoc)
 		if err != nil {
-			return fmt.Errorf("failed to store document %s: %w", diskDoc.File, err)
+			return fmt.Errorf("failed to remove previous chunks of document %s: %w", dbDoc.File, err)
 		}
 
-		dr.log.Info("document ingested", "file", diskDoc.File, "crc", diskDoc.Crc)
+		dr.log.InfoContext(ctx, "document re-chunked", "file", diskDoc.File, "profile", diskDoc.Profile)
 	}
 
 	return nil
 }
 
+// read traces the reading stage of an ingestion
+func (dr *DocRegistry) read(ctx context.Context, file string, fn func() ([]readers.Document, error)) ([]readers.Document, error) {
+	_, span := tracing.Start(ctx, "read", attribute.String("file", file))
+	docs, err := fn()
+	if err == nil && len(docs) > 0 {
+		span.SetAttributes(attribute.String("reader", docs[0].Reader))
+	}
+	tracing.End(span, err)
+	return docs, err
+}
+
 func (dr *DocRegistry) forgetRemovedDocuments(ctx context.Context, disk diskDocs, db dbDocs) error {
 	for _, dbDoc := range db {
 		diskDoc, ok := disk[dbDoc.File]
@@ -341,7 +675,7 @@ func (dr *DocRegistry) forgetRemovedDocuments(ctx context.Context, disk diskDocs
 			continue
 		}
 
-		err := dr.storer.Forget(ctx, dbDoc)
+		err := dr.forget(ctx, dbDoc)
 		if err != nil {
 			return fmt.Errorf("failed to remove document %s from store: %w", dbDoc.File, err)
 		}
@@ -352,14 +686,183 @@ func (dr *DocRegistry) forgetRemovedDocuments(ctx context.Context, disk diskDocs
 	return nil
 }
 
-func (dr *DocRegistry) findReader(file string) (fileReader, error) {
-	for _, r := range dr.readers {
-		if r.CanRead(file) {
-			return r, nil
+// readFileDocs reads the documents of a file addressed by a path relative to the
+// root. Archive members and documents of container files are named by their path
+// inside the file, so that bundle.zip holds spec/intro.pdf and mail/inbox.mbox
+// holds message-3.
+func (dr *DocRegistry) readFileDocs(file string) ([]readers.Document, error) {
+	budget := dr.archiveBudget()
+	return dr.readFile(filepath.Join(dr.root, file), file, file, 0, &budget)
+}
+
+// ReadAttachment reads a file attached to a document with the reader selected for
+// it, name is the file name of the attachment. Unsupported attachments have no text.
+func (dr *DocRegistry) ReadAttachment(path, name string) (string, error) {
+	reader, mimeType, err := dr.findReader(path, name)
+	if err != nil {
+		dr.log.Debug("skipping unsupported attachment", "file", name, "mime_type", mimeType)
+		return "", nil
+	}
+
+	docs, err := readDocuments(reader, path, mimeType)
+	if err != nil {
+		return "", err
+	}
+
+	texts := make([]string, 0, len(docs))
+	for _, d := range docs {
+		texts = append(texts, d.Text)
+	}
+
+	return strings.Join(texts, "\n\n"), nil
+}
+
+// chunkifyTraced traces the chunking stage of an ingestion
+func chunkifyTraced(ctx context.Context, c chunkifier, doc readers.Document) []docstore.Chunk {
+	_, span := tracing.Start(ctx, "chunk")
+	defer span.End()
+
+	chunks := chunkify(c, doc)
+	span.SetAttributes(attribute.Int("chunks", len(chunks)))
+	return chunks
+}
+
+// chunkify splits a document into chunks. Sectioned documents are chunked section
+// by section, so that every chunk keeps the location it comes from.
+func chunkify(c chunkifier, doc readers.Document) []docstore.Chunk {
+	if pc, ok := c.(*ParentChildChunkifier); ok {
+		return pc.splitParents(chunkify(pc.parents, doc))
+	}
+
+	if sc, ok := c.(sectionChunkifier); ok && doc.PackSections {
+		return sc.ChunkifySections(doc.Sections)
+	}
+
+	sections := doc.Sections
+	if len(sections) == 0 {
+		sections = []readers.Section{{Text: doc.Text}}
+	}
+
+	var chunks []docstore.Chunk
+	for _, s := range sections {
+		for _, text := range c.Chunkify(s.Text) {
+			chunks = append(chunks, docstore.Chunk{
+				Text:     text,
+				Location: s.Location,
+			})
+		}
+	}
+
+	return chunks
+}
+
+// readDocuments reads all logical documents of a file. Readers producing
+// plain text yield a single unnamed document. Documents are tagged with the
+// detected MIME type unless the reader knows better, and their text is normalized.
+func readDocuments(reader fileReader, path, mimeType string) ([]readers.Document, error) {
+	name := readerName(reader)
+	docs, err := readWith(reader, path, mimeType)
+	if err != nil {
+		metrics.IngestFailures.WithLabelValues(name, "read").Inc()
+		return nil, err
+	}
+
+	for i := range docs {
+		if docs[i].MimeType == "" {
+			docs[i].MimeType = mimeType
 		}
+		docs[i].Reader = name
+		normalizeDocument(&docs[i])
 	}
 
-	return nil, fmt.Errorf("unable to find reader for file: %s", file)
+	return docs, nil
+}
+
+func readWith(reader fileReader, path, mimeType string) ([]readers.Document, error) {
+	switch r := reader.(type) {
+	case readers.MimeReader:
+		return r.ReadMIME(path, mimeType)
+	case documentReader:
+		return r.ReadDocuments(path)
+	}
+
+	text, err := reader.ReadText(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return []readers.Document{{Text: text}}, nil
+}
+
+// readerName labels the documents read by a reader in metrics
+func readerName(reader fileReader) string {
+	if c, ok := reader.(*readers.CommandFileReader); ok && c.Name != "" {
+		return c.Name
+	}
+
+	t := reflect.TypeOf(reader)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	return t.Name()
+}
+
+// ingest stores a document read by the named reader
+func (dr *DocRegistry) ingest(ctx context.Context, doc docstore.Doc, reader string) (err error) {
+	ctx, span := tracing.Start(ctx, "store",
+		attribute.String("file", doc.File),
+		attribute.Int("chunks", len(doc.Chunks)),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	err = dr.storer.Ingest(ctx, doc)
+	if err != nil {
+		metrics.IngestFailures.WithLabelValues(reader, "store").Inc()
+		return err
+	}
+
+	metrics.DocumentsIngested.WithLabelValues(reader).Inc()
+	metrics.ChunksIngested.Add(float64(len(doc.Chunks)))
+	metrics.DocumentChunks.Observe(float64(len(doc.Chunks)))
+	return nil
+}
+
+func (dr *DocRegistry) forget(ctx context.Context, doc docstore.IngestedDoc) error {
+	err := dr.storer.Forget(ctx, doc)
+	if err != nil {
+		return err
+	}
+
+	metrics.DocumentsForgotten.Inc()
+	return nil
+}
+
+// normalizeDocument cleans up the text of a document, so that chunks and the
+// CRC do not depend on line endings, BOMs or Unicode composition
+func normalizeDocument(doc *readers.Document) {
+	doc.Text = readers.NormalizeText(doc.Text)
+	for i := range doc.Sections {
+		doc.Sections[i].Text = readers.NormalizeText(doc.Sections[i].Text)
+	}
+}
+
+func memberPath(file, member string) string {
+	if member == "" {
+		return file
+	}
+
+	return file + archiveSep + member
+}
+
+func (dr *DocRegistry) traverseArchive(file string) bool {
+	return dr.archiveMaxDepth > 0 && isArchive(file)
+}
+
+// findReader selects the reader for the file at path by its content, name is the
+// path of the file in the documents tree used as a type hint
+func (dr *DocRegistry) findReader(path, name string) (fileReader, string, error) {
+	return dr.readers.Find(path, name)
 }
 
 func ensureDir(dir string) error {
@@ -2,20 +2,30 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"hash/crc32"
 	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
 	"slices"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/gamma-omg/rag-mcp/docstore"
+	"github.com/gamma-omg/rag-mcp/metrics"
 	mocks "github.com/gamma-omg/rag-mcp/mocks/main"
+	"github.com/gamma-omg/rag-mcp/readers"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 type mockTextReader struct{}
@@ -31,18 +41,54 @@ func (r *mockTextReader) ReadText(path string) (string, error) {
 	return string(bytes), nil
 }
 
+// mockMailboxReader treats every line of a file as a separate document
+type mockMailboxReader struct{}
+
+func (r *mockMailboxReader) CanRead(path string) bool { return filepath.Ext(path) == ".mbox" }
+
+func (r *mockMailboxReader) ReadText(path string) (string, error) {
+	panic("not implemented")
+}
+
+func (r *mockMailboxReader) ReadDocuments(path string) ([]readers.Document, error) {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var docs []readers.Document
+	for i, line := range strings.Split(strings.TrimSpace(string(bytes)), "\n") {
+		docs = append(docs, readers.Document{
+			Name: fmt.Sprintf("message-%d", i+1),
+			Text: line,
+			Meta: map[string]string{"subject": line},
+		})
+	}
+
+	return docs, nil
+}
+
 type fakeDocStore struct {
 	ingested     []docstore.IngestedDoc
 	ingestCalls  []docstore.Doc
 	foregetCalls []docstore.IngestedDoc
+	ops          []string
+	failIngest   bool
 }
 
 func (s *fakeDocStore) Ingest(ctx context.Context, doc docstore.Doc) error {
+	if s.failIngest {
+		return errors.New("embedding failed")
+	}
+
 	s.ingested = append(s.ingested, docstore.IngestedDoc{
-		File: doc.File,
-		Crc:  doc.Crc,
+		File:    doc.File,
+		Crc:     doc.Crc,
+		Profile: doc.Profile,
+		Version: strconv.Itoa(len(s.ingestCalls) + 1),
 	})
 	s.ingestCalls = append(s.ingestCalls, doc)
+	s.ops = append(s.ops, "ingest "+doc.File)
 	return nil
 }
 
@@ -52,14 +98,15 @@ func (s *fakeDocStore) Retrieve(ctx context.Context, query string) ([]docstore.S
 
 func (s *fakeDocStore) Forget(ctx context.Context, doc docstore.IngestedDoc) error {
 	s.ingested = slices.DeleteFunc(s.ingested, func(d docstore.IngestedDoc) bool {
-		return d.File == doc.File && d.Crc == doc.Crc
+		return d.File == doc.File && d.Crc == doc.Crc && d.Version == doc.Version
 	})
 	s.foregetCalls = append(s.foregetCalls, doc)
+	s.ops = append(s.ops, "forget "+doc.File)
 	return nil
 }
 
 func (s *fakeDocStore) GetIngested(ctx context.Context) ([]docstore.IngestedDoc, error) {
-	return s.ingested, nil
+	return slices.Clone(s.ingested), nil
 }
 
 func (s *fakeDocStore) getIngestCalls() []string {
@@ -117,10 +164,15 @@ func Test_Sync(t *testing.T) {
 	}
 	reg.RegisterReader(&mockTextReader{})
 
+	ingested := testutil.ToFloat64(metrics.DocumentsIngested.WithLabelValues("mockTextReader"))
+	forgotten := testutil.ToFloat64(metrics.DocumentsForgotten)
+
 	require.NoError(t, reg.Sync(context.Background()))
 
 	assert.ElementsMatch(t, []string{"f1.txt", "f3.pdf"}, store.getIngestCalls())
 	assert.ElementsMatch(t, []string{"f3.pdf", "f4.pdf"}, store.getForgetCalls())
+	assert.Equal(t, ingested+2, testutil.ToFloat64(metrics.DocumentsIngested.WithLabelValues("mockTextReader")))
+	assert.Equal(t, forgotten+2, testutil.ToFloat64(metrics.DocumentsForgotten))
 	chunkifier.AssertExpectations(t)
 }
 
@@ -273,9 +325,10 @@ func Test_ingestNewDocuments(t *testing.T) {
 	}
 
 	expectedDoc := docstore.Doc{
-		File:   "f1.txt",
-		Crc:    12345,
-		Chunks: []string{"f1 content"},
+		File:     "f1.txt",
+		Crc:      12345,
+		MimeType: "text/plain",
+		Chunks:   []docstore.Chunk{{Text: "f1 content"}},
 	}
 	store.On("Ingest", mock.Anything, expectedDoc).Return(nil)
 
@@ -354,3 +407,182 @@ func Test_collectDocuments(t *testing.T) {
 	assert.ElementsMatch(t, files, []string{"f1.txt", "f2.txt", "f3.pdf"})
 	reader.AssertExpectations(t)
 }
+
+func Test_Sync_DocumentReader(t *testing.T) {
+	tmp, err := os.MkdirTemp(os.TempDir(), "test_")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(tmp, "inbox.mbox"), []byte("first\nsecond"), 0o644))
+
+	store := &fakeDocStore{
+		ingested: []docstore.IngestedDoc{
+			{File: "inbox.mbox!/message-1", Crc: crc32.ChecksumIEEE([]byte("first"))},
+			{File: "inbox.mbox!/message-3", Crc: 3},
+		},
+	}
+
+	reg := DocRegistry{
+		log:        slog.New(slog.NewTextHandler(io.Discard, nil)),
+		storer:     store,
+		chunkifier: &DefaultChunkfier{chunkSize: 16},
+		root:       tmp,
+	}
+	reg.RegisterReader(&mockMailboxReader{})
+
+	require.NoError(t, reg.Sync(context.Background()))
+
+	require.Len(t, store.ingestCalls, 1)
+	assert.Equal(t, docstore.Doc{
+		File:     "inbox.mbox!/message-2",
+		Crc:      crc32.ChecksumIEEE([]byte("second")),
+		MimeType: "application/mbox",
+		Meta:     map[string]string{"subject": "second"},
+		Chunks:   []docstore.Chunk{{Text: "second"}},
+	}, store.ingestCalls[0])
+	assert.ElementsMatch(t, []string{"inbox.mbox!/message-3"}, store.getForgetCalls())
+}
+
+func Test_chunkify_Sections(t *testing.T) {
+	reg := DocRegistry{
+		chunkifier: &DefaultChunkfier{chunkSize: 5},
+	}
+
+	chunks := chunkify(reg.chunkifier, readers.Document{
+		Text: "hello\n\nworld!",
+		Sections: []readers.Section{
+			{Location: "slide 1", Text: "hello"},
+			{Location: "slide 2", Text: "world!"},
+		},
+	})
+
+	assert.Equal(t, []docstore.Chunk{
+		{Text: "hello", Location: "slide 1"},
+		{Text: "world", Location: "slide 2"},
+		{Text: "!", Location: "slide 2"},
+	}, chunks)
+}
+
+func Test_chunkify_PackSections(t *testing.T) {
+	reg := DocRegistry{
+		chunkifier: &DefaultChunkfier{chunkSize: 16},
+	}
+
+	chunks := chunkify(reg.chunkifier, readers.Document{
+		Sections: []readers.Section{
+			{Location: "cell 1 (markdown)", Text: "# Title"},
+			{Location: "cell 2 (code)", Text: "x = 1"},
+		},
+		PackSections: true,
+	})
+
+	assert.Equal(t, []docstore.Chunk{
+		{Text: "# Title\n\nx = 1", Location: "cell 1 (markdown) - cell 2 (code)"},
+	}, chunks)
+}
+
+func Test_readDocuments_Normalizes(t *testing.T) {
+	tmp := t.TempDir()
+	unix := filepath.Join(tmp, "unix.txt")
+	windows := filepath.Join(tmp, "windows.txt")
+	require.NoError(t, os.WriteFile(unix, []byte("first line\nsecond line"), 0o644))
+	require.NoError(t, os.WriteFile(windows, []byte("\xef\xbb\xbffirst line\r\nsecond line"), 0o644))
+
+	a, err := readDocuments(&mockTextReader{}, unix, "text/plain")
+	require.NoError(t, err)
+	b, err := readDocuments(&mockTextReader{}, windows, "text/plain")
+	require.NoError(t, err)
+
+	assert.Equal(t, "first line\nsecond line", b[0].Text)
+	assert.Equal(t, a, b)
+}
+
+func Test_replaceFile(t *testing.T) {
+	tmp := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tmp, "f1.txt"), []byte("new f1"), 0o644))
+
+	old := docstore.IngestedDoc{File: "f1.txt", Crc: crc32.ChecksumIEEE([]byte("f1")), Version: "1"}
+	store := &fakeDocStore{ingested: []docstore.IngestedDoc{old}}
+	reg := DocRegistry{
+		log:        slog.New(slog.NewTextHandler(io.Discard, nil)),
+		root:       tmp,
+		storer:     store,
+		chunkifier: &DefaultChunkfier{chunkSize: 16},
+	}
+	reg.RegisterReader(&mockTextReader{})
+
+	require.NoError(t, reg.replaceFile(context.Background(), filepath.Join(tmp, "f1.txt")))
+
+	assert.Equal(t, []string{"ingest f1.txt", "forget f1.txt"}, store.ops)
+	assert.Equal(t, []docstore.IngestedDoc{old}, store.foregetCalls)
+	require.Len(t, store.ingested, 1)
+	assert.Equal(t, crc32.ChecksumIEEE([]byte("new f1")), store.ingested[0].Crc)
+}
+
+func Test_replaceFile_KeepsPreviousVersionOnFailure(t *testing.T) {
+	tmp := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tmp, "f1.txt"), []byte("new f1"), 0o644))
+
+	old := docstore.IngestedDoc{File: "f1.txt", Crc: crc32.ChecksumIEEE([]byte("f1")), Version: "1"}
+	store := &fakeDocStore{ingested: []docstore.IngestedDoc{old}, failIngest: true}
+	reg := DocRegistry{
+		log:        slog.New(slog.NewTextHandler(io.Discard, nil)),
+		root:       tmp,
+		storer:     store,
+		chunkifier: &DefaultChunkfier{chunkSize: 16},
+	}
+	reg.RegisterReader(&mockTextReader{})
+
+	assert.Error(t, reg.replaceFile(context.Background(), filepath.Join(tmp, "f1.txt")))
+
+	assert.Empty(t, store.foregetCalls)
+	assert.Equal(t, []docstore.IngestedDoc{old}, store.ingested)
+}
+
+func Test_ingestDocuments_Traced(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	tmp := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tmp, "f1.txt"), []byte("f1"), 0o644))
+
+	reg := DocRegistry{
+		log:        slog.New(slog.NewTextHandler(io.Discard, nil)),
+		root:       tmp,
+		storer:     &fakeDocStore{},
+		chunkifier: &DefaultChunkfier{chunkSize: 16},
+	}
+	reg.RegisterReader(&mockTextReader{})
+
+	require.NoError(t, reg.ingestDocuments(context.Background(), "f1.txt", []DiskDoc{{File: "f1.txt"}}, dbDocs{}))
+
+	spans := rec.Ended()
+	names := make([]string, 0, len(spans))
+	for _, s := range spans {
+		names = append(names, s.Name())
+	}
+	require.Equal(t, []string{"read", "chunk", "store", "ingest document"}, names)
+
+	root := spans[3].SpanContext()
+	for _, s := range spans[:3] {
+		assert.Equal(t, root.SpanID(), s.Parent().SpanID(), s.Name())
+		assert.Equal(t, root.TraceID(), s.SpanContext().TraceID(), s.Name())
+	}
+}
+
+func Test_ReadAttachment(t *testing.T) {
+	tmp := t.TempDir()
+	path := filepath.Join(tmp, "attachment")
+	require.NoError(t, os.WriteFile(path, []byte("first\nsecond\n"), 0o644))
+
+	reg := DocRegistry{log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	reg.RegisterReader(&mockMailboxReader{})
+
+	text, err := reg.ReadAttachment(path, "inbox.mbox")
+	require.NoError(t, err)
+	assert.Equal(t, "first\n\nsecond", text)
+
+	text, err = reg.ReadAttachment(path, "photo.jpg")
+	require.NoError(t, err)
+	assert.Empty(t, text)
+}
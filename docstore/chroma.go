@@ -2,32 +2,84 @@ package docstore
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	chroma "github.com/amikos-tech/chroma-go/pkg/api/v2"
 	"github.com/amikos-tech/chroma-go/pkg/commons/http"
 	"github.com/amikos-tech/chroma-go/pkg/embeddings"
+	"github.com/gamma-omg/rag-mcp/metrics"
+	"github.com/gamma-omg/rag-mcp/tracing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+// candidatesPerResult is the number of chunks fetched per requested result when
+// chunks are cut from parent sections, so that enough results remain once chunks
+// sharing a parent are deduplicated
+const candidatesPerResult = 4
+
 type ChromaStore struct {
-	results     int
 	requestSize int
-	col         chroma.Collection
+	client      collectionClient
+	name        string
+	ef          embeddings.EmbeddingFunction
+	// parents tells that chunks may be cut from parent sections
+	parents bool
+	log     *slog.Logger
+
+	mu      sync.RWMutex
+	results int
+	// col serves searches, while writes go to target during a rebuild. Each of them
+	// has its own active document versions.
+	col            chroma.Collection
+	target         chroma.Collection
+	versions       versions
+	targetVersions versions
+	lastVersion    int64
+	fingerprint    string
 }
 
 const (
+	collectionName = "documents"
+
 	FilePath = "file_path"
 	FileCrc  = "file_crc"
+	FileMeta = "file_meta"
+	FileMime = "file_mime"
+
+	ChunkLocation = "chunk_location"
+	ChunkProfile  = "chunk_profile"
+	// ChunkParent holds the text of a parent section, it is stored with the first
+	// chunk of the parent only. The other chunks refer to it by ChunkParentID.
+	ChunkParent   = "chunk_parent"
+	ChunkParentID = "chunk_parent_id"
 )
 
+// collectionClient is the part of the Chroma client managing collections
+type collectionClient interface {
+	Heartbeat(ctx context.Context) error
+	CreateCollection(ctx context.Context, name string, options ...chroma.CreateCollectionOption) (chroma.Collection, error)
+	DeleteCollection(ctx context.Context, name string, options ...chroma.DeleteCollectionOption) error
+}
+
 type ChromaStoreConfig struct {
 	BaseURL       string
 	EmbeddingFunc embeddings.EmbeddingFunction
 	Results       int
 	RequestSize   int
-	Reset         bool
+	// ParentChunks tells that documents may be chunked with parent sections
+	ParentChunks bool
+	Reset        bool
+	// Log reports the failures not returned to callers, discarded if nil
+	Log *slog.Logger
 }
 
 func NewChromaStore(ctx context.Context, cfg ChromaStoreConfig) (*ChromaStore, error) {
@@ -50,146 +102,356 @@ func NewChromaStore(ctx context.Context, cfg ChromaStoreConfig) (*ChromaStore, e
 
 	if cfg.Reset {
 		var chromaErr *http.ChromaError
-		if err := client.DeleteCollection(ctx, "documents"); errors.As(err, &chromaErr) {
+		if err := client.DeleteCollection(ctx, collectionName); errors.As(err, &chromaErr) {
 			if chromaErr.ErrorCode != 404 {
 				return nil, fmt.Errorf("failed to delete chroma collection: %w", err)
 			}
 		}
 	}
 
-	col, err := client.GetOrCreateCollection(ctx, "documents", chroma.WithEmbeddingFunctionCreate(cfg.EmbeddingFunc))
+	col, err := client.GetOrCreateCollection(ctx, collectionName, chroma.WithEmbeddingFunctionCreate(cfg.EmbeddingFunc))
 	if err != nil {
 		return nil, fmt.Errorf("failed to get chroma collection: %w", err)
 	}
 
-	return &ChromaStore{
+	ds := &ChromaStore{
 		results:     cfg.Results,
 		requestSize: cfg.RequestSize,
+		client:      client,
+		name:        collectionName,
+		ef:          cfg.EmbeddingFunc,
+		parents:     cfg.ParentChunks,
+		log:         cfg.Log,
 		col:         col,
-	}, nil
+		fingerprint: readFingerprint(col),
+	}
+
+	ds.versions, err = loadVersions(ctx, col)
+	if err != nil {
+		return nil, err
+	}
+
+	return ds, nil
 }
 
+// SetResults changes the number of results returned by searches
+func (ds *ChromaStore) SetResults(n int) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	ds.results = n
+}
+
+// Ping checks the connection to Chroma
+func (ds *ChromaStore) Ping(ctx context.Context) error {
+	return ds.client.Heartbeat(ctx)
+}
+
+// CountChunks returns the number of chunks in the collection serving searches,
+// including the chunks of versions not yet cleaned up
+func (ds *ChromaStore) CountChunks(ctx context.Context) (int, error) {
+	n, err := ds.readCollection().Count(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count chunks: %w", err)
+	}
+
+	return n, nil
+}
+
+// Ingest stores a new version of a document. Searches keep returning the previous
+// version until all chunks of the new one are stored, the previous version is left
+// in place for the caller to Forget.
 func (ds *ChromaStore) Ingest(ctx context.Context, doc Doc) error {
-	var bucket []string
+	col, vs := ds.writeIndex()
+	version := ds.nextVersion()
+	// the parents already stored with one of their chunks
+	parents := make(map[int]struct{})
+
+	var bucket []Chunk
 	size := 0
 	for _, c := range doc.Chunks {
-		chunkSize := len(c)
+		chunkSize := len(c.Text)
 		if size+chunkSize < ds.requestSize {
 			bucket = append(bucket, c)
 			size += chunkSize
 			continue
 		}
 
-		if err := ds.ingestBucket(ctx, bucket, doc); err != nil {
-			rollbackErr := ds.rollback(ctx, doc)
-			if rollbackErr != nil {
-				return fmt.Errorf("failed to ingest bucket %w; and failed to rollback: %v", err, rollbackErr)
-			}
-
-			return fmt.Errorf("failed to ingest bucket: %w", err)
+		if err := ds.ingestBucket(ctx, col, bucket, doc, version, parents); err != nil {
+			return ds.rollback(ctx, col, doc, version, fmt.Errorf("failed to ingest bucket: %w", err))
 		}
 
-		bucket = []string{c}
+		bucket = []Chunk{c}
 		size = chunkSize
 	}
 
-	err := ds.ingestBucket(ctx, bucket, doc)
+	err := ds.ingestBucket(ctx, col, bucket, doc, version, parents)
 	if err != nil {
-		return fmt.Errorf("failed to ingest final bucket: %w", err)
+		return ds.rollback(ctx, col, doc, version, fmt.Errorf("failed to ingest final bucket: %w", err))
 	}
 
+	ds.activate(vs, doc.File, version)
 	return nil
 }
 
-func (ds *ChromaStore) ingestBucket(ctx context.Context, texts []string, doc Doc) error {
-	size := len(texts)
+func (ds *ChromaStore) ingestBucket(ctx context.Context, col chroma.Collection, chunks []Chunk, doc Doc, version string, parents map[int]struct{}) error {
+	attrs := []*chroma.MetaAttribute{
+		chroma.NewStringAttribute(FilePath, doc.File),
+		chroma.NewIntAttribute(FileCrc, int64(doc.Crc)),
+		chroma.NewStringAttribute(FileVersion, version),
+		chroma.NewIntAttribute(FileChunks, int64(len(doc.Chunks))),
+	}
+
+	if doc.Profile != "" {
+		attrs = append(attrs, chroma.NewStringAttribute(ChunkProfile, doc.Profile))
+	}
+
+	if doc.MimeType != "" {
+		attrs = append(attrs, chroma.NewStringAttribute(FileMime, doc.MimeType))
+	}
+
+	if len(doc.Meta) > 0 {
+		meta, err := json.Marshal(doc.Meta)
+		if err != nil {
+			return fmt.Errorf("failed to encode document metadata: %w", err)
+		}
+
+		attrs = append(attrs, chroma.NewStringAttribute(FileMeta, string(meta)))
+	}
+
+	size := len(chunks)
+	texts := make([]string, size)
 	metadatas := make([]chroma.DocumentMetadata, size)
-	for i := range size {
-		metadatas[i] = chroma.NewDocumentMetadata(
-			chroma.NewStringAttribute(FilePath, doc.File),
-			chroma.NewIntAttribute(FileCrc, int64(doc.Crc)),
-		)
+	for i, c := range chunks {
+		texts[i] = c.Text
+		metadatas[i] = chroma.NewDocumentMetadata(attrs...)
+		if c.Location != "" {
+			metadatas[i].SetString(ChunkLocation, c.Location)
+		}
+		if c.Parent == "" {
+			continue
+		}
+
+		metadatas[i].SetString(ChunkParentID, strconv.Itoa(c.ParentID))
+		if _, stored := parents[c.ParentID]; !stored {
+			metadatas[i].SetString(ChunkParent, c.Parent)
+			parents[c.ParentID] = struct{}{}
+		}
 	}
 
-	return ds.col.Add(ctx,
+	return col.Add(ctx,
 		chroma.WithTexts(texts...),
 		chroma.WithIDGenerator(chroma.NewUUIDGenerator()),
 		chroma.WithMetadatas(metadatas...))
 }
 
-func (ds *ChromaStore) rollback(ctx context.Context, doc Doc) error {
-	return ds.col.Delete(ctx, chroma.WithWhereDelete(
-		chroma.And(
-			chroma.EqString(FilePath, doc.File),
-			chroma.EqInt(FileCrc, int(doc.Crc)),
-		)))
+// rollback deletes the chunks of a partially ingested version, the previous
+// version of the document stays searchable
+func (ds *ChromaStore) rollback(ctx context.Context, col chroma.Collection, doc Doc, version string, err error) error {
+	rollbackErr := deleteVersion(ctx, col, IngestedDoc{File: doc.File, Crc: doc.Crc, Version: version})
+	if rollbackErr != nil {
+		return fmt.Errorf("%w; and failed to rollback: %v", err, rollbackErr)
+	}
+
+	return err
 }
 
-func (ds *ChromaStore) Retrieve(ctx context.Context, query string) ([]SearchResult, error) {
-	r, err := ds.col.Query(ctx,
+// Retrieve returns the chunks closest to the query. Chunks cut from a larger parent
+// section are replaced with the parent, each parent is returned once.
+func (ds *ChromaStore) Retrieve(ctx context.Context, query string) (_ []SearchResult, err error) {
+	ctx, span := tracing.Start(ctx, "Retrieve")
+	defer func() { tracing.End(span, err) }()
+
+	ds.mu.RLock()
+	results := ds.results
+	ds.mu.RUnlock()
+
+	candidates := results
+	if ds.parents {
+		candidates *= candidatesPerResult
+	}
+
+	start := time.Now()
+	col := ds.readCollection()
+	qctx, qspan := tracing.Start(ctx, "chroma query",
+		attribute.Int("query.candidates", candidates))
+	r, err := col.Query(qctx,
 		chroma.WithQueryTexts(query),
-		chroma.WithNResults(ds.results),
+		chroma.WithNResults(candidates),
 	)
+	tracing.End(qspan, err)
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve texts: %w", err)
 	}
 
-	res := make([]SearchResult, 0, ds.results)
+	res := make([]SearchResult, 0, results)
+	seen := make(map[parentRef]struct{})
+	// results waiting for the text of their parent, stored with another chunk
+	pending := make(map[parentRef]int)
 	docs := r.GetDocumentsGroups()[0]
 	metadatas := r.GetMetadatasGroups()[0]
 	scores := r.GetDistancesGroups()[0]
-	r.GetDistancesGroups()
-	for i := range len(docs) {
-		doc := docs[i]
+	for i := 0; i < len(docs) && len(res) < results; i++ {
 		file, _ := metadatas[i].GetString(FilePath)
+		if !ds.isActive(file, metadatas[i]) {
+			continue
+		}
+
+		text := docs[i].ContentString()
+
+		if id, ok := metadatas[i].GetString(ChunkParentID); ok {
+			version, _ := metadatas[i].GetString(FileVersion)
+			ref := parentRef{file: file, version: version, id: id}
+			if _, dup := seen[ref]; dup {
+				continue
+			}
+
+			seen[ref] = struct{}{}
+			if parent, ok := metadatas[i].GetString(ChunkParent); ok {
+				text = parent
+			} else {
+				pending[ref] = len(res)
+			}
+		}
+
+		location, _ := metadatas[i].GetString(ChunkLocation)
+		mimeType, _ := metadatas[i].GetString(FileMime)
+
+		var meta map[string]string
+		if raw, ok := metadatas[i].GetString(FileMeta); ok {
+			if err := json.Unmarshal([]byte(raw), &meta); err != nil {
+				return nil, fmt.Errorf("failed to decode metadata of %s: %w", file, err)
+			}
+		}
+
 		res = append(res, SearchResult{
-			Text:  doc.ContentString(),
-			File:  file,
-			Score: float32(scores[i]),
+			Text:     text,
+			File:     file,
+			Location: location,
+			MimeType: mimeType,
+			Meta:     meta,
+			Score:    float32(scores[i]),
 		})
 	}
 
+	if len(pending) > 0 {
+		parents, err := fetchParents(ctx, col, slices.Collect(maps.Keys(pending)))
+		if err != nil {
+			return nil, err
+		}
+
+		for ref, i := range pending {
+			if parent, ok := parents[ref]; ok {
+				res[i].Text = parent
+			}
+		}
+	}
+
+	metrics.SearchDuration.Observe(time.Since(start).Seconds())
+	metrics.SearchResults.Observe(float64(len(res)))
+	span.SetAttributes(attribute.Int("search.results", len(res)))
 	return res, nil
 }
 
+// parentRef identifies a parent section of a version of a document
+type parentRef struct {
+	file    string
+	version string
+	id      string
+}
+
+// fetchParents reads the text of parent sections from the chunks storing them
+func fetchParents(ctx context.Context, col chroma.Collection, refs []parentRef) (map[parentRef]string, error) {
+	clauses := make([]chroma.WhereClause, 0, len(refs))
+	for _, ref := range refs {
+		clauses = append(clauses, chroma.And(
+			chroma.EqString(FilePath, ref.file),
+			chroma.EqString(FileVersion, ref.version),
+			chroma.EqString(ChunkParentID, ref.id),
+		))
+	}
+
+	where := clauses[0]
+	if len(clauses) > 1 {
+		where = chroma.Or(clauses...)
+	}
+
+	r, err := col.Get(ctx, chroma.WithWhereGet(where), chroma.WithIncludeGet(chroma.IncludeMetadatas))
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve parent sections: %w", err)
+	}
+
+	parents := make(map[parentRef]string, len(refs))
+	for _, meta := range r.GetMetadatas() {
+		parent, ok := meta.GetString(ChunkParent)
+		if !ok {
+			continue
+		}
+
+		file, _ := meta.GetString(FilePath)
+		version, _ := meta.GetString(FileVersion)
+		id, _ := meta.GetString(ChunkParentID)
+		parents[parentRef{file: file, version: version, id: id}] = parent
+	}
+
+	return parents, nil
+}
+
+// Forget deletes one version of a document
 func (ds *ChromaStore) Forget(ctx context.Context, doc IngestedDoc) error {
-	err := ds.col.Delete(ctx, chroma.WithWhereDelete(
-		chroma.And(
-			chroma.EqString(FilePath, doc.File),
-			chroma.EqInt(FileCrc, int(doc.Crc)),
-		)))
+	col, vs := ds.writeIndex()
+	err := deleteVersion(ctx, col, doc)
 	if err != nil {
 		return fmt.Errorf("failed to forget doc %s: %w", doc.File, err)
 	}
 
+	ds.deactivate(vs, doc.File, doc.Version)
 	return nil
 }
 
+// GetIngested returns the latest completely ingested version of each document
 func (ds *ChromaStore) GetIngested(ctx context.Context) ([]IngestedDoc, error) {
-	res, err := ds.col.Get(ctx, chroma.WithIncludeGet(chroma.IncludeMetadatas))
+	col, _ := ds.writeIndex()
+	stored, err := scanVersions(ctx, col)
 	if err != nil {
 		return nil, err
 	}
 
 	var docs []IngestedDoc
-	seen := make(map[IngestedDoc]struct{})
-	metadata := res.GetMetadatas()
-
-	for _, meta := range metadata {
-		path, _ := meta.GetString(FilePath)
-		crc, _ := meta.GetFloat(FileCrc) // for some reason file crc gets stored as float64 in Chroma
-		doc := IngestedDoc{
-			File: path,
-			Crc:  uint32(crc),
+	for _, versions := range stored {
+		if latest, ok := latestVersion(versions); ok {
+			docs = append(docs, latest.doc)
 		}
+	}
 
-		if _, ok := seen[doc]; ok {
-			continue
-		}
+	slices.SortFunc(docs, func(a, b IngestedDoc) int {
+		return strings.Compare(a.File, b.File)
+	})
+
+	return docs, nil
+}
+
+// readCollection returns the collection serving searches
+func (ds *ChromaStore) readCollection() chroma.Collection {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
 
-		seen[doc] = struct{}{}
-		docs = append(docs, doc)
+	return ds.col
+}
+
+// writeIndex returns the collection receiving documents along with its active
+// versions, which is the shadow collection while a rebuild is in progress
+func (ds *ChromaStore) writeIndex() (chroma.Collection, versions) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	if ds.target != nil {
+		return ds.target, ds.targetVersions
 	}
 
-	return docs, nil
+	if ds.versions == nil {
+		ds.versions = make(versions)
+	}
+
+	return ds.col, ds.versions
 }
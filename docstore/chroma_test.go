@@ -2,6 +2,7 @@ package docstore
 
 import (
 	"context"
+	"errors"
 	"testing"
 
 	chroma "github.com/amikos-tech/chroma-go/pkg/api/v2"
@@ -22,7 +23,7 @@ func Test_Ingest(t *testing.T) {
 	doc := Doc{
 		File:   "facts.pdf",
 		Crc:    12345,
-		Chunks: []string{"Bananas are berries, but strawberries aren't."},
+		Chunks: []Chunk{{Text: "Bananas are berries, but strawberries aren't."}},
 	}
 
 	col.EXPECT().Add(mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
@@ -40,9 +41,12 @@ func Test_Ingest_SplitsToBuckets(t *testing.T) {
 	}
 
 	doc := Doc{
-		File:   "facts.pdf",
-		Crc:    12345,
-		Chunks: []string{"Bananas", "are", "berries", "but", "strawberries", "aren't"},
+		File: "facts.pdf",
+		Crc:  12345,
+		Chunks: []Chunk{
+			{Text: "Bananas"}, {Text: "are"}, {Text: "berries"},
+			{Text: "but"}, {Text: "strawberries"}, {Text: "aren't"},
+		},
 	}
 
 	col.EXPECT().Add(mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil).Times(4)
@@ -69,6 +73,10 @@ func Test_Retrieve(t *testing.T) {
 
 	meta := new(mocks.MockDocumentMetadata)
 	meta.EXPECT().GetString(FilePath).Return(sr.File, true)
+	meta.EXPECT().GetString(ChunkParentID).Return("", false)
+	meta.EXPECT().GetString(ChunkLocation).Return("", false)
+	meta.EXPECT().GetString(FileMime).Return("", false)
+	meta.EXPECT().GetString(FileMeta).Return("", false)
 
 	qr := new(mocks.MockQueryResult)
 	qr.EXPECT().GetMetadatasGroups().Return([]chroma.DocumentMetadatas{{meta}})
@@ -82,6 +90,167 @@ func Test_Retrieve(t *testing.T) {
 	col.AssertExpectations(t)
 }
 
+func Test_Retrieve_Metadata(t *testing.T) {
+	col := new(mocks.MockCollection)
+	store := ChromaStore{
+		results: 1,
+		col:     col,
+	}
+
+	sr := SearchResult{
+		Text:     "Quarterly numbers attached.",
+		File:     "mail/inbox.mbox!/message-1",
+		Location: "slide 3",
+		MimeType: "message/rfc822",
+		Meta:     map[string]string{"subject": "Q3 report"},
+		Score:    0.5,
+	}
+
+	doc := new(mocks.MockDocument)
+	doc.EXPECT().ContentString().Return(sr.Text)
+
+	meta := new(mocks.MockDocumentMetadata)
+	meta.EXPECT().GetString(FilePath).Return(sr.File, true)
+	meta.EXPECT().GetString(ChunkParentID).Return("", false)
+	meta.EXPECT().GetString(ChunkLocation).Return("slide 3", true)
+	meta.EXPECT().GetString(FileMime).Return("message/rfc822", true)
+	meta.EXPECT().GetString(FileMeta).Return(`{"subject":"Q3 report"}`, true)
+
+	qr := new(mocks.MockQueryResult)
+	qr.EXPECT().GetMetadatasGroups().Return([]chroma.DocumentMetadatas{{meta}})
+	qr.EXPECT().GetDistancesGroups().Return([]embeddings.Distances{{embeddings.Distance(0.5)}})
+	qr.EXPECT().GetDocumentsGroups().Return([]chroma.Documents{{doc}})
+	col.EXPECT().Query(mock.Anything, mock.Anything, mock.Anything).Return(qr, nil)
+
+	res, err := store.Retrieve(context.Background(), "quarterly report")
+	require.NoError(t, err)
+	assert.Equal(t, []SearchResult{sr}, res)
+	col.AssertExpectations(t)
+}
+
+func Test_Ingest_StoresParentsOnce(t *testing.T) {
+	col := new(mocks.MockCollection)
+	store := ChromaStore{
+		results:     1,
+		requestSize: 10,
+		col:         col,
+	}
+
+	var added []chroma.DocumentMetadata
+	col.EXPECT().Add(mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Run(func(ctx context.Context, opts ...chroma.CollectionUpdateOption) {
+			op, err := chroma.NewCollectionUpdateOp(opts...)
+			require.NoError(t, err)
+			added = append(added, op.Metadatas...)
+		}).Return(nil)
+
+	venus := "A day on Venus is longer than its year."
+	require.NoError(t, store.Ingest(context.Background(), Doc{
+		File: "facts.txt",
+		Chunks: []Chunk{
+			{Text: "Venus day", Parent: venus, ParentID: 0},
+			{Text: "its year", Parent: venus, ParentID: 0},
+			{Text: "Mars", Parent: "Mars has two moons.", ParentID: 1},
+		},
+	}))
+
+	require.Len(t, added, 3)
+	var parents []string
+	for _, meta := range added {
+		_, ok := meta.GetString(ChunkParentID)
+		assert.True(t, ok)
+		if parent, ok := meta.GetString(ChunkParent); ok {
+			parents = append(parents, parent)
+		}
+	}
+	assert.Equal(t, []string{venus, "Mars has two moons."}, parents)
+}
+
+func Test_Retrieve_Parents(t *testing.T) {
+	col := new(mocks.MockCollection)
+	store := ChromaStore{
+		results: 2,
+		parents: true,
+		col:     col,
+	}
+
+	chunk := func(text, file, parent, parentID string) (*mocks.MockDocument, *mocks.MockDocumentMetadata) {
+		doc := new(mocks.MockDocument)
+		doc.EXPECT().ContentString().Return(text)
+
+		meta := new(mocks.MockDocumentMetadata)
+		meta.EXPECT().GetString(FilePath).Return(file, true)
+		meta.EXPECT().GetString(FileVersion).Return("1", true).Maybe()
+		meta.EXPECT().GetString(ChunkParent).Return(parent, parent != "").Maybe()
+		meta.EXPECT().GetString(ChunkParentID).Return(parentID, parentID != "")
+		meta.EXPECT().GetString(ChunkLocation).Return("", false).Maybe()
+		meta.EXPECT().GetString(FileMime).Return("", false).Maybe()
+		meta.EXPECT().GetString(FileMeta).Return("", false).Maybe()
+		return doc, meta
+	}
+
+	// the parent of the third chunk is stored with another chunk
+	doc1, meta1 := chunk("Venus day", "facts.txt", "A day on Venus is longer than its year.", "0")
+	doc2, meta2 := chunk("its year", "facts.txt", "", "0")
+	doc3, meta3 := chunk("two moons", "facts.txt", "", "1")
+	doc4, meta4 := chunk("Jupiter", "facts.txt", "", "")
+
+	qr := new(mocks.MockQueryResult)
+	qr.EXPECT().GetMetadatasGroups().Return([]chroma.DocumentMetadatas{{meta1, meta2, meta3, meta4}})
+	qr.EXPECT().GetDistancesGroups().Return([]embeddings.Distances{{0.1, 0.2, 0.3, 0.4}})
+	qr.EXPECT().GetDocumentsGroups().Return([]chroma.Documents{{doc1, doc2, doc3, doc4}})
+	col.EXPECT().Query(mock.Anything, mock.Anything, mock.Anything).
+		Run(func(ctx context.Context, opts ...chroma.CollectionQueryOption) {
+			op, err := chroma.NewCollectionQueryOp(opts...)
+			require.NoError(t, err)
+			assert.Equal(t, 2*candidatesPerResult, op.NResults)
+		}).Return(qr, nil)
+
+	holder := chroma.NewDocumentMetadata(
+		chroma.NewStringAttribute(FilePath, "facts.txt"),
+		chroma.NewStringAttribute(FileVersion, "1"),
+		chroma.NewStringAttribute(ChunkParentID, "1"),
+		chroma.NewStringAttribute(ChunkParent, "Mars has two moons."),
+	)
+	sibling := chroma.NewDocumentMetadata(
+		chroma.NewStringAttribute(FilePath, "facts.txt"),
+		chroma.NewStringAttribute(FileVersion, "1"),
+		chroma.NewStringAttribute(ChunkParentID, "1"),
+	)
+	col.EXPECT().Get(mock.Anything, mock.Anything, mock.Anything).Return(getResult(nil, sibling, holder), nil)
+
+	res, err := store.Retrieve(context.Background(), "venus")
+	require.NoError(t, err)
+	assert.Equal(t, []SearchResult{
+		{Text: "A day on Venus is longer than its year.", File: "facts.txt", Score: 0.1},
+		{Text: "Mars has two moons.", File: "facts.txt", Score: 0.3},
+	}, res)
+	col.AssertExpectations(t)
+}
+
+func Test_Retrieve_NoParents(t *testing.T) {
+	col := new(mocks.MockCollection)
+	store := ChromaStore{
+		results: 3,
+		col:     col,
+	}
+
+	qr := new(mocks.MockQueryResult)
+	qr.EXPECT().GetMetadatasGroups().Return([]chroma.DocumentMetadatas{{}})
+	qr.EXPECT().GetDistancesGroups().Return([]embeddings.Distances{{}})
+	qr.EXPECT().GetDocumentsGroups().Return([]chroma.Documents{{}})
+	col.EXPECT().Query(mock.Anything, mock.Anything, mock.Anything).
+		Run(func(ctx context.Context, opts ...chroma.CollectionQueryOption) {
+			op, err := chroma.NewCollectionQueryOp(opts...)
+			require.NoError(t, err)
+			assert.Equal(t, 3, op.NResults)
+		}).Return(qr, nil)
+
+	res, err := store.Retrieve(context.Background(), "venus")
+	require.NoError(t, err)
+	assert.Empty(t, res)
+}
+
 func Test_Forget(t *testing.T) {
 	col := new(mocks.MockCollection)
 	store := ChromaStore{
@@ -90,8 +259,9 @@ func Test_Forget(t *testing.T) {
 	}
 
 	doc := IngestedDoc{
-		File: "f1.txt",
-		Crc:  123,
+		File:    "f1.txt",
+		Crc:     123,
+		Version: "1700000000000000",
 	}
 	col.EXPECT().Delete(mock.Anything, mock.Anything).Return(nil)
 
@@ -108,6 +278,9 @@ func Test_GetIngestedDocs(t *testing.T) {
 	meta := new(mocks.MockDocumentMetadata)
 	meta.EXPECT().GetString(FilePath).Return("facts.pdf", true)
 	meta.EXPECT().GetFloat(FileCrc).Return(float64(12345), true)
+	meta.EXPECT().GetString(ChunkProfile).Return("code@1a2b3c4d", true)
+	meta.EXPECT().GetString(FileVersion).Return("1700000000000000", true)
+	meta.EXPECT().GetFloat(FileChunks).Return(float64(1), true)
 
 	get := new(mocks.MockGetResult)
 	get.EXPECT().GetMetadatas().Return(chroma.DocumentMetadatas{meta})
@@ -116,6 +289,25 @@ func Test_GetIngestedDocs(t *testing.T) {
 
 	ingested, err := store.GetIngested(context.Background())
 	require.NoError(t, err)
-	assert.Equal(t, ingested, []IngestedDoc{{File: "facts.pdf", Crc: 12345}})
+	assert.Equal(t, ingested, []IngestedDoc{{File: "facts.pdf", Crc: 12345, Profile: "code@1a2b3c4d", Version: "1700000000000000"}})
 	col.AssertExpectations(t)
 }
+
+func Test_Ping(t *testing.T) {
+	client := &fakeCollectionClient{heartbeatErr: errors.New("connection refused")}
+	store := ChromaStore{client: client}
+	assert.Error(t, store.Ping(context.Background()))
+
+	client.heartbeatErr = nil
+	assert.NoError(t, store.Ping(context.Background()))
+}
+
+func Test_CountChunks(t *testing.T) {
+	col := new(mocks.MockCollection)
+	col.EXPECT().Count(mock.Anything).Return(42, nil)
+
+	store := ChromaStore{col: col}
+	n, err := store.CountChunks(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 42, n)
+}
@@ -0,0 +1,340 @@
+package docstore
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	chroma "github.com/amikos-tech/chroma-go/pkg/api/v2"
+	"github.com/amikos-tech/chroma-go/pkg/embeddings"
+)
+
+const (
+	exportFormat  = "rag-mcp-index"
+	exportVersion = 1
+	// exportPageSize is the number of chunks fetched from or added to Chroma at once
+	exportPageSize = 256
+	// maxExportLine bounds the size of a single exported chunk
+	maxExportLine = 64 << 20
+)
+
+// ExportHeader is the first line of an export, describing the index it was taken from
+type ExportHeader struct {
+	Format      string    `json:"format"`
+	Version     int       `json:"version"`
+	Fingerprint string    `json:"fingerprint"`
+	Chunks      int       `json:"chunks"`
+	Exported    time.Time `json:"exported"`
+}
+
+// ExportRecord is a chunk of an export along with its vector
+type ExportRecord struct {
+	ID        string         `json:"id"`
+	Text      string         `json:"text"`
+	Embedding []float32      `json:"embedding"`
+	Metadata  map[string]any `json:"metadata"`
+}
+
+// exportFooter is the last line of an export, so that truncated files are detected
+type exportFooter struct {
+	End    bool `json:"end"`
+	Chunks int  `json:"chunks"`
+}
+
+// Export writes all chunks of the index serving searches to w as JSON lines: a
+// header, one line per chunk, and a footer with the number of chunks written
+func (ds *ChromaStore) Export(ctx context.Context, w io.Writer) (int, error) {
+	col := ds.readCollection()
+	count, err := col.Count(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count chunks: %w", err)
+	}
+
+	enc := json.NewEncoder(w)
+	err = enc.Encode(ExportHeader{
+		Format:      exportFormat,
+		Version:     exportVersion,
+		Fingerprint: ds.Fingerprint(),
+		Chunks:      count,
+		Exported:    time.Now().UTC(),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to write export header: %w", err)
+	}
+
+	written := 0
+	for offset := 0; ; offset += exportPageSize {
+		page, err := col.Get(ctx,
+			chroma.WithLimitGet(exportPageSize),
+			chroma.WithOffsetGet(offset),
+			chroma.WithIncludeGet(chroma.IncludeDocuments, chroma.IncludeMetadatas, chroma.IncludeEmbeddings),
+		)
+		if err != nil {
+			return written, fmt.Errorf("failed to read chunks: %w", err)
+		}
+
+		ids, docs, metas, embs := page.GetIDs(), page.GetDocuments(), page.GetMetadatas(), page.GetEmbeddings()
+		if len(docs) != len(ids) || len(metas) != len(ids) || len(embs) != len(ids) {
+			return written, errors.New("chroma returned incomplete chunks")
+		}
+
+		for i, id := range ids {
+			rec, err := exportRecord(id, docs[i], metas[i], embs[i])
+			if err != nil {
+				return written, err
+			}
+			if err := enc.Encode(rec); err != nil {
+				return written, fmt.Errorf("failed to write chunk %s: %w", id, err)
+			}
+			written++
+		}
+
+		if len(ids) < exportPageSize {
+			break
+		}
+	}
+
+	if err := enc.Encode(exportFooter{End: true, Chunks: written}); err != nil {
+		return written, fmt.Errorf("failed to write export footer: %w", err)
+	}
+
+	return written, nil
+}
+
+func exportRecord(id chroma.DocumentID, doc chroma.Document, meta chroma.DocumentMetadata, emb embeddings.Embedding) (ExportRecord, error) {
+	rec := ExportRecord{
+		ID:        string(id),
+		Embedding: emb.ContentAsFloat32(),
+		Metadata:  map[string]any{},
+	}
+	if doc != nil {
+		rec.Text = doc.ContentString()
+	}
+
+	if meta != nil {
+		raw, err := json.Marshal(meta)
+		if err != nil {
+			return ExportRecord{}, fmt.Errorf("failed to encode metadata of chunk %s: %w", id, err)
+		}
+		if err := json.Unmarshal(raw, &rec.Metadata); err != nil {
+			return ExportRecord{}, fmt.Errorf("failed to encode metadata of chunk %s: %w", id, err)
+		}
+	}
+
+	return rec, nil
+}
+
+// Import replaces the index with the chunks exported to r, keeping their vectors.
+// accept validates the header before anything is written. Chunks are written to a
+// shadow collection swapped in once the whole export is read and validated, so a
+// failed import leaves the current index untouched.
+func (ds *ChromaStore) Import(ctx context.Context, r io.Reader, accept func(ExportHeader) error) (n int, err error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64<<10), maxExportLine)
+
+	header, err := readExportHeader(sc)
+	if err != nil {
+		return 0, err
+	}
+	if err := accept(header); err != nil {
+		return 0, err
+	}
+
+	if err := ds.BeginRebuild(ctx); err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			if abortErr := ds.AbortRebuild(context.WithoutCancel(ctx)); abortErr != nil {
+				err = errors.Join(err, fmt.Errorf("failed to drop partial import: %w", abortErr))
+			}
+		}
+	}()
+
+	col, _ := ds.writeIndex()
+	v := importValidator{ids: make(map[string]struct{})}
+	var batch []ExportRecord
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := addRecords(ctx, col, batch); err != nil {
+			return err
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	var footer *exportFooter
+	for sc.Scan() {
+		line := sc.Bytes()
+		if footer != nil {
+			return n, errors.New("invalid export: data after the footer")
+		}
+
+		if f, ok := parseFooter(line); ok {
+			footer = &f
+			continue
+		}
+
+		var rec ExportRecord
+		dec := json.NewDecoder(bytes.NewReader(line))
+		dec.UseNumber()
+		if err := dec.Decode(&rec); err != nil {
+			return n, fmt.Errorf("invalid export: chunk %d: %w", n+1, err)
+		}
+		if err := v.validate(rec); err != nil {
+			return n, fmt.Errorf("invalid export: chunk %d: %w", n+1, err)
+		}
+
+		batch = append(batch, rec)
+		n++
+		if len(batch) == exportPageSize {
+			if err := flush(); err != nil {
+				return n, err
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return n, fmt.Errorf("failed to read export: %w", err)
+	}
+
+	if footer == nil {
+		return n, errors.New("invalid export: the file is truncated")
+	}
+	if footer.Chunks != n {
+		return n, fmt.Errorf("invalid export: %d chunks read, the footer lists %d", n, footer.Chunks)
+	}
+	if err := flush(); err != nil {
+		return n, err
+	}
+
+	vs, err := loadVersions(ctx, col)
+	if err != nil {
+		return n, err
+	}
+
+	ds.mu.Lock()
+	ds.targetVersions = vs
+	ds.mu.Unlock()
+
+	return n, ds.CommitRebuild(ctx, header.Fingerprint)
+}
+
+func readExportHeader(sc *bufio.Scanner) (ExportHeader, error) {
+	if !sc.Scan() {
+		if err := sc.Err(); err != nil {
+			return ExportHeader{}, fmt.Errorf("failed to read export: %w", err)
+		}
+		return ExportHeader{}, errors.New("invalid export: the file is empty")
+	}
+
+	var h ExportHeader
+	if err := json.Unmarshal(sc.Bytes(), &h); err != nil {
+		return ExportHeader{}, fmt.Errorf("invalid export header: %w", err)
+	}
+	if h.Format != exportFormat {
+		return ExportHeader{}, fmt.Errorf("invalid export: unknown format %q", h.Format)
+	}
+	if h.Version != exportVersion {
+		return ExportHeader{}, fmt.Errorf("invalid export: unsupported version %d", h.Version)
+	}
+
+	return h, nil
+}
+
+func parseFooter(line []byte) (exportFooter, bool) {
+	var f exportFooter
+	if err := json.Unmarshal(line, &f); err != nil || !f.End {
+		return exportFooter{}, false
+	}
+
+	return f, true
+}
+
+// importValidator checks that chunks are well formed, have unique ids and vectors
+// of a single dimension
+type importValidator struct {
+	ids       map[string]struct{}
+	dimension int
+}
+
+func (v *importValidator) validate(rec ExportRecord) error {
+	if rec.ID == "" {
+		return errors.New("missing id")
+	}
+	if _, dup := v.ids[rec.ID]; dup {
+		return fmt.Errorf("duplicate id %s", rec.ID)
+	}
+	v.ids[rec.ID] = struct{}{}
+
+	if len(rec.Embedding) == 0 {
+		return fmt.Errorf("chunk %s has no embedding", rec.ID)
+	}
+	if v.dimension == 0 {
+		v.dimension = len(rec.Embedding)
+	}
+	if len(rec.Embedding) != v.dimension {
+		return fmt.Errorf("chunk %s has an embedding of dimension %d instead of %d", rec.ID, len(rec.Embedding), v.dimension)
+	}
+
+	if file, _ := rec.Metadata[FilePath].(string); strings.TrimSpace(file) == "" {
+		return fmt.Errorf("chunk %s has no %s metadata", rec.ID, FilePath)
+	}
+
+	return nil
+}
+
+func addRecords(ctx context.Context, col chroma.Collection, recs []ExportRecord) error {
+	ids := make([]chroma.DocumentID, 0, len(recs))
+	texts := make([]string, 0, len(recs))
+	embs := make([]embeddings.Embedding, 0, len(recs))
+	metas := make([]chroma.DocumentMetadata, 0, len(recs))
+	for _, rec := range recs {
+		meta, err := importMetadata(rec.Metadata)
+		if err != nil {
+			return fmt.Errorf("invalid metadata of chunk %s: %w", rec.ID, err)
+		}
+
+		ids = append(ids, chroma.DocumentID(rec.ID))
+		texts = append(texts, rec.Text)
+		embs = append(embs, embeddings.NewEmbeddingFromFloat32(rec.Embedding))
+		metas = append(metas, meta)
+	}
+
+	err := col.Add(ctx,
+		chroma.WithIDs(ids...),
+		chroma.WithTexts(texts...),
+		chroma.WithEmbeddings(embs...),
+		chroma.WithMetadatas(metas...),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to store imported chunks: %w", err)
+	}
+
+	return nil
+}
+
+// importMetadata restores metadata decoded with json.Number. Numbers are restored as
+// floats, the way Chroma returns them and the store reads them back.
+func importMetadata(m map[string]any) (chroma.DocumentMetadata, error) {
+	values := make(map[string]any, len(m))
+	for k, v := range m {
+		if num, ok := v.(json.Number); ok {
+			f, err := num.Float64()
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", k, err)
+			}
+			v = f
+		}
+		values[k] = v
+	}
+
+	return chroma.NewDocumentMetadataFromMap(values)
+}
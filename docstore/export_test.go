@@ -0,0 +1,169 @@
+package docstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	chroma "github.com/amikos-tech/chroma-go/pkg/api/v2"
+	"github.com/amikos-tech/chroma-go/pkg/embeddings"
+	mocks "github.com/gamma-omg/rag-mcp/mocks/chroma"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func exportedChunks() *chroma.GetResultImpl {
+	return &chroma.GetResultImpl{
+		Ids: chroma.DocumentIDs{"a-1", "a-2"},
+		Documents: chroma.Documents{
+			chroma.NewTextDocument("first chunk"),
+			chroma.NewTextDocument("second chunk"),
+		},
+		Metadatas: chroma.DocumentMetadatas{
+			chunkMeta("a.txt", "1", 7, 2),
+			chunkMeta("a.txt", "1", 7, 2),
+		},
+		Embeddings: embeddings.Embeddings{
+			embeddings.NewEmbeddingFromFloat32([]float32{0.1, 0.2}),
+			embeddings.NewEmbeddingFromFloat32([]float32{0.3, 0.4}),
+		},
+	}
+}
+
+func exportLines(t *testing.T, lines ...any) *bytes.Buffer {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, l := range lines {
+		require.NoError(t, enc.Encode(l))
+	}
+	return &buf
+}
+
+func acceptAll(ExportHeader) error {
+	return nil
+}
+
+func Test_Export_Import(t *testing.T) {
+	active := new(mocks.MockCollection)
+	active.EXPECT().Count(mock.Anything).Return(2, nil)
+	active.EXPECT().Get(mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(exportedChunks(), nil)
+
+	source := ChromaStore{col: active, fingerprint: "v1"}
+	var buf bytes.Buffer
+	n, err := source.Export(context.Background(), &buf)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	var added *chroma.CollectionUpdateOp
+	shadow := new(mocks.MockCollection)
+	shadow.EXPECT().Add(mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Run(func(ctx context.Context, opts ...chroma.CollectionUpdateOption) {
+			added, err = chroma.NewCollectionUpdateOp(opts...)
+			require.NoError(t, err)
+		}).Return(nil)
+	shadow.EXPECT().Get(mock.Anything, mock.Anything).Return(getResult(nil,
+		chunkMeta("a.txt", "1", 7, 2),
+		chunkMeta("a.txt", "1", 7, 2),
+	), nil)
+	shadow.EXPECT().Metadata().Return(nil)
+	shadow.EXPECT().ModifyMetadata(mock.Anything, fingerprintOf("v1")).Return(nil)
+	shadow.EXPECT().ModifyName(mock.Anything, "documents").Return(nil)
+
+	old := new(mocks.MockCollection)
+	old.EXPECT().ModifyName(mock.Anything, "documents_retired").Return(nil)
+	target := ChromaStore{client: &fakeCollectionClient{col: shadow}, name: "documents", col: old}
+
+	var header ExportHeader
+	n, err = target.Import(context.Background(), &buf, func(h ExportHeader) error {
+		header = h
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, "v1", header.Fingerprint)
+	assert.Equal(t, 2, header.Chunks)
+
+	require.NotNil(t, added)
+	assert.Equal(t, []chroma.DocumentID{"a-1", "a-2"}, added.Ids)
+	assert.Equal(t, "second chunk", added.Documents[1].ContentString())
+	assert.Equal(t, []float32{0.3, 0.4}, added.Embeddings[1].ContentAsFloat32())
+	crc, ok := added.Metadatas[0].GetFloat(FileCrc)
+	assert.True(t, ok)
+	assert.Equal(t, float64(7), crc)
+
+	assert.Same(t, shadow, target.readCollection())
+	assert.Equal(t, "v1", target.Fingerprint())
+	assert.Equal(t, versions{"a.txt": "1"}, target.versions)
+	shadow.AssertExpectations(t)
+	old.AssertExpectations(t)
+}
+
+func Test_Import_Invalid(t *testing.T) {
+	header := ExportHeader{Format: exportFormat, Version: exportVersion, Fingerprint: "v1", Chunks: 2}
+	chunk := func(id string, emb ...float32) ExportRecord {
+		return ExportRecord{ID: id, Text: id, Embedding: emb, Metadata: map[string]any{FilePath: "a.txt"}}
+	}
+
+	tests := []struct {
+		name   string
+		export *bytes.Buffer
+		accept func(ExportHeader) error
+		err    string
+	}{
+		{
+			name:   "unknown format",
+			export: exportLines(t, ExportHeader{Format: "csv", Version: exportVersion}),
+			err:    "unknown format",
+		},
+		{
+			name:   "rejected",
+			export: exportLines(t, header),
+			accept: func(ExportHeader) error { return errors.New("fingerprint mismatch") },
+			err:    "fingerprint mismatch",
+		},
+		{
+			name:   "truncated",
+			export: exportLines(t, header, chunk("a-1", 1, 2)),
+			err:    "truncated",
+		},
+		{
+			name:   "duplicate id",
+			export: exportLines(t, header, chunk("a-1", 1, 2), chunk("a-1", 1, 2)),
+			err:    "duplicate id",
+		},
+		{
+			name:   "dimension mismatch",
+			export: exportLines(t, header, chunk("a-1", 1, 2), chunk("a-2", 1, 2, 3)),
+			err:    "dimension",
+		},
+		{
+			name:   "count mismatch",
+			export: exportLines(t, header, chunk("a-1", 1, 2), exportFooter{End: true, Chunks: 2}),
+			err:    "footer lists 2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			active := new(mocks.MockCollection)
+			shadow := new(mocks.MockCollection)
+			shadow.EXPECT().Name().Return("documents_shadow").Maybe()
+			client := &fakeCollectionClient{col: shadow}
+			store := ChromaStore{client: client, name: "documents", col: active, fingerprint: "v0"}
+
+			accept := tt.accept
+			if accept == nil {
+				accept = acceptAll
+			}
+
+			_, err := store.Import(context.Background(), tt.export, accept)
+			assert.ErrorContains(t, err, tt.err)
+			assert.Same(t, active, store.readCollection())
+			assert.Equal(t, "v0", store.Fingerprint())
+			shadow.AssertNotCalled(t, "Add")
+		})
+	}
+}
@@ -1,18 +1,37 @@
 package docstore
 
 type Doc struct {
-	File   string
-	Crc    uint32
-	Chunks []string
+	File     string
+	Crc      uint32
+	MimeType string
+	Profile  string
+	Meta     map[string]string
+	Chunks   []Chunk
+}
+
+type Chunk struct {
+	Text     string
+	Location string
+	// Parent is the larger section the chunk was cut from, returned by searches
+	// matching the chunk. ParentID tells apart the parents of a document.
+	Parent   string
+	ParentID int
 }
 
 type SearchResult struct {
-	Text  string
-	File  string
-	Score float32
+	Text     string
+	File     string
+	Location string
+	MimeType string
+	Meta     map[string]string
+	Score    float32
 }
 
 type IngestedDoc struct {
-	File string
-	Crc  uint32
+	File    string
+	Crc     uint32
+	Profile string
+	// Version tells apart successive ingestions of the document, empty for
+	// documents ingested before versions were recorded
+	Version string
 }
@@ -0,0 +1,193 @@
+package docstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	chroma "github.com/amikos-tech/chroma-go/pkg/api/v2"
+	"github.com/amikos-tech/chroma-go/pkg/commons/http"
+)
+
+const (
+	// IndexFingerprint is the collection metadata key recording the embedding and
+	// chunking configuration the index was built with
+	IndexFingerprint = "index_fingerprint"
+
+	shadowSuffix  = "_shadow"
+	retiredSuffix = "_retired"
+)
+
+var errNoRebuild = errors.New("no rebuild in progress")
+
+// Fingerprint returns the configuration fingerprint of the index serving searches,
+// empty for indexes built before fingerprints were recorded
+func (ds *ChromaStore) Fingerprint() string {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	return ds.fingerprint
+}
+
+// SetFingerprint records the configuration fingerprint of the index
+func (ds *ChromaStore) SetFingerprint(ctx context.Context, fingerprint string) error {
+	col := ds.readCollection()
+	if err := writeFingerprint(ctx, col, fingerprint); err != nil {
+		return err
+	}
+
+	ds.mu.Lock()
+	ds.fingerprint = fingerprint
+	ds.mu.Unlock()
+
+	return nil
+}
+
+// ResetIndex replaces the collection serving searches with an empty one. The
+// collection is recreated rather than emptied, as Chroma fixes the dimensionality
+// of the vectors of a collection once it holds some.
+func (ds *ChromaStore) ResetIndex(ctx context.Context) error {
+	if err := ds.deleteCollection(ctx, ds.name); err != nil {
+		return fmt.Errorf("failed to delete collection: %w", err)
+	}
+
+	col, err := ds.client.CreateCollection(ctx, ds.name, chroma.WithEmbeddingFunctionCreate(ds.ef))
+	if err != nil {
+		return fmt.Errorf("failed to create collection: %w", err)
+	}
+
+	ds.mu.Lock()
+	ds.col = col
+	ds.versions = make(versions)
+	ds.fingerprint = ""
+	ds.mu.Unlock()
+
+	return nil
+}
+
+// BeginRebuild creates an empty shadow collection receiving all writes, while
+// searches are still served by the current collection
+func (ds *ChromaStore) BeginRebuild(ctx context.Context) error {
+	shadow := ds.name + shadowSuffix
+	if err := ds.deleteCollection(ctx, shadow); err != nil {
+		return fmt.Errorf("failed to remove stale shadow collection: %w", err)
+	}
+
+	col, err := ds.client.CreateCollection(ctx, shadow, chroma.WithEmbeddingFunctionCreate(ds.ef))
+	if err != nil {
+		return fmt.Errorf("failed to create shadow collection: %w", err)
+	}
+
+	ds.mu.Lock()
+	ds.target = col
+	ds.targetVersions = make(versions)
+	ds.mu.Unlock()
+
+	return nil
+}
+
+// CommitRebuild switches searches to the shadow collection and deletes the old one.
+// On failure the current collection keeps serving searches under its name.
+func (ds *ChromaStore) CommitRebuild(ctx context.Context, fingerprint string) error {
+	ds.mu.RLock()
+	old, shadow := ds.col, ds.target
+	ds.mu.RUnlock()
+
+	if shadow == nil {
+		return errNoRebuild
+	}
+
+	if err := writeFingerprint(ctx, shadow, fingerprint); err != nil {
+		return err
+	}
+
+	// the name only matters on restart, the store keeps using collections by id
+	retired := ds.name + retiredSuffix
+	if err := ds.deleteCollection(ctx, retired); err != nil {
+		return fmt.Errorf("failed to remove stale retired collection: %w", err)
+	}
+	if err := old.ModifyName(ctx, retired); err != nil {
+		return fmt.Errorf("failed to retire collection: %w", err)
+	}
+	if err := shadow.ModifyName(ctx, ds.name); err != nil {
+		// give the current collection its name back, so that it is still found on
+		// restart once the shadow collection is dropped
+		if restoreErr := old.ModifyName(context.WithoutCancel(ctx), ds.name); restoreErr != nil {
+			return fmt.Errorf("failed to promote shadow collection: %w; and failed to rename %s back to %s: %v",
+				err, retired, ds.name, restoreErr)
+		}
+
+		return fmt.Errorf("failed to promote shadow collection: %w", err)
+	}
+
+	ds.mu.Lock()
+	ds.col = shadow
+	ds.versions = ds.targetVersions
+	ds.target = nil
+	ds.targetVersions = nil
+	ds.fingerprint = fingerprint
+	ds.mu.Unlock()
+
+	// the switch is done, a leftover retired collection is deleted by the next commit
+	if err := ds.deleteCollection(ctx, retired); err != nil && ds.log != nil {
+		ds.log.Warn("failed to delete retired collection", "collection", retired, "error", err)
+	}
+
+	return nil
+}
+
+// AbortRebuild drops the shadow collection, the current collection is unaffected
+func (ds *ChromaStore) AbortRebuild(ctx context.Context) error {
+	ds.mu.Lock()
+	shadow := ds.target
+	ds.target = nil
+	ds.targetVersions = nil
+	ds.mu.Unlock()
+
+	if shadow == nil {
+		return errNoRebuild
+	}
+
+	return ds.deleteCollection(ctx, shadow.Name())
+}
+
+func (ds *ChromaStore) deleteCollection(ctx context.Context, name string) error {
+	var chromaErr *http.ChromaError
+	err := ds.client.DeleteCollection(ctx, name)
+	if errors.As(err, &chromaErr) && chromaErr.ErrorCode == 404 {
+		return nil
+	}
+
+	return err
+}
+
+func readFingerprint(col chroma.Collection) string {
+	meta := col.Metadata()
+	if meta == nil {
+		return ""
+	}
+
+	fingerprint, _ := meta.GetString(IndexFingerprint)
+	return fingerprint
+}
+
+// writeFingerprint records the fingerprint keeping the rest of the collection metadata
+func writeFingerprint(ctx context.Context, col chroma.Collection, fingerprint string) error {
+	meta := chroma.NewEmptyMetadata()
+	if current := col.Metadata(); current != nil {
+		raw, err := current.MarshalJSON()
+		if err != nil {
+			return fmt.Errorf("failed to encode collection metadata: %w", err)
+		}
+		if err := meta.UnmarshalJSON(raw); err != nil {
+			return fmt.Errorf("failed to copy collection metadata: %w", err)
+		}
+	}
+	meta.SetString(IndexFingerprint, fingerprint)
+
+	if err := col.ModifyMetadata(ctx, meta); err != nil {
+		return fmt.Errorf("failed to record index fingerprint: %w", err)
+	}
+
+	return nil
+}
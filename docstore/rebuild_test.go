@@ -0,0 +1,196 @@
+package docstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+
+	chroma "github.com/amikos-tech/chroma-go/pkg/api/v2"
+	mocks "github.com/gamma-omg/rag-mcp/mocks/chroma"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeCollectionClient struct {
+	created      []string
+	deleted      []string
+	col          chroma.Collection
+	heartbeatErr error
+	// deleteErrs are returned by the successive deletions, nil entries succeed
+	deleteErrs []error
+}
+
+func (c *fakeCollectionClient) Heartbeat(ctx context.Context) error {
+	return c.heartbeatErr
+}
+
+func (c *fakeCollectionClient) CreateCollection(ctx context.Context, name string, options ...chroma.CreateCollectionOption) (chroma.Collection, error) {
+	c.created = append(c.created, name)
+	return c.col, nil
+}
+
+func (c *fakeCollectionClient) DeleteCollection(ctx context.Context, name string, options ...chroma.DeleteCollectionOption) error {
+	c.deleted = append(c.deleted, name)
+	if len(c.deleteErrs) == 0 {
+		return nil
+	}
+
+	err := c.deleteErrs[0]
+	c.deleteErrs = c.deleteErrs[1:]
+	return err
+}
+
+func fingerprintOf(fingerprint string) any {
+	return mock.MatchedBy(func(meta chroma.CollectionMetadata) bool {
+		v, _ := meta.GetString(IndexFingerprint)
+		return v == fingerprint
+	})
+}
+
+func Test_SetFingerprint(t *testing.T) {
+	col := new(mocks.MockCollection)
+	col.EXPECT().Metadata().Return(chroma.NewMetadata(chroma.NewStringAttribute("hnsw:space", "l2")))
+	col.EXPECT().ModifyMetadata(mock.Anything, mock.MatchedBy(func(meta chroma.CollectionMetadata) bool {
+		space, _ := meta.GetString("hnsw:space")
+		fp, _ := meta.GetString(IndexFingerprint)
+		return space == "l2" && fp == "v2"
+	})).Return(nil)
+
+	store := ChromaStore{col: col, fingerprint: "v1"}
+	require.NoError(t, store.SetFingerprint(context.Background(), "v2"))
+	assert.Equal(t, "v2", store.Fingerprint())
+	col.AssertExpectations(t)
+}
+
+func Test_ResetIndex(t *testing.T) {
+	old := new(mocks.MockCollection)
+	fresh := new(mocks.MockCollection)
+	client := &fakeCollectionClient{col: fresh}
+	store := ChromaStore{
+		client:      client,
+		name:        "documents",
+		col:         old,
+		versions:    versions{"facts.txt": "1"},
+		fingerprint: "v1",
+	}
+
+	require.NoError(t, store.ResetIndex(context.Background()))
+	assert.Equal(t, []string{"documents"}, client.deleted)
+	assert.Equal(t, []string{"documents"}, client.created)
+	assert.Same(t, fresh, store.readCollection())
+	assert.Empty(t, store.versions)
+	assert.Empty(t, store.Fingerprint())
+}
+
+func Test_Rebuild_Commit(t *testing.T) {
+	active := new(mocks.MockCollection)
+	shadow := new(mocks.MockCollection)
+	client := &fakeCollectionClient{col: shadow}
+	store := ChromaStore{
+		results: 1,
+		client:  client,
+		name:    "documents",
+		col:     active,
+	}
+
+	require.NoError(t, store.BeginRebuild(context.Background()))
+	assert.Equal(t, []string{"documents_shadow"}, client.created)
+	assert.Same(t, shadow, writeCollection(&store))
+	assert.Same(t, active, store.readCollection())
+
+	shadow.EXPECT().Metadata().Return(nil)
+	shadow.EXPECT().ModifyMetadata(mock.Anything, fingerprintOf("v2")).Return(nil)
+	active.EXPECT().ModifyName(mock.Anything, "documents_retired").Return(nil)
+	shadow.EXPECT().ModifyName(mock.Anything, "documents").Return(nil)
+
+	require.NoError(t, store.CommitRebuild(context.Background(), "v2"))
+	assert.Same(t, shadow, store.readCollection())
+	assert.Same(t, shadow, writeCollection(&store))
+	assert.Equal(t, "v2", store.Fingerprint())
+	assert.Equal(t, []string{"documents_shadow", "documents_retired", "documents_retired"}, client.deleted)
+	active.AssertExpectations(t)
+	shadow.AssertExpectations(t)
+}
+
+func Test_Rebuild_Commit_PromoteFails(t *testing.T) {
+	active := new(mocks.MockCollection)
+	shadow := new(mocks.MockCollection)
+	client := &fakeCollectionClient{col: shadow}
+	store := ChromaStore{
+		client:      client,
+		name:        "documents",
+		col:         active,
+		fingerprint: "v1",
+	}
+
+	require.NoError(t, store.BeginRebuild(context.Background()))
+
+	shadow.EXPECT().Metadata().Return(nil)
+	shadow.EXPECT().ModifyMetadata(mock.Anything, fingerprintOf("v2")).Return(nil)
+	active.EXPECT().ModifyName(mock.Anything, "documents_retired").Return(nil)
+	shadow.EXPECT().ModifyName(mock.Anything, "documents").Return(errors.New("unavailable"))
+	active.EXPECT().ModifyName(mock.Anything, "documents").Return(nil)
+
+	err := store.CommitRebuild(context.Background(), "v2")
+	assert.ErrorContains(t, err, "failed to promote shadow collection")
+	assert.Same(t, active, store.readCollection())
+	assert.Same(t, shadow, writeCollection(&store))
+	assert.Equal(t, "v1", store.Fingerprint())
+	active.AssertExpectations(t)
+	shadow.AssertExpectations(t)
+}
+
+func Test_Rebuild_Commit_RetiredCleanupFails(t *testing.T) {
+	active := new(mocks.MockCollection)
+	shadow := new(mocks.MockCollection)
+	client := &fakeCollectionClient{col: shadow}
+	store := ChromaStore{
+		client: client,
+		name:   "documents",
+		col:    active,
+		log:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	require.NoError(t, store.BeginRebuild(context.Background()))
+
+	shadow.EXPECT().Metadata().Return(nil)
+	shadow.EXPECT().ModifyMetadata(mock.Anything, fingerprintOf("v2")).Return(nil)
+	active.EXPECT().ModifyName(mock.Anything, "documents_retired").Return(nil)
+	shadow.EXPECT().ModifyName(mock.Anything, "documents").Return(nil)
+	client.deleteErrs = []error{nil, errors.New("unavailable")}
+
+	require.NoError(t, store.CommitRebuild(context.Background(), "v2"))
+	assert.Same(t, shadow, store.readCollection())
+	assert.Equal(t, "v2", store.Fingerprint())
+	assert.ErrorIs(t, store.AbortRebuild(context.Background()), errNoRebuild)
+}
+
+func Test_Rebuild_Abort(t *testing.T) {
+	active := new(mocks.MockCollection)
+	shadow := new(mocks.MockCollection)
+	shadow.EXPECT().Name().Return("documents_shadow")
+	client := &fakeCollectionClient{col: shadow}
+	store := ChromaStore{
+		client:      client,
+		name:        "documents",
+		col:         active,
+		fingerprint: "v1",
+	}
+
+	require.NoError(t, store.BeginRebuild(context.Background()))
+	require.NoError(t, store.AbortRebuild(context.Background()))
+
+	assert.Same(t, active, store.readCollection())
+	assert.Same(t, active, writeCollection(&store))
+	assert.Equal(t, "v1", store.Fingerprint())
+	assert.Equal(t, []string{"documents_shadow", "documents_shadow"}, client.deleted)
+	assert.Error(t, store.AbortRebuild(context.Background()))
+}
+
+func writeCollection(ds *ChromaStore) chroma.Collection {
+	col, _ := ds.writeIndex()
+	return col
+}
@@ -0,0 +1,250 @@
+package docstore
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	chroma "github.com/amikos-tech/chroma-go/pkg/api/v2"
+)
+
+const (
+	// FileVersion tells apart the chunks of successive ingestions of a document, so
+	// that a new version can be added before the previous one is deleted
+	FileVersion = "file_version"
+	// FileChunks is the number of chunks of a version, versions with fewer chunks
+	// stored were interrupted while being ingested
+	FileChunks = "file_chunks"
+)
+
+// versions maps the documents of a collection to their active version. Searches
+// skip chunks of any other version, so replacing a document switches from the old
+// version to the new one at once. Documents ingested before versions were recorded
+// have an empty version.
+type versions map[string]string
+
+// storedVersion summarizes the chunks of one version of a document
+type storedVersion struct {
+	doc    IngestedDoc
+	chunks int
+	total  int
+}
+
+func (v storedVersion) complete() bool {
+	return v.total == 0 || v.chunks >= v.total
+}
+
+// newer reports whether version b is newer than version a. Versions are timestamps,
+// the unversioned chunks of legacy documents are older than any of them.
+func newer(a, b string) bool {
+	if a == "" || b == "" {
+		return b != ""
+	}
+
+	x, _ := strconv.ParseInt(a, 10, 64)
+	y, _ := strconv.ParseInt(b, 10, 64)
+	return y > x
+}
+
+// nextVersion returns a version newer than any returned before
+func (ds *ChromaStore) nextVersion() string {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	v := time.Now().UnixMicro()
+	if v <= ds.lastVersion {
+		v = ds.lastVersion + 1
+	}
+	ds.lastVersion = v
+
+	return strconv.FormatInt(v, 10)
+}
+
+// activate makes a version of a document the one returned by searches
+func (ds *ChromaStore) activate(vs versions, file, version string) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	vs[file] = version
+}
+
+// deactivate drops a document from the active versions if version is the active one
+func (ds *ChromaStore) deactivate(vs versions, file, version string) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	if active, ok := vs[file]; ok && active == version {
+		delete(vs, file)
+	}
+}
+
+// isActive reports whether a chunk belongs to the active version of its document.
+// Chunks of documents the store knows no version of are always active.
+func (ds *ChromaStore) isActive(file string, meta chroma.DocumentMetadata) bool {
+	ds.mu.RLock()
+	active, ok := ds.versions[file]
+	ds.mu.RUnlock()
+
+	if !ok {
+		return true
+	}
+
+	version, _ := meta.GetString(FileVersion)
+	return version == active
+}
+
+// scanVersions lists the versions of all documents stored in a collection
+func scanVersions(ctx context.Context, col chroma.Collection) (map[string][]storedVersion, error) {
+	res, err := col.Get(ctx, chroma.WithIncludeGet(chroma.IncludeMetadatas))
+	if err != nil {
+		return nil, err
+	}
+
+	type key struct{ file, version string }
+	index := make(map[key]*storedVersion)
+	var order []key
+	for _, meta := range res.GetMetadatas() {
+		path, _ := meta.GetString(FilePath)
+		version, _ := meta.GetString(FileVersion)
+		k := key{path, version}
+
+		v, ok := index[k]
+		if !ok {
+			crc, _ := meta.GetFloat(FileCrc) // for some reason file crc gets stored as float64 in Chroma
+			total, _ := meta.GetFloat(FileChunks)
+			profile, _ := meta.GetString(ChunkProfile)
+			v = &storedVersion{
+				doc: IngestedDoc{
+					File:    path,
+					Crc:     uint32(crc),
+					Profile: profile,
+					Version: version,
+				},
+				total: int(total),
+			}
+			index[k] = v
+			order = append(order, k)
+		}
+		v.chunks++
+	}
+
+	docs := make(map[string][]storedVersion)
+	for _, k := range order {
+		docs[k.file] = append(docs[k.file], *index[k])
+	}
+
+	return docs, nil
+}
+
+// latestVersion picks the newest completely ingested version of a document
+func latestVersion(stored []storedVersion) (storedVersion, bool) {
+	var latest storedVersion
+	found := false
+	for _, v := range stored {
+		if !v.complete() {
+			continue
+		}
+		if !found || newer(latest.doc.Version, v.doc.Version) {
+			latest = v
+			found = true
+		}
+	}
+
+	return latest, found
+}
+
+// loadVersions reads the active versions of the documents of a collection. The
+// versions left behind are kept, as other processes may still be writing them.
+func loadVersions(ctx context.Context, col chroma.Collection) (versions, error) {
+	docs, err := scanVersions(ctx, col)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read document versions: %w", err)
+	}
+
+	vs := make(versions)
+	for file, stored := range docs {
+		if latest, ok := latestVersion(stored); ok {
+			vs[file] = latest.doc.Version
+		}
+	}
+
+	return vs, nil
+}
+
+// CleanupVersions deletes the versions superseded by the active version of their
+// document, and the versions left behind by interrupted ingestions. Incomplete
+// versions created less than grace ago may still be written and are kept. It must
+// only be called by the process writing the index. It returns the number of
+// versions deleted.
+func (ds *ChromaStore) CleanupVersions(ctx context.Context, grace time.Duration) (int, error) {
+	col := ds.readCollection()
+	docs, err := scanVersions(ctx, col)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read document versions: %w", err)
+	}
+
+	cutoff := time.Now().Add(-grace).UnixMicro()
+	deleted := 0
+	for file, stored := range docs {
+		latest, ok := latestVersion(stored)
+		for _, v := range stored {
+			if ok && v.doc.Version == latest.doc.Version {
+				continue
+			}
+			if !v.complete() && !expired(v.doc.Version, cutoff) {
+				continue
+			}
+
+			if err := deleteVersion(ctx, col, v.doc); err != nil {
+				return deleted, fmt.Errorf("failed to delete stale version of %s: %w", file, err)
+			}
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+// expired reports whether a version was created before cutoff, in microseconds
+func expired(version string, cutoff int64) bool {
+	created, err := strconv.ParseInt(version, 10, 64)
+	return err == nil && created < cutoff
+}
+
+// deleteVersion deletes the chunks of one version of a document. Chunks of legacy
+// documents carry no version and are selected by id, so that a new version with
+// the same content is kept.
+func deleteVersion(ctx context.Context, col chroma.Collection, doc IngestedDoc) error {
+	if doc.Version != "" {
+		return col.Delete(ctx, chroma.WithWhereDelete(
+			chroma.And(
+				chroma.EqString(FilePath, doc.File),
+				chroma.EqString(FileVersion, doc.Version),
+			)))
+	}
+
+	res, err := col.Get(ctx,
+		chroma.WithWhereGet(chroma.And(
+			chroma.EqString(FilePath, doc.File),
+			chroma.EqInt(FileCrc, int(doc.Crc)),
+		)),
+		chroma.WithIncludeGet(chroma.IncludeMetadatas))
+	if err != nil {
+		return err
+	}
+
+	var ids []chroma.DocumentID
+	metadatas := res.GetMetadatas()
+	for i, id := range res.GetIDs() {
+		if _, versioned := metadatas[i].GetString(FileVersion); !versioned {
+			ids = append(ids, id)
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	return col.Delete(ctx, chroma.WithIDsDelete(ids...))
+}
@@ -0,0 +1,180 @@
+package docstore
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	chroma "github.com/amikos-tech/chroma-go/pkg/api/v2"
+	"github.com/amikos-tech/chroma-go/pkg/embeddings"
+	mocks "github.com/gamma-omg/rag-mcp/mocks/chroma"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func chunkMeta(file, version string, crc, total int) chroma.DocumentMetadata {
+	attrs := []*chroma.MetaAttribute{
+		chroma.NewStringAttribute(FilePath, file),
+		chroma.NewFloatAttribute(FileCrc, float64(crc)),
+	}
+	if version != "" {
+		attrs = append(attrs,
+			chroma.NewStringAttribute(FileVersion, version),
+			chroma.NewFloatAttribute(FileChunks, float64(total)))
+	}
+
+	return chroma.NewDocumentMetadata(attrs...)
+}
+
+func getResult(ids []chroma.DocumentID, metas ...chroma.DocumentMetadata) *mocks.MockGetResult {
+	get := new(mocks.MockGetResult)
+	get.EXPECT().GetMetadatas().Return(metas)
+	if ids != nil {
+		get.EXPECT().GetIDs().Return(ids)
+	}
+	return get
+}
+
+func Test_Ingest_ActivatesVersion(t *testing.T) {
+	col := new(mocks.MockCollection)
+	store := ChromaStore{
+		results:  1,
+		col:      col,
+		versions: versions{"facts.txt": ""},
+	}
+
+	col.EXPECT().Add(mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	require.NoError(t, store.Ingest(context.Background(), Doc{
+		File:   "facts.txt",
+		Crc:    1,
+		Chunks: []Chunk{{Text: "Venus"}},
+	}))
+	assert.NotEmpty(t, store.versions["facts.txt"])
+}
+
+func Test_Ingest_FailureKeepsPreviousVersion(t *testing.T) {
+	col := new(mocks.MockCollection)
+	store := ChromaStore{
+		results:  1,
+		col:      col,
+		versions: versions{"facts.txt": "1"},
+	}
+
+	col.EXPECT().Add(mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(errors.New("embedding failed"))
+	col.EXPECT().Delete(mock.Anything, mock.Anything).Return(nil)
+
+	assert.Error(t, store.Ingest(context.Background(), Doc{
+		File:   "facts.txt",
+		Crc:    2,
+		Chunks: []Chunk{{Text: "Venus"}},
+	}))
+	assert.Equal(t, versions{"facts.txt": "1"}, store.versions)
+	col.AssertExpectations(t)
+}
+
+func Test_Retrieve_SkipsInactiveVersions(t *testing.T) {
+	col := new(mocks.MockCollection)
+	store := ChromaStore{
+		results:  2,
+		col:      col,
+		versions: versions{"facts.txt": "2"},
+	}
+
+	oldDoc := new(mocks.MockDocument)
+	newDoc := new(mocks.MockDocument)
+	newDoc.EXPECT().ContentString().Return("new")
+
+	qr := new(mocks.MockQueryResult)
+	qr.EXPECT().GetMetadatasGroups().Return([]chroma.DocumentMetadatas{{
+		chunkMeta("facts.txt", "1", 1, 1),
+		chunkMeta("facts.txt", "2", 2, 1),
+	}})
+	qr.EXPECT().GetDistancesGroups().Return([]embeddings.Distances{{0.1, 0.2}})
+	qr.EXPECT().GetDocumentsGroups().Return([]chroma.Documents{{oldDoc, newDoc}})
+	col.EXPECT().Query(mock.Anything, mock.Anything, mock.Anything).Return(qr, nil)
+
+	res, err := store.Retrieve(context.Background(), "facts")
+	require.NoError(t, err)
+	assert.Equal(t, []SearchResult{{Text: "new", File: "facts.txt", Score: 0.2}}, res)
+}
+
+func Test_Forget_Legacy(t *testing.T) {
+	col := new(mocks.MockCollection)
+	store := ChromaStore{
+		results:  1,
+		col:      col,
+		versions: versions{"f1.txt": "2"},
+	}
+
+	col.EXPECT().Get(mock.Anything, mock.Anything, mock.Anything).Return(getResult(
+		[]chroma.DocumentID{"legacy", "current"},
+		chunkMeta("f1.txt", "", 123, 0),
+		chunkMeta("f1.txt", "2", 123, 1),
+	), nil)
+	col.EXPECT().Delete(mock.Anything, mock.Anything).Return(nil).Once()
+
+	require.NoError(t, store.Forget(context.Background(), IngestedDoc{File: "f1.txt", Crc: 123}))
+	assert.Equal(t, versions{"f1.txt": "2"}, store.versions)
+	col.AssertExpectations(t)
+}
+
+func Test_GetIngested_LatestCompleteVersion(t *testing.T) {
+	col := new(mocks.MockCollection)
+	store := ChromaStore{
+		results: 1,
+		col:     col,
+	}
+
+	col.EXPECT().Get(mock.Anything, mock.Anything).Return(getResult(nil,
+		chunkMeta("a.txt", "1", 1, 1),
+		chunkMeta("a.txt", "2", 2, 2),
+		chunkMeta("b.txt", "", 3, 0),
+		chunkMeta("b.txt", "3", 4, 1),
+	), nil)
+
+	ingested, err := store.GetIngested(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []IngestedDoc{
+		{File: "a.txt", Crc: 1, Version: "1"},
+		{File: "b.txt", Crc: 4, Version: "3"},
+	}, ingested)
+}
+
+func Test_loadVersions(t *testing.T) {
+	col := new(mocks.MockCollection)
+
+	col.EXPECT().Get(mock.Anything, mock.Anything).Return(getResult(nil,
+		chunkMeta("a.txt", "1", 1, 1),
+		chunkMeta("a.txt", "2", 2, 2),
+		chunkMeta("b.txt", "", 3, 0),
+	), nil)
+
+	vs, err := loadVersions(context.Background(), col)
+	require.NoError(t, err)
+	assert.Equal(t, versions{"a.txt": "1", "b.txt": ""}, vs)
+	col.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+}
+
+func Test_CleanupVersions(t *testing.T) {
+	col := new(mocks.MockCollection)
+	store := ChromaStore{col: col}
+
+	recent := strconv.FormatInt(time.Now().UnixMicro(), 10)
+	col.EXPECT().Get(mock.Anything, mock.Anything).Return(getResult(nil,
+		chunkMeta("a.txt", "1", 1, 1),
+		chunkMeta("a.txt", "2", 2, 1),
+		chunkMeta("b.txt", "", 3, 0),
+		chunkMeta("c.txt", "3", 4, 2),
+		chunkMeta("d.txt", recent, 5, 2),
+	), nil)
+	col.EXPECT().Delete(mock.Anything, mock.Anything).Return(nil).Times(2)
+
+	deleted, err := store.CleanupVersions(context.Background(), time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 2, deleted)
+	col.AssertExpectations(t)
+}
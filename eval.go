@@ -0,0 +1,430 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/amikos-tech/chroma-go/pkg/embeddings"
+	"github.com/gamma-omg/rag-mcp/docstore"
+)
+
+// evalCase is a query along with the documents and passages a search should find.
+// Documents are paths relative to the documents root, passages are excerpts of the
+// expected chunks.
+type evalCase struct {
+	Query     string   `json:"query"`
+	Documents []string `json:"documents,omitempty"`
+	Passages  []string `json:"passages,omitempty"`
+}
+
+func (c evalCase) targets() int {
+	return len(c.Documents) + len(c.Passages)
+}
+
+// queryScore is the outcome of a single evaluated query
+type queryScore struct {
+	Query     string        `json:"query"`
+	Recall    float64       `json:"recall"`
+	RR        float64       `json:"reciprocal_rank"`
+	NDCG      float64       `json:"ndcg"`
+	Latency   time.Duration `json:"latency_ns"`
+	FirstHit  int           `json:"first_hit,omitempty"`
+	Retrieved []string      `json:"retrieved"`
+}
+
+// evalReport aggregates the scores of an evaluation run
+type evalReport struct {
+	Config     string        `json:"config"`
+	K          int           `json:"k"`
+	Recall     float64       `json:"recall"`
+	MRR        float64       `json:"mrr"`
+	NDCG       float64       `json:"ndcg"`
+	LatencyP50 time.Duration `json:"latency_p50_ns"`
+	LatencyP95 time.Duration `json:"latency_p95_ns"`
+	LatencyMax time.Duration `json:"latency_max_ns"`
+	Queries    []queryScore  `json:"queries"`
+}
+
+func readEvalCases(r io.Reader) ([]evalCase, error) {
+	var cases []evalCase
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64<<10), 1<<20)
+	for line := 1; sc.Scan(); line++ {
+		if strings.TrimSpace(sc.Text()) == "" {
+			continue
+		}
+
+		var c evalCase
+		if err := json.Unmarshal(sc.Bytes(), &c); err != nil {
+			return nil, fmt.Errorf("invalid query on line %d: %w", line, err)
+		}
+		if strings.TrimSpace(c.Query) == "" {
+			return nil, fmt.Errorf("invalid query on line %d: missing query", line)
+		}
+		if c.targets() == 0 {
+			return nil, fmt.Errorf("invalid query on line %d: no expected documents or passages", line)
+		}
+		cases = append(cases, c)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read queries: %w", err)
+	}
+	if len(cases) == 0 {
+		return nil, errors.New("no queries to evaluate")
+	}
+
+	return cases, nil
+}
+
+// evaluate runs the queries one at a time against the retriever and scores the top
+// k results of each
+func evaluate(ctx context.Context, retriever docRetriever, cases []evalCase, k int) (evalReport, error) {
+	report := evalReport{K: k, Queries: make([]queryScore, 0, len(cases))}
+	for _, c := range cases {
+		start := time.Now()
+		res, err := retriever.Retrieve(ctx, c.Query)
+		if err != nil {
+			return evalReport{}, fmt.Errorf("failed to search %q: %w", c.Query, err)
+		}
+
+		s := scoreQuery(c, res, k)
+		s.Latency = time.Since(start)
+		report.Queries = append(report.Queries, s)
+	}
+
+	latencies := make([]time.Duration, 0, len(report.Queries))
+	for _, s := range report.Queries {
+		report.Recall += s.Recall
+		report.MRR += s.RR
+		report.NDCG += s.NDCG
+		latencies = append(latencies, s.Latency)
+	}
+	n := float64(len(report.Queries))
+	report.Recall /= n
+	report.MRR /= n
+	report.NDCG /= n
+
+	slices.Sort(latencies)
+	report.LatencyP50 = percentile(latencies, 0.5)
+	report.LatencyP95 = percentile(latencies, 0.95)
+	report.LatencyMax = latencies[len(latencies)-1]
+
+	return report, nil
+}
+
+// scoreQuery computes recall@k, the reciprocal rank and nDCG@k of a search with
+// binary relevance. A result is relevant when it matches an expected document or
+// passage not matched by a better ranked result, so that several chunks of the same
+// document are not counted twice.
+func scoreQuery(c evalCase, res []docstore.SearchResult, k int) queryScore {
+	s := queryScore{Query: c.Query, Retrieved: []string{}}
+	found := make([]bool, c.targets())
+	var dcg float64
+	for i, r := range res[:min(k, len(res))] {
+		s.Retrieved = append(s.Retrieved, r.File)
+
+		relevant := false
+		for t := range found {
+			if found[t] || !matchesTarget(c, t, r) {
+				continue
+			}
+			found[t] = true
+			relevant = true
+		}
+		if !relevant {
+			continue
+		}
+
+		dcg += 1 / math.Log2(float64(i+2))
+		if s.FirstHit == 0 {
+			s.FirstHit = i + 1
+			s.RR = 1 / float64(i+1)
+		}
+	}
+
+	var idcg float64
+	for i := range min(k, len(found)) {
+		idcg += 1 / math.Log2(float64(i+2))
+	}
+
+	matched := 0
+	for _, f := range found {
+		if f {
+			matched++
+		}
+	}
+	s.Recall = float64(matched) / float64(len(found))
+	s.NDCG = dcg / idcg
+
+	return s
+}
+
+// matchesTarget reports whether a result matches the t-th expected document or
+// passage of a query. Documents match the results of the file itself or, for
+// archives, of any of their entries.
+func matchesTarget(c evalCase, t int, r docstore.SearchResult) bool {
+	if t < len(c.Documents) {
+		doc := filepath.ToSlash(c.Documents[t])
+		return r.File == doc || strings.HasPrefix(r.File, doc+archiveSep)
+	}
+
+	return strings.Contains(normalizeSpace(r.Text), normalizeSpace(c.Passages[t-len(c.Documents)]))
+}
+
+func normalizeSpace(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	return sorted[max(i, 0)]
+}
+
+func runEval(ctx context.Context, args []string, out io.Writer) error {
+	fs, cfgPath := newFlagSet("eval", "<queries.jsonl>")
+	compare := fs.String("compare", "", "Configuration to compare against the one given by -config")
+	k := fs.Int("k", 0, "Number of results scored per query, defaults to the results setting of the config")
+	cache := fs.String("cache", "", "File caching query embeddings, so that later runs need no embedding provider")
+	asJSON := fs.Bool("json", false, "Print the reports as JSON, including the scores of each query")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected a single queries file")
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("failed to open queries: %w", err)
+	}
+	cases, err := readEvalCases(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	reports := make([]evalReport, 0, 2)
+	for _, path := range []string{*cfgPath, *compare} {
+		if path == "" {
+			continue
+		}
+
+		report, err := evalConfig(ctx, appOptions{cfgPath: path, results: *k, queryCache: *cache}, cases)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		reports = append(reports, report)
+	}
+
+	if *asJSON {
+		return printJSON(out, reports)
+	}
+	if len(reports) == 1 {
+		return printEvalReport(out, reports[0])
+	}
+
+	return printEvalDiff(out, reports[0], reports[1])
+}
+
+func evalConfig(ctx context.Context, opts appOptions, cases []evalCase) (evalReport, error) {
+	a, err := openApp(opts)
+	if err != nil {
+		return evalReport{}, err
+	}
+	defer a.Close()
+
+	report, err := evaluate(ctx, a.store, cases, a.cfg.Results)
+	if err != nil {
+		return evalReport{}, err
+	}
+	report.Config = opts.cfgPath
+
+	return report, nil
+}
+
+// evalMetrics lists the metrics of a report in the order they are printed
+func evalMetrics(r evalReport) [][2]string {
+	return [][2]string{
+		{fmt.Sprintf("recall@%d", r.K), fmt.Sprintf("%.4f", r.Recall)},
+		{"mrr", fmt.Sprintf("%.4f", r.MRR)},
+		{fmt.Sprintf("ndcg@%d", r.K), fmt.Sprintf("%.4f", r.NDCG)},
+		{"latency p50", r.LatencyP50.Round(time.Millisecond).String()},
+		{"latency p95", r.LatencyP95.Round(time.Millisecond).String()},
+		{"latency max", r.LatencyMax.Round(time.Millisecond).String()},
+	}
+}
+
+func printEvalReport(out io.Writer, r evalReport) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "queries\t%d\n", len(r.Queries))
+	for _, m := range evalMetrics(r) {
+		fmt.Fprintf(w, "%s\t%s\n", m[0], m[1])
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	var missed []queryScore
+	for _, s := range r.Queries {
+		if s.Recall < 1 {
+			missed = append(missed, s)
+		}
+	}
+	if len(missed) == 0 {
+		return nil
+	}
+
+	fmt.Fprintf(out, "\n%d query(ies) missed expected results:\n", len(missed))
+	return printTable(out, []string{"RECALL", "FIRST HIT", "QUERY"}, len(missed), func(i int) []any {
+		s := missed[i]
+		return []any{fmt.Sprintf("%.2f", s.Recall), s.FirstHit, snippet(s.Query, 80)}
+	})
+}
+
+// printEvalDiff prints the metrics of two runs side by side, and the queries whose
+// nDCG changed
+func printEvalDiff(out io.Writer, base, other evalReport) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "METRIC\t%s\t%s\tDELTA\n", base.Config, other.Config)
+	deltas := []string{
+		fmt.Sprintf("%+.4f", other.Recall-base.Recall),
+		fmt.Sprintf("%+.4f", other.MRR-base.MRR),
+		fmt.Sprintf("%+.4f", other.NDCG-base.NDCG),
+		durationDelta(other.LatencyP50 - base.LatencyP50),
+		durationDelta(other.LatencyP95 - base.LatencyP95),
+		durationDelta(other.LatencyMax - base.LatencyMax),
+	}
+	bm, om := evalMetrics(base), evalMetrics(other)
+	for i := range bm {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", bm[i][0], bm[i][1], om[i][1], deltas[i])
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	type change struct {
+		query      string
+		base, diff float64
+	}
+	var changes []change
+	for i, s := range base.Queries {
+		if d := other.Queries[i].NDCG - s.NDCG; math.Abs(d) > 1e-9 {
+			changes = append(changes, change{s.Query, s.NDCG, d})
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+
+	slices.SortStableFunc(changes, func(a, b change) int {
+		return cmp.Compare(a.diff, b.diff)
+	})
+	fmt.Fprintf(out, "\n%d query(ies) changed:\n", len(changes))
+	return printTable(out, []string{"NDCG", "DELTA", "QUERY"}, len(changes), func(i int) []any {
+		c := changes[i]
+		return []any{fmt.Sprintf("%.4f", c.base), fmt.Sprintf("%+.4f", c.diff), snippet(c.query, 80)}
+	})
+}
+
+func durationDelta(d time.Duration) string {
+	d = d.Round(time.Millisecond)
+	if d >= 0 {
+		return "+" + d.String()
+	}
+
+	return d.String()
+}
+
+// queryCache remembers query embeddings in a file, so that repeated evaluations
+// need no embedding provider. Document embeddings are not cached.
+type queryCache struct {
+	embeddings.EmbeddingFunction
+	path  string
+	model string
+
+	mu      sync.Mutex
+	entries map[string]map[string][]float32
+	dirty   bool
+}
+
+func openQueryCache(path, model string, ef embeddings.EmbeddingFunction) (*queryCache, error) {
+	c := &queryCache{
+		EmbeddingFunction: ef,
+		path:              path,
+		model:             model,
+		entries:           make(map[string]map[string][]float32),
+	}
+
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read query cache: %w", err)
+	}
+	if err := json.Unmarshal(raw, &c.entries); err != nil {
+		return nil, fmt.Errorf("invalid query cache %s: %w", path, err)
+	}
+
+	return c, nil
+}
+
+func (c *queryCache) EmbedQuery(ctx context.Context, text string) (embeddings.Embedding, error) {
+	c.mu.Lock()
+	cached, ok := c.entries[c.model][text]
+	c.mu.Unlock()
+	if ok {
+		return embeddings.NewEmbeddingFromFloat32(cached), nil
+	}
+
+	emb, err := c.EmbeddingFunction.EmbedQuery(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries[c.model] == nil {
+		c.entries[c.model] = make(map[string][]float32)
+	}
+	c.entries[c.model][text] = emb.ContentAsFloat32()
+	c.dirty = true
+
+	return emb, nil
+}
+
+// Save writes the cache if new queries were embedded
+func (c *queryCache) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.dirty {
+		return nil
+	}
+
+	raw, err := json.Marshal(c.entries)
+	if err != nil {
+		return fmt.Errorf("failed to encode query cache: %w", err)
+	}
+	if err := os.WriteFile(c.path, raw, 0o644); err != nil {
+		return fmt.Errorf("failed to write query cache: %w", err)
+	}
+
+	c.dirty = false
+	return nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/amikos-tech/chroma-go/pkg/embeddings"
+	"github.com/gamma-omg/rag-mcp/docstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type staticRetriever map[string][]docstore.SearchResult
+
+func (r staticRetriever) Retrieve(ctx context.Context, query string) ([]docstore.SearchResult, error) {
+	return r[query], nil
+}
+
+type countingEmbedder struct {
+	queries int
+}
+
+func (e *countingEmbedder) EmbedDocuments(ctx context.Context, texts []string) ([]embeddings.Embedding, error) {
+	return nil, nil
+}
+
+func (e *countingEmbedder) EmbedQuery(ctx context.Context, text string) (embeddings.Embedding, error) {
+	e.queries++
+	return embeddings.NewEmbeddingFromFloat32([]float32{float32(len(text)), 1}), nil
+}
+
+func Test_readEvalCases(t *testing.T) {
+	cases, err := readEvalCases(strings.NewReader(`{"query": "rotate keys", "documents": ["ops/keys.md"]}
+
+{"query": "retention", "passages": ["kept for 30 days"]}
+`))
+	require.NoError(t, err)
+	assert.Equal(t, []evalCase{
+		{Query: "rotate keys", Documents: []string{"ops/keys.md"}},
+		{Query: "retention", Passages: []string{"kept for 30 days"}},
+	}, cases)
+
+	_, err = readEvalCases(strings.NewReader(`{"query": "rotate keys"}`))
+	assert.EqualError(t, err, "invalid query on line 1: no expected documents or passages")
+
+	_, err = readEvalCases(strings.NewReader(""))
+	assert.Error(t, err)
+}
+
+func Test_scoreQuery(t *testing.T) {
+	c := evalCase{
+		Query:     "q",
+		Documents: []string{"a.md", "docs.zip"},
+		Passages:  []string{"Kept for  30 days"},
+	}
+	res := []docstore.SearchResult{
+		{File: "other.md"},
+		{File: "a.md", Text: "logs are kept for 30\ndays"},
+		{File: "a.md"},
+		{File: "docs.zip!/b.md"},
+	}
+
+	s := scoreQuery(c, res, 3)
+	assert.Equal(t, 2, s.FirstHit)
+	assert.Equal(t, 0.5, s.RR)
+	assert.InDelta(t, 2.0/3, s.Recall, 1e-9)
+	idcg := 1 + 1/math.Log2(3) + 1/math.Log2(4)
+	assert.InDelta(t, (1/math.Log2(3))/idcg, s.NDCG, 1e-9)
+	assert.Equal(t, []string{"other.md", "a.md", "a.md"}, s.Retrieved)
+
+	s = scoreQuery(c, res, 4)
+	assert.Equal(t, 1.0, s.Recall)
+
+	s = scoreQuery(c, nil, 3)
+	assert.Zero(t, s.RR)
+	assert.Zero(t, s.NDCG)
+}
+
+func Test_evaluate(t *testing.T) {
+	retriever := staticRetriever{
+		"first":  {{File: "a.md"}},
+		"second": {{File: "x.md"}, {File: "b.md"}},
+	}
+	cases := []evalCase{
+		{Query: "first", Documents: []string{"a.md"}},
+		{Query: "second", Documents: []string{"b.md"}},
+	}
+
+	report, err := evaluate(context.Background(), retriever, cases, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.K)
+	assert.Equal(t, 1.0, report.Recall)
+	assert.Equal(t, 0.75, report.MRR)
+	assert.InDelta(t, (1+1/math.Log2(3))/2, report.NDCG, 1e-9)
+	assert.Len(t, report.Queries, 2)
+
+	var out bytes.Buffer
+	require.NoError(t, printEvalReport(&out, report))
+	assert.Contains(t, out.String(), "recall@2")
+
+	worse, err := evaluate(context.Background(), staticRetriever{}, cases, 2)
+	require.NoError(t, err)
+	report.Config, worse.Config = "a.yaml", "b.yaml"
+
+	out.Reset()
+	require.NoError(t, printEvalDiff(&out, report, worse))
+	assert.Contains(t, out.String(), "-1.0000")
+	assert.Contains(t, out.String(), "2 query(ies) changed")
+}
+
+func Test_queryCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.json")
+	ef := &countingEmbedder{}
+
+	cache, err := openQueryCache(path, "openai/small/0", ef)
+	require.NoError(t, err)
+	first, err := cache.EmbedQuery(context.Background(), "rotate keys")
+	require.NoError(t, err)
+	_, err = cache.EmbedQuery(context.Background(), "rotate keys")
+	require.NoError(t, err)
+	assert.Equal(t, 1, ef.queries)
+	require.NoError(t, cache.Save())
+
+	cache, err = openQueryCache(path, "openai/small/0", ef)
+	require.NoError(t, err)
+	cached, err := cache.EmbedQuery(context.Background(), "rotate keys")
+	require.NoError(t, err)
+	assert.Equal(t, first.ContentAsFloat32(), cached.ContentAsFloat32())
+	assert.Equal(t, 1, ef.queries)
+
+	cache, err = openQueryCache(path, "gemini/embedding-001", ef)
+	require.NoError(t, err)
+	_, err = cache.EmbedQuery(context.Background(), "rotate keys")
+	require.NoError(t, err)
+	assert.Equal(t, 2, ef.queries)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/amikos-tech/chroma-go/pkg/embeddings"
+)
+
+const healthCheckTimeout = 5 * time.Second
+
+// RegistryHealth reports whether the documents directory is synchronized and
+// watched, and the last error met while keeping the store up to date
+type RegistryHealth struct {
+	Synced      bool
+	Watching    bool
+	LastError   string
+	LastErrorAt time.Time
+}
+
+type registryHealth struct {
+	mu     sync.Mutex
+	status RegistryHealth
+}
+
+// Health returns the state of the registry
+func (dr *DocRegistry) Health() RegistryHealth {
+	dr.health.mu.Lock()
+	defer dr.health.mu.Unlock()
+
+	return dr.health.status
+}
+
+func (dr *DocRegistry) setSynced() {
+	dr.health.mu.Lock()
+	defer dr.health.mu.Unlock()
+
+	dr.health.status.Synced = true
+}
+
+func (dr *DocRegistry) setWatching(watching bool) {
+	dr.health.mu.Lock()
+	defer dr.health.mu.Unlock()
+
+	dr.health.status.Watching = watching
+}
+
+func (dr *DocRegistry) recordError(err error) {
+	dr.health.mu.Lock()
+	defer dr.health.mu.Unlock()
+
+	dr.health.status.LastError = err.Error()
+	dr.health.status.LastErrorAt = time.Now()
+}
+
+type storePinger interface {
+	Ping(ctx context.Context) error
+}
+
+// embedderStatus is implemented by embedding functions remembering whether the
+// provider answered their last request
+type embedderStatus interface {
+	LastError() error
+}
+
+type registryStatus interface {
+	Health() RegistryHealth
+	Status() IndexStatus
+}
+
+type healthCheck struct {
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type healthReport struct {
+	Status      string       `json:"status"`
+	Store       *healthCheck `json:"store,omitempty"`
+	Embedding   *healthCheck `json:"embedding,omitempty"`
+	Sync        healthCheck  `json:"sync"`
+	Watcher     healthCheck  `json:"watcher"`
+	LastError   string       `json:"last_error,omitempty"`
+	LastErrorAt *time.Time   `json:"last_error_at,omitempty"`
+}
+
+// healthServer serves /healthz, telling whether the process works, and /readyz,
+// telling whether it can answer searches with an up to date index
+type healthServer struct {
+	store    storePinger
+	ef       embeddings.EmbeddingFunction
+	registry registryStatus
+}
+
+func (h *healthServer) register(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", h.handleHealthz)
+	mux.HandleFunc("/readyz", h.handleReadyz)
+}
+
+// handleHealthz fails only when the documents directory stopped being watched after
+// the initial sync, which takes a restart to recover from
+func (h *healthServer) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	report := h.registryReport()
+	healthy := !report.Sync.OK || report.Watcher.OK
+	writeHealthReport(w, report, healthy)
+}
+
+// handleReadyz checks the store and the embedding provider, and requires the
+// initial sync to be complete
+func (h *healthServer) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+	defer cancel()
+
+	report := h.registryReport()
+	report.Store = h.checkStore(ctx)
+	report.Embedding = h.checkEmbedding(ctx)
+
+	ready := report.Store.OK && report.Embedding.OK && report.Sync.OK && report.Watcher.OK
+	writeHealthReport(w, report, ready)
+}
+
+func (h *healthServer) registryReport() healthReport {
+	health := h.registry.Health()
+	report := healthReport{
+		Sync:      healthCheck{OK: health.Synced},
+		Watcher:   healthCheck{OK: health.Watching},
+		LastError: health.LastError,
+	}
+
+	if !health.Synced {
+		status := h.registry.Status()
+		report.Sync.Detail = fmt.Sprintf("syncing, %d of %d documents ingested", status.Done, status.Total)
+	}
+	if !health.LastErrorAt.IsZero() {
+		report.LastErrorAt = &health.LastErrorAt
+	}
+
+	return report
+}
+
+func (h *healthServer) checkStore(ctx context.Context) *healthCheck {
+	if err := h.store.Ping(ctx); err != nil {
+		return &healthCheck{Detail: err.Error()}
+	}
+
+	return &healthCheck{OK: true}
+}
+
+// checkEmbedding trusts the outcome of the last embedding request, and probes the
+// provider again only if it failed
+func (h *healthServer) checkEmbedding(ctx context.Context) *healthCheck {
+	if s, ok := h.ef.(embedderStatus); !ok || s.LastError() == nil {
+		return &healthCheck{OK: true}
+	}
+
+	if _, err := h.ef.EmbedQuery(ctx, "health check"); err != nil {
+		return &healthCheck{Detail: err.Error()}
+	}
+
+	return &healthCheck{OK: true}
+}
+
+func writeHealthReport(w http.ResponseWriter, report healthReport, ok bool) {
+	code := http.StatusOK
+	report.Status = "ok"
+	if !ok {
+		code = http.StatusServiceUnavailable
+		report.Status = "unavailable"
+	}
+
+	writeJSON(w, code, report)
+}
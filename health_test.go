@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/amikos-tech/chroma-go/pkg/embeddings"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakePinger struct {
+	err error
+}
+
+func (p *fakePinger) Ping(ctx context.Context) error {
+	return p.err
+}
+
+type probedEmbedder struct {
+	lastErr  error
+	probeErr error
+	probes   int
+}
+
+func (e *probedEmbedder) EmbedDocuments(ctx context.Context, texts []string) ([]embeddings.Embedding, error) {
+	return nil, nil
+}
+
+func (e *probedEmbedder) EmbedQuery(ctx context.Context, text string) (embeddings.Embedding, error) {
+	e.probes++
+	return nil, e.probeErr
+}
+
+func (e *probedEmbedder) LastError() error {
+	return e.lastErr
+}
+
+func serveHealth(t *testing.T, h *healthServer, path string) (int, healthReport) {
+	mux := http.NewServeMux()
+	h.register(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+	var report healthReport
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	return rec.Code, report
+}
+
+func Test_readyz(t *testing.T) {
+	reg := &DocRegistry{}
+	store := &fakePinger{}
+	ef := &probedEmbedder{}
+	h := &healthServer{store: store, ef: ef, registry: reg}
+
+	reg.startProgress(10)
+	reg.stepProgress()
+	code, report := serveHealth(t, h, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "unavailable", report.Status)
+	assert.Equal(t, "syncing, 1 of 10 documents ingested", report.Sync.Detail)
+	assert.True(t, report.Store.OK)
+
+	reg.setSynced()
+	reg.setWatching(true)
+	code, report = serveHealth(t, h, "/readyz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ok", report.Status)
+	assert.Zero(t, ef.probes)
+
+	store.err = errors.New("connection refused")
+	code, report = serveHealth(t, h, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "connection refused", report.Store.Detail)
+}
+
+func Test_readyz_ProbesFailedEmbedder(t *testing.T) {
+	reg := &DocRegistry{}
+	reg.setSynced()
+	reg.setWatching(true)
+
+	ef := &probedEmbedder{lastErr: errors.New("dial tcp: i/o timeout"), probeErr: errors.New("dial tcp: i/o timeout")}
+	h := &healthServer{store: &fakePinger{}, ef: ef, registry: reg}
+
+	code, report := serveHealth(t, h, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "dial tcp: i/o timeout", report.Embedding.Detail)
+
+	ef.probeErr = nil
+	code, _ = serveHealth(t, h, "/readyz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 2, ef.probes)
+}
+
+func Test_healthz(t *testing.T) {
+	reg := &DocRegistry{}
+	h := &healthServer{store: &fakePinger{err: errors.New("down")}, ef: &probedEmbedder{}, registry: reg}
+
+	code, report := serveHealth(t, h, "/healthz")
+	assert.Equal(t, http.StatusOK, code, "still syncing")
+	assert.Nil(t, report.Store)
+
+	reg.setSynced()
+	reg.recordError(errors.New("watch docs: too many open files"))
+	code, report = serveHealth(t, h, "/healthz")
+	assert.Equal(t, http.StatusServiceUnavailable, code, "watcher stopped")
+	assert.Equal(t, "watch docs: too many open files", report.LastError)
+	assert.NotNil(t, report.LastErrorAt)
+
+	reg.setWatching(true)
+	code, _ = serveHealth(t, h, "/healthz")
+	assert.Equal(t, http.StatusOK, code)
+}
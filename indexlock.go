@@ -0,0 +1,18 @@
+package main
+
+import "errors"
+
+// errIndexLocked is returned when another process holds the index lock
+var errIndexLocked = errors.New("the index is being written by another process")
+
+// indexLock is held by the commands writing the index, serve, sync, forget and
+// import, so that only one of them changes the collections at a time. The other
+// commands only read the index.
+type indexLock struct {
+	unlock func() error
+}
+
+// Unlock releases the lock
+func (l *indexLock) Unlock() error {
+	return l.unlock()
+}
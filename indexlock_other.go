@@ -0,0 +1,24 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// lockIndex takes the index lock without waiting. The lock file is removed on
+// unlock, it has to be removed by hand if the process dies.
+func lockIndex(path string) (*indexLock, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+	if errors.Is(err, os.ErrExist) {
+		return nil, fmt.Errorf("%w (remove %s if no such process is running)", errIndexLocked, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock index: %w", err)
+	}
+	f.Close()
+
+	return &indexLock{unlock: func() error { return os.Remove(path) }}, nil
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_lockIndex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.lock")
+
+	lock, err := lockIndex(path)
+	require.NoError(t, err)
+
+	_, err = lockIndex(path)
+	assert.ErrorIs(t, err, errIndexLocked)
+
+	require.NoError(t, lock.Unlock())
+	lock, err = lockIndex(path)
+	require.NoError(t, err)
+	assert.NoError(t, lock.Unlock())
+}
@@ -0,0 +1,29 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// lockIndex takes the index lock without waiting, the lock is released by the
+// system if the process dies
+func lockIndex(path string) (*indexLock, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open index lock: %w", err)
+	}
+
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, fmt.Errorf("%w (lock file %s)", errIndexLocked, path)
+		}
+		return nil, fmt.Errorf("failed to lock index: %w", err)
+	}
+
+	return &indexLock{unlock: f.Close}, nil
+}
@@ -5,10 +5,12 @@ import (
 	"errors"
 	"flag"
 	"fmt"
-	"io"
 	"log"
 	"log/slog"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/amikos-tech/chroma-go/pkg/embeddings"
@@ -16,19 +18,21 @@ import (
 	openai "github.com/amikos-tech/chroma-go/pkg/embeddings/openai"
 	"github.com/gamma-omg/rag-mcp/docstore"
 	"github.com/gamma-omg/rag-mcp/readers"
-	"github.com/mark3labs/mcp-go/server"
 )
 
-func createEmbeddingFunction(cfg *Config) (embeddings.EmbeddingFunction, error) {
+func createEmbeddingFunction(cfg *Config, logger *slog.Logger) (embeddings.EmbeddingFunction, error) {
 	if cfg.OpenAI != nil {
-		ef, err := openai.NewOpenAIEmbeddingFunction(
-			cfg.OpenAI.ApiKey,
-			openai.WithModel(openai.EmbeddingModel(cfg.OpenAI.Model)))
+		opts := []openai.Option{openai.WithModel(openai.EmbeddingModel(cfg.OpenAI.Model))}
+		if cfg.OpenAI.Dimensions > 0 {
+			opts = append(opts, openai.WithDimensions(cfg.OpenAI.Dimensions))
+		}
+
+		ef, err := newOpenAIEmbedder(cfg.OpenAI.ApiKey, opts...)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create OpenAI embedding function: %w", err)
 		}
 
-		return ef, nil
+		return rateLimit(cfg, ef, "openai", cfg.OpenAI.RateLimit, logger)
 	}
 
 	if cfg.Gemini != nil {
@@ -39,86 +43,185 @@ func createEmbeddingFunction(cfg *Config) (embeddings.EmbeddingFunction, error)
 			return nil, fmt.Errorf("failed to create Gemini embedding function: %w", err)
 		}
 
-		return ef, nil
+		return rateLimit(cfg, ef, "gemini", cfg.Gemini.RateLimit, logger)
 	}
 
 	return nil, errors.New("invalid embeddings provider configuration")
 }
 
-func initDocStore(cfg *Config, reset bool) (*docstore.ChromaStore, error) {
-	ef, err := createEmbeddingFunction(cfg)
+// rateLimit wraps an embedding function in the limits configured for its provider.
+// Tokens are counted with the configured tokenizer, an estimate for providers using
+// another one.
+func rateLimit(cfg *Config, ef embeddings.EmbeddingFunction, provider string, rl RateLimitConfig, logger *slog.Logger) (embeddings.EmbeddingFunction, error) {
+	t, err := newTokenizer(cfg.Tokenizer)
 	if err != nil {
-		return nil, fmt.Errorf("failed to creat emedding function: %w", err)
+		return nil, err
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	store, err := docstore.NewChromaStore(ctx, docstore.ChromaStoreConfig{
-		BaseURL:       cfg.ChromaAddr,
-		EmbeddingFunc: ef,
-		Results:       cfg.Results,
-		RequestSize:   cfg.RequestSize,
-		Reset:         reset,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to initialize Chroma doc store: %w", err)
+	e := &rateLimitedEmbedder{
+		ef:       ef,
+		provider: provider,
+		log:      logger,
+		count:    func(text string) int { return len(t.EncodeOrdinary(text)) },
 	}
+	e.SetLimits(rl)
 
-	return store, nil
+	return e, nil
 }
 
-func main() {
-	reset := flag.Bool("reset", false, "Reinitialized the database from scratch if set")
-	cfgPath := flag.String("config", "cfg/config.yaml", "Configuration file for the MCP server")
-	flag.Parse()
+func registerReaders(reg *DocRegistry, cfg *Config) {
+	for _, c := range cfg.CommandReaders {
+		reg.RegisterPriorityReader(c.Priority, &readers.CommandFileReader{
+			Name:       c.Name,
+			Command:    c.Command,
+			Args:       c.Args,
+			Extensions: c.Extensions,
+			MimeTypes:  c.MimeTypes,
+			Stdin:      c.Input == "stdin",
+			Timeout:    time.Duration(c.TimeoutMs) * time.Millisecond,
+			MaxOutput:  int64(c.MaxOutputKb) << 10,
+			ExitCodes:  c.ExitCodes,
+		})
+	}
 
-	cfg, err := readConfig(*cfgPath)
-	if err != nil {
-		log.Fatal(err)
+	email := &readers.EmailFileReader{Log: reg.log}
+	if cfg.Email.Attachments {
+		// attachments are read like any other file, by the reader selected for them
+		email.Attachments = reg
 	}
 
-	logFile, err := os.OpenFile(cfg.LogFile, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0o644)
-	if err != nil {
-		log.Fatalf("failed to open log file: %s", err)
+	reg.RegisterReader(
+		&readers.TxtFileReader{},
+		email,
+		&readers.NotebookFileReader{Outputs: cfg.Notebook.Outputs},
+		&readers.UniversalFileReader{},
+	)
+}
+
+func createChunkifier(cfg *Config, unit string, size, overlap int) (chunkifier, error) {
+	switch unit {
+	case "", "bytes":
+		return &DefaultChunkfier{
+			chunkSize:    size,
+			chunkOverlap: overlap,
+		}, nil
+	case "tokens":
+		t, err := newTokenizer(cfg.Tokenizer)
+		if err != nil {
+			return nil, err
+		}
+
+		return &TokenChunkifier{
+			tokenizer:    t,
+			chunkSize:    size,
+			chunkOverlap: overlap,
+			maxTokens:    cfg.maxTokens(),
+		}, nil
 	}
-	defer logFile.Close()
 
-	logger := slog.New(slog.NewJSONHandler(io.MultiWriter(logFile, os.Stdout), nil))
+	return nil, fmt.Errorf("invalid chunk unit: %s", unit)
+}
 
-	store, err := initDocStore(cfg, *reset)
-	if err != nil {
-		log.Fatal(err)
+// createChunkProfile builds a chunking profile, the settings affecting the chunks
+// are hashed into the profile id
+func createChunkProfile(cfg *Config, pc ChunkProfileConfig) (chunkProfile, error) {
+	unit := pc.Strategy
+	if unit == "" {
+		unit = cfg.ChunkUnit
 	}
 
-	reg := DocRegistry{
-		log:              logger,
-		root:             cfg.DocRoot,
-		mergeEventsDelay: time.Duration(cfg.MergeEventsMs) * time.Millisecond,
-		storer:           store,
-		chunkifier: &DefaultChunkfier{
-			chunkSize:    cfg.ChunkSize,
-			chunkOverlap: cfg.ChunkOverlap,
-		},
-		readers: []fileReader{&readers.UniversalFileReader{}},
+	c, err := createChunkifier(cfg, unit, pc.Size, pc.Overlap)
+	if err != nil {
+		return chunkProfile{}, fmt.Errorf("chunking profile %s: %w", pc.Name, err)
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	settings := []any{unit, pc.Size, pc.Overlap}
+	if unit == "tokens" {
+		settings = append(settings, cfg.Tokenizer, cfg.maxTokens())
+	}
 
-	go func() {
-		err = reg.Sync(ctx)
+	if pc.ParentSize > 0 {
+		parents, err := createChunkifier(cfg, unit, pc.ParentSize, pc.ParentOverlap)
 		if err != nil {
-			log.Fatal(err)
+			return chunkProfile{}, fmt.Errorf("chunking profile %s: %w", pc.Name, err)
 		}
 
-		err = reg.Watch(ctx)
+		c = &ParentChildChunkifier{parents: parents, children: c}
+		settings = append(settings, pc.ParentSize, pc.ParentOverlap)
+	}
+
+	return chunkProfile{
+		id:         profileID(pc.Name, settings...),
+		chunkifier: c,
+		globs:      pc.Globs,
+		mimeTypes:  pc.MimeTypes,
+	}, nil
+}
+
+func createChunkProfiles(cfg *Config) ([]chunkProfile, error) {
+	res := make([]chunkProfile, 0, len(cfg.ChunkProfiles))
+	for _, pc := range cfg.ChunkProfiles {
+		p, err := createChunkProfile(cfg, pc)
 		if err != nil {
-			log.Fatal(err)
+			return nil, err
 		}
-	}()
 
-	srv := NewRagServer(store, logger)
-	sse := server.NewSSEServer(srv, server.WithBaseURL(fmt.Sprintf("http://%s", cfg.ServerAddr)))
-	log.Println(sse.Start(cfg.ServerAddr))
+		res = append(res, p)
+	}
+
+	return res, nil
+}
+
+// embeddingID names the embedding model configured in cfg
+func embeddingID(cfg *Config) string {
+	switch {
+	case cfg.OpenAI != nil:
+		return fmt.Sprintf("openai/%s/%d", cfg.OpenAI.Model, cfg.OpenAI.Dimensions)
+	case cfg.Gemini != nil:
+		return fmt.Sprintf("gemini/%s", cfg.Gemini.Model)
+	}
+
+	return ""
+}
+
+// createFingerprint describes the configuration of the index built from cfg
+func createFingerprint(cfg *Config, profiles []chunkProfile) indexFingerprint {
+	ids := make([]string, 0, len(profiles))
+	for _, p := range profiles {
+		ids = append(ids, p.id)
+	}
+
+	return indexFingerprint{
+		Embedding: embeddingID(cfg),
+		Chunking:  strings.Join(ids, ","),
+	}
+}
+
+func initDocStore(cfg *Config, ef embeddings.EmbeddingFunction, reset bool, logger *slog.Logger) (*docstore.ChromaStore, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	store, err := docstore.NewChromaStore(ctx, docstore.ChromaStoreConfig{
+		BaseURL:       cfg.ChromaAddr,
+		EmbeddingFunc: ef,
+		Results:       cfg.Results,
+		RequestSize:   cfg.RequestSize,
+		ParentChunks:  cfg.parentChunks(),
+		Reset:         reset,
+		Log:           logger,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize Chroma doc store: %w", err)
+	}
+
+	return store, nil
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, os.Args[1:], os.Stdout); err != nil && !errors.Is(err, flag.ErrHelp) {
+		log.Fatal(err)
+	}
 }
@@ -0,0 +1,115 @@
+// Package metrics holds the Prometheus metrics of the server
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "rag"
+
+// Registry collects the metrics of the server along with Go runtime and process metrics
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+var (
+	DocumentsIngested = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "documents_ingested_total",
+		Help:      "Documents stored in the index, by reader.",
+	}, []string{"reader"})
+
+	DocumentsForgotten = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "documents_forgotten_total",
+		Help:      "Documents removed from the index.",
+	})
+
+	IngestFailures = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ingest_failures_total",
+		Help:      "Documents failed to be read or stored, by reader and stage.",
+	}, []string{"reader", "stage"})
+
+	ChunksIngested = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "chunks_ingested_total",
+		Help:      "Chunks stored in the index.",
+	})
+
+	DocumentChunks = factory.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "document_chunks",
+		Help:      "Number of chunks per ingested document.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+	})
+
+	EmbeddingDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "embedding_request_duration_seconds",
+		Help:      "Latency of embedding requests, by provider.",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 10),
+	}, []string{"provider"})
+
+	EmbeddingErrors = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "embedding_request_errors_total",
+		Help:      "Failed embedding requests, by provider and reason.",
+	}, []string{"provider", "reason"})
+
+	QueueJobs = factory.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "queue_jobs",
+		Help:      "File changes in the ingestion queue, by state.",
+	}, []string{"state"})
+
+	SearchDuration = factory.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "search_duration_seconds",
+		Help:      "Latency of searches in the index.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	SearchResults = factory.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "search_results",
+		Help:      "Number of results returned per search.",
+		Buckets:   prometheus.LinearBuckets(0, 1, 11),
+	})
+
+	ToolCalls = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tool_calls_total",
+		Help:      "MCP tool calls, by tool and status.",
+	}, []string{"tool", "status"})
+
+	ToolDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "tool_duration_seconds",
+		Help:      "Latency of MCP tool calls, by tool.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"tool"})
+
+	FsEvents = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "fs_events_total",
+		Help:      "File system events received from the documents directory, by operation.",
+	}, []string{"op"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,25 @@
+package metrics
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Handler(t *testing.T) {
+	DocumentsIngested.WithLabelValues("TextFileReader").Inc()
+	FsEvents.WithLabelValues("write").Inc()
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	require.Equal(t, 200, rec.Code)
+
+	body, err := io.ReadAll(rec.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), `rag_documents_ingested_total{reader="TextFileReader"} 1`)
+	assert.Contains(t, string(body), `rag_fs_events_total{op="write"} 1`)
+	assert.Contains(t, string(body), "go_goroutines")
+}
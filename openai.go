@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/amikos-tech/chroma-go/pkg/embeddings"
+	openai "github.com/amikos-tech/chroma-go/pkg/embeddings/openai"
+)
+
+// openAIEmbedder embeds texts with the OpenAI API through a client reporting rate
+// limited requests as rateLimitError
+type openAIEmbedder struct {
+	client *openai.OpenAIClient
+}
+
+var _ embeddings.EmbeddingFunction = (*openAIEmbedder)(nil)
+
+func newOpenAIEmbedder(apiKey string, opts ...openai.Option) (*openAIEmbedder, error) {
+	client, err := openai.NewOpenAIClient(apiKey, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	client.Client = &http.Client{Transport: &retryAfterTransport{base: http.DefaultTransport}}
+	return &openAIEmbedder{client: client}, nil
+}
+
+func (e *openAIEmbedder) EmbedDocuments(ctx context.Context, texts []string) ([]embeddings.Embedding, error) {
+	res, err := e.client.CreateEmbedding(ctx, &openai.CreateEmbeddingRequest{
+		Input:      &openai.Input{Texts: texts},
+		Dimensions: e.client.Dimensions,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return embeddings.NewEmbeddingsFromFloat32(openai.ConvertToMatrix(res))
+}
+
+func (e *openAIEmbedder) EmbedQuery(ctx context.Context, text string) (embeddings.Embedding, error) {
+	res, err := e.EmbedDocuments(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(res) == 0 {
+		return nil, errors.New("no embedding returned for query")
+	}
+
+	return res[0], nil
+}
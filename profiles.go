@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"hash/crc32"
+	"path"
+	"strings"
+
+	"github.com/gamma-omg/rag-mcp/readers"
+)
+
+const defaultProfileName = "default"
+
+// chunkProfile is a named chunking configuration applied to the files matching its
+// globs or MIME types. The id identifies both the profile and its settings, so
+// editing a profile re-chunks the documents it applies to.
+type chunkProfile struct {
+	id         string
+	chunkifier chunkifier
+	globs      []string
+	mimeTypes  []string
+}
+
+// profileID combines a profile name with a short hash of its settings
+func profileID(name string, settings ...any) string {
+	hash := crc32.ChecksumIEEE([]byte(fmt.Sprint(settings...)))
+	return fmt.Sprintf("%s@%08x", name, hash)
+}
+
+func (p *chunkProfile) matches(file, mimeType string) bool {
+	if mimeType != "" && readers.MatchMimeType(p.mimeTypes, mimeType) {
+		return true
+	}
+
+	// documents inside archives and containers are matched by their own name
+	// as well as by their full virtual path
+	names := []string{file, path.Base(file)}
+	if i := strings.LastIndex(file, archiveSep); i >= 0 {
+		names = append(names, file[i+len(archiveSep):])
+	}
+
+	for _, g := range p.globs {
+		for _, n := range names {
+			if ok, _ := path.Match(g, n); ok {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// profileFor selects the chunking profile of a document, falling back to the
+// default chunkifier
+func (dr *DocRegistry) profileFor(file, mimeType string) *chunkProfile {
+	file = strings.ReplaceAll(file, "\\", "/")
+	for i := range dr.profiles {
+		if dr.profiles[i].matches(file, mimeType) {
+			return &dr.profiles[i]
+		}
+	}
+
+	return &chunkProfile{
+		id:         dr.defaultProfile,
+		chunkifier: dr.chunkifier,
+	}
+}
+
+// sameProfile reports whether an ingested document was chunked with the profile
+// the document maps to now. Documents ingested before profiles were recorded are
+// assumed to use the default profile only while the chunking the index was built
+// with is unchanged.
+func (dr *DocRegistry) sameProfile(ingested, current string) bool {
+	if ingested == "" {
+		return current == dr.defaultProfile && dr.indexChunking == dr.fingerprint.Chunking
+	}
+
+	return ingested == current
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gamma-omg/rag-mcp/docstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_chunkProfile_matches(t *testing.T) {
+	p := chunkProfile{
+		globs:     []string{"*.go", "src/*.py"},
+		mimeTypes: []string{"application/pdf", "image/*"},
+	}
+
+	assert.True(t, p.matches("cmd/main.go", "text/plain"))
+	assert.True(t, p.matches("src/app.py", "text/plain"))
+	assert.False(t, p.matches("lib/app.py", "text/plain"))
+	assert.True(t, p.matches("bundle.zip!/main.go", "text/plain"))
+	assert.True(t, p.matches("report.txt", "application/pdf"))
+	assert.True(t, p.matches("scan", "image/png"))
+	assert.False(t, p.matches("notes.md", "text/markdown"))
+}
+
+func Test_profileFor(t *testing.T) {
+	code := &DefaultChunkfier{chunkSize: 8}
+	reg := DocRegistry{
+		chunkifier:     &DefaultChunkfier{chunkSize: 16},
+		defaultProfile: "default@1",
+		profiles: []chunkProfile{
+			{id: "code@1", chunkifier: code, globs: []string{"*.go"}},
+		},
+	}
+
+	assert.Equal(t, "code@1", reg.profileFor("main.go", "text/plain").id)
+	assert.Same(t, code, reg.profileFor("main.go", "text/plain").chunkifier)
+	assert.Equal(t, "default@1", reg.profileFor("notes.txt", "text/plain").id)
+}
+
+func Test_profileID(t *testing.T) {
+	assert.Equal(t, profileID("code", "tokens", 256, 32), profileID("code", "tokens", 256, 32))
+	assert.NotEqual(t, profileID("code", "tokens", 256, 32), profileID("code", "tokens", 512, 32))
+}
+
+func Test_Sync_ProfileChange(t *testing.T) {
+	tmp := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tmp, "main.go"), []byte("package main"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(tmp, "notes.txt"), []byte("some notes"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(tmp, "legacy.txt"), []byte("old notes"), 0o644))
+
+	crc := func(s string) uint32 { return crc32.ChecksumIEEE([]byte(s)) }
+	store := &fakeDocStore{
+		ingested: []docstore.IngestedDoc{
+			{File: "main.go", Crc: crc("package main"), Profile: "code@1"},
+			{File: "notes.txt", Crc: crc("some notes"), Profile: "default@1"},
+			{File: "legacy.txt", Crc: crc("old notes")},
+		},
+	}
+
+	reg := DocRegistry{
+		log:            slog.New(slog.NewTextHandler(io.Discard, nil)),
+		root:           tmp,
+		storer:         store,
+		chunkifier:     &DefaultChunkfier{chunkSize: 16},
+		defaultProfile: "default@1",
+		profiles: []chunkProfile{
+			{id: "code@2", chunkifier: &DefaultChunkfier{chunkSize: 4}, globs: []string{"*.go"}},
+		},
+	}
+	reg.RegisterReader(&mockTextReader{})
+
+	require.NoError(t, reg.Sync(context.Background()))
+
+	assert.Equal(t, []string{"main.go"}, store.getIngestCalls())
+	assert.Equal(t, []string{"main.go"}, store.getForgetCalls())
+	assert.Equal(t, "code@2", store.ingestCalls[0].Profile)
+	assert.Len(t, store.ingestCalls[0].Chunks, 3)
+	assert.Len(t, store.ingested, 3)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+const progressLogInterval = 10 * time.Second
+
+// IndexStatus reports the progress of the running sync or rebuild
+type IndexStatus struct {
+	Rebuilding bool      `json:"rebuilding"`
+	Total      int       `json:"total"`
+	Done       int       `json:"done"`
+	Started    time.Time `json:"started"`
+}
+
+type indexProgress struct {
+	mu     sync.Mutex
+	status IndexStatus
+	logged time.Time
+}
+
+// Status returns the progress of the running sync or rebuild, or of the last one
+// if none is running
+func (dr *DocRegistry) Status() IndexStatus {
+	dr.progress.mu.Lock()
+	defer dr.progress.mu.Unlock()
+
+	return dr.progress.status
+}
+
+func (dr *DocRegistry) setRebuilding(rebuilding bool) {
+	dr.progress.mu.Lock()
+	defer dr.progress.mu.Unlock()
+
+	dr.progress.status.Rebuilding = rebuilding
+}
+
+// startProgress starts tracking the ingestion of total documents
+func (dr *DocRegistry) startProgress(total int) {
+	dr.progress.mu.Lock()
+	defer dr.progress.mu.Unlock()
+
+	now := time.Now()
+	dr.progress.status.Total = total
+	dr.progress.status.Done = 0
+	dr.progress.status.Started = now
+	dr.progress.logged = now
+}
+
+// stepProgress records an ingested document, logging the progress periodically
+func (dr *DocRegistry) stepProgress() {
+	dr.progress.mu.Lock()
+	defer dr.progress.mu.Unlock()
+
+	s := &dr.progress.status
+	s.Done++
+	if s.Done < s.Total && time.Since(dr.progress.logged) < progressLogInterval {
+		return
+	}
+
+	dr.progress.logged = time.Now()
+	dr.log.Info("ingestion progress",
+		"done", s.Done,
+		"total", s.Total,
+		"rebuilding", s.Rebuilding,
+		"elapsed", time.Since(s.Started).Round(time.Second).String())
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gamma-omg/rag-mcp/metrics"
+)
+
+type jobOp string
+
+const (
+	jobReplace jobOp = "replace"
+	jobForget  jobOp = "forget"
+	jobArchive jobOp = "archive"
+)
+
+// queueJob is a pending change of a file, identified by its path
+type queueJob struct {
+	ID          int64     `json:"id"`
+	Path        string    `json:"path"`
+	Op          jobOp     `json:"op"`
+	Attempts    int       `json:"attempts"`
+	Queued      time.Time `json:"queued"`
+	NextAttempt time.Time `json:"next_attempt"`
+	LastError   string    `json:"last_error,omitempty"`
+}
+
+type queueState struct {
+	LastID  int64       `json:"last_id"`
+	Pending []*queueJob `json:"pending"`
+	Dead    []*queueJob `json:"dead"`
+}
+
+type queueConfig struct {
+	File        string
+	MaxAttempts int
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+}
+
+// ingestQueue is a persistent queue of file changes waiting to be applied to the
+// store. Failed jobs are retried with exponential backoff, jobs failing
+// MaxAttempts times are moved to a dead-letter list until retried manually.
+type ingestQueue struct {
+	cfg  queueConfig
+	log  *slog.Logger
+	wake chan struct{}
+
+	mu    sync.Mutex
+	state queueState
+}
+
+func openQueue(cfg queueConfig, log *slog.Logger) (*ingestQueue, error) {
+	q := &ingestQueue{
+		cfg:  cfg,
+		log:  log,
+		wake: make(chan struct{}, 1),
+	}
+
+	var err error
+	q.state, err = readQueueState(cfg.File)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics.QueueJobs.WithLabelValues("pending").Set(float64(len(q.state.Pending)))
+	metrics.QueueJobs.WithLabelValues("dead").Set(float64(len(q.state.Dead)))
+	return q, nil
+}
+
+// readQueueState reads the jobs saved in a queue file, a missing file holds no jobs
+func readQueueState(file string) (queueState, error) {
+	var state queueState
+	buf, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, fmt.Errorf("failed to read queue file: %w", err)
+	}
+
+	if err := json.Unmarshal(buf, &state); err != nil {
+		return state, fmt.Errorf("failed to parse queue file %s: %w", file, err)
+	}
+
+	return state, nil
+}
+
+// Push queues a change of a file, replacing the change queued for it before, if any
+func (q *ingestQueue) Push(path string, op jobOp) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	q.state.LastID++
+	job := &queueJob{
+		ID:          q.state.LastID,
+		Path:        path,
+		Op:          op,
+		Queued:      now,
+		NextAttempt: now,
+	}
+
+	q.state.Pending = slices.DeleteFunc(q.state.Pending, func(j *queueJob) bool { return j.Path == path })
+	q.state.Dead = slices.DeleteFunc(q.state.Dead, func(j *queueJob) bool { return j.Path == path })
+	q.state.Pending = append(q.state.Pending, job)
+
+	err := q.save()
+	q.notify()
+	return err
+}
+
+// Jobs returns copies of the pending and the dead jobs
+func (q *ingestQueue) Jobs() (pending, dead []queueJob) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, j := range q.state.Pending {
+		pending = append(pending, *j)
+	}
+	for _, j := range q.state.Dead {
+		dead = append(dead, *j)
+	}
+
+	return pending, dead
+}
+
+// Retry moves the dead job of a file back to the queue, or all dead jobs if path
+// is empty, and returns the number of jobs requeued
+func (q *ingestQueue) Retry(path string) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	n := 0
+	q.state.Dead = slices.DeleteFunc(q.state.Dead, func(j *queueJob) bool {
+		if path != "" && j.Path != path {
+			return false
+		}
+
+		j.Attempts = 0
+		j.NextAttempt = now
+		q.state.Pending = append(q.state.Pending, j)
+		n++
+		return true
+	})
+
+	if n == 0 {
+		return 0, nil
+	}
+
+	err := q.save()
+	q.notify()
+	return n, err
+}
+
+// Run applies the queued jobs with handle until the context is cancelled. Jobs stay
+// in the queue file until they succeed, so they survive restarts.
+func (q *ingestQueue) Run(ctx context.Context, handle func(ctx context.Context, path string, op jobOp) error) {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		job, wait := q.next()
+		if job != nil {
+			err := handle(ctx, job.Path, job.Op)
+			if ctx.Err() != nil {
+				return
+			}
+
+			q.finish(job, err)
+			continue
+		}
+
+		timer.Reset(wait)
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// next returns a copy of the first due job, or the time until the next one is due
+func (q *ingestQueue) next() (*queueJob, time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	wait := time.Hour
+	for _, j := range q.state.Pending {
+		if !j.NextAttempt.After(now) {
+			job := *j
+			return &job, 0
+		}
+
+		wait = min(wait, j.NextAttempt.Sub(now))
+	}
+
+	return nil, wait
+}
+
+// finish removes a succeeded job or schedules its retry. A job replaced by a newer
+// change of the same file while it was running is left alone.
+func (q *ingestQueue) finish(job *queueJob, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	i := slices.IndexFunc(q.state.Pending, func(j *queueJob) bool { return j.ID == job.ID })
+	if i < 0 {
+		return
+	}
+
+	j := q.state.Pending[i]
+	switch {
+	case err == nil:
+		q.state.Pending = slices.Delete(q.state.Pending, i, i+1)
+	case j.Attempts+1 >= q.cfg.MaxAttempts:
+		j.Attempts++
+		j.LastError = err.Error()
+		q.state.Pending = slices.Delete(q.state.Pending, i, i+1)
+		q.state.Dead = append(q.state.Dead, j)
+		q.log.Error("ingestion job failed permanently", "file", j.Path, "op", j.Op, "attempts", j.Attempts, "error", err)
+	default:
+		j.Attempts++
+		j.LastError = err.Error()
+		delay := q.backoff(j.Attempts)
+		j.NextAttempt = time.Now().Add(delay)
+		q.log.Warn("ingestion job failed, retrying", "file", j.Path, "op", j.Op, "attempts", j.Attempts, "retry_in", delay.String(), "error", err)
+	}
+
+	if err := q.save(); err != nil {
+		q.log.Error("failed to save ingestion queue", "error", err)
+	}
+}
+
+// backoff returns the delay before the next attempt of a job failed attempts times
+func (q *ingestQueue) backoff(attempts int) time.Duration {
+	delay := q.cfg.Backoff
+	for i := 1; i < attempts && delay < q.cfg.MaxBackoff; i++ {
+		delay *= 2
+	}
+
+	return min(delay, q.cfg.MaxBackoff)
+}
+
+func (q *ingestQueue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// save writes the queue to a temporary file renamed over the queue file, so that a
+// crash never leaves a truncated queue behind
+func (q *ingestQueue) save() error {
+	metrics.QueueJobs.WithLabelValues("pending").Set(float64(len(q.state.Pending)))
+	metrics.QueueJobs.WithLabelValues("dead").Set(float64(len(q.state.Dead)))
+
+	buf, err := json.MarshalIndent(q.state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode queue: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(q.cfg.File), filepath.Base(q.cfg.File)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create queue file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	// the file and the rename are flushed to disk, so that a power loss leaves either
+	// the previous or the new queue
+	if _, err := tmp.Write(buf); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write queue file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write queue file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write queue file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), q.cfg.File); err != nil {
+		return fmt.Errorf("failed to replace queue file: %w", err)
+	}
+	if err := syncDir(filepath.Dir(q.cfg.File)); err != nil {
+		return fmt.Errorf("failed to replace queue file: %w", err)
+	}
+
+	return nil
+}
+
+// syncDir flushes the entries of a directory to disk
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/gamma-omg/rag-mcp/docstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestQueue(t *testing.T, file string) *ingestQueue {
+	t.Helper()
+
+	q, err := openQueue(queueConfig{
+		File:        file,
+		MaxAttempts: 3,
+		Backoff:     10 * time.Millisecond,
+		MaxBackoff:  40 * time.Millisecond,
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.NoError(t, err)
+	return q
+}
+
+// runQueue runs the queue until the returned function is called
+func runQueue(q *ingestQueue, handle func(ctx context.Context, path string, op jobOp) error) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		q.Run(ctx, handle)
+	}()
+
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+func Test_ingestQueue_Run(t *testing.T) {
+	q := newTestQueue(t, filepath.Join(t.TempDir(), "queue.json"))
+
+	var mu sync.Mutex
+	var applied []string
+	stop := runQueue(q, func(ctx context.Context, path string, op jobOp) error {
+		mu.Lock()
+		defer mu.Unlock()
+		applied = append(applied, string(op)+" "+path)
+		return nil
+	})
+	defer stop()
+
+	require.NoError(t, q.Push("docs/f1.txt", jobReplace))
+	require.NoError(t, q.Push("docs/f2.txt", jobForget))
+
+	assert.Eventually(t, func() bool {
+		pending, _ := q.Jobs()
+		return len(pending) == 0
+	}, time.Second, 5*time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"replace docs/f1.txt", "forget docs/f2.txt"}, applied)
+}
+
+func Test_ingestQueue_RetriesThenDeadLetters(t *testing.T) {
+	q := newTestQueue(t, filepath.Join(t.TempDir(), "queue.json"))
+
+	var mu sync.Mutex
+	attempts := 0
+	stop := runQueue(q, func(ctx context.Context, path string, op jobOp) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		return errors.New("429 too many requests")
+	})
+	defer stop()
+
+	require.NoError(t, q.Push("docs/f1.txt", jobReplace))
+
+	assert.Eventually(t, func() bool {
+		_, dead := q.Jobs()
+		return len(dead) == 1
+	}, time.Second, 5*time.Millisecond)
+
+	pending, dead := q.Jobs()
+	assert.Empty(t, pending)
+	assert.Equal(t, "docs/f1.txt", dead[0].Path)
+	assert.Equal(t, 3, dead[0].Attempts)
+	assert.Equal(t, "429 too many requests", dead[0].LastError)
+
+	mu.Lock()
+	assert.Equal(t, 3, attempts)
+	mu.Unlock()
+}
+
+func Test_ingestQueue_Retry(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "queue.json")
+	q := newTestQueue(t, file)
+
+	fail := true
+	var mu sync.Mutex
+	stop := runQueue(q, func(ctx context.Context, path string, op jobOp) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if fail {
+			return errors.New("embedding failed")
+		}
+		return nil
+	})
+	defer stop()
+
+	require.NoError(t, q.Push("docs/f1.txt", jobReplace))
+	assert.Eventually(t, func() bool {
+		_, dead := q.Jobs()
+		return len(dead) == 1
+	}, time.Second, 5*time.Millisecond)
+
+	mu.Lock()
+	fail = false
+	mu.Unlock()
+
+	n, err := q.Retry("docs/other.txt")
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	n, err = q.Retry("")
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	assert.Eventually(t, func() bool {
+		pending, dead := q.Jobs()
+		return len(pending) == 0 && len(dead) == 0
+	}, time.Second, 5*time.Millisecond)
+}
+
+func Test_ingestQueue_Persists(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "queue.json")
+	q := newTestQueue(t, file)
+
+	require.NoError(t, q.Push("docs/f1.txt", jobReplace))
+	require.NoError(t, q.Push("docs/f2.txt", jobReplace))
+	require.NoError(t, q.Push("docs/f1.txt", jobForget))
+
+	reopened := newTestQueue(t, file)
+	pending, dead := reopened.Jobs()
+	assert.Empty(t, dead)
+	require.Len(t, pending, 2)
+	assert.Equal(t, "docs/f2.txt", pending[0].Path)
+	assert.Equal(t, "docs/f1.txt", pending[1].Path)
+	assert.Equal(t, jobForget, pending[1].Op)
+
+	require.NoError(t, reopened.Push("docs/f3.txt", jobReplace))
+	pending, _ = reopened.Jobs()
+	assert.Greater(t, pending[2].ID, pending[1].ID)
+}
+
+func Test_ingestQueue_backoff(t *testing.T) {
+	q := ingestQueue{cfg: queueConfig{Backoff: time.Second, MaxBackoff: 5 * time.Second}}
+
+	assert.Equal(t, time.Second, q.backoff(1))
+	assert.Equal(t, 2*time.Second, q.backoff(2))
+	assert.Equal(t, 4*time.Second, q.backoff(3))
+	assert.Equal(t, 5*time.Second, q.backoff(4))
+	assert.Equal(t, 5*time.Second, q.backoff(30))
+}
+
+func Test_processFsEvent_Queued(t *testing.T) {
+	tmp := t.TempDir()
+	q := newTestQueue(t, filepath.Join(tmp, "queue.json"))
+	store := &fakeDocStore{}
+	reg := DocRegistry{
+		log:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		root:   tmp,
+		storer: store,
+		queue:  q,
+	}
+
+	reg.processFsEvent(fsnotify.Event{Name: filepath.Join(tmp, "f1.txt"), Op: fsnotify.Write})
+	reg.processFsEvent(fsnotify.Event{Name: filepath.Join(tmp, "f2.txt"), Op: fsnotify.Remove})
+
+	pending, _ := q.Jobs()
+	require.Len(t, pending, 2)
+	assert.Equal(t, jobReplace, pending[0].Op)
+	assert.Equal(t, jobForget, pending[1].Op)
+	assert.Empty(t, store.ops)
+}
+
+func Test_applyChange_MissingFile(t *testing.T) {
+	tmp := t.TempDir()
+	store := &fakeDocStore{
+		ingested: []docstore.IngestedDoc{{File: "f1.txt", Crc: 1}},
+	}
+	reg := DocRegistry{
+		log:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		root:   tmp,
+		storer: store,
+	}
+
+	require.NoError(t, reg.applyChange(context.Background(), filepath.Join(tmp, "f1.txt"), jobReplace))
+	assert.Equal(t, []string{"forget f1.txt"}, store.ops)
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/amikos-tech/chroma-go/pkg/embeddings"
+	"github.com/gamma-omg/rag-mcp/metrics"
+	"github.com/gamma-omg/rag-mcp/tracing"
+	"github.com/googleapis/gax-go/v2/apierror"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc/codes"
+)
+
+const (
+	defaultRateLimitRetries = 5
+	defaultRateLimitBackoff = time.Second
+)
+
+// rateLimitError is returned for embedding requests rejected by the provider for
+// exceeding its rate limits
+type rateLimitError struct {
+	status     string
+	retryAfter time.Duration
+	body       string
+}
+
+func (e *rateLimitError) Error() string {
+	return fmt.Sprintf("rate limited: %s, %s", e.status, e.body)
+}
+
+// retryAfterTransport turns rate limited responses into rateLimitError, keeping the
+// delay requested by the Retry-After headers. Other errors, such as outages reported
+// as 503, are left to the provider client and count as failures.
+type retryAfterTransport struct {
+	base http.RoundTripper
+}
+
+func (t *retryAfterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusTooManyRequests {
+		return resp, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return nil, &rateLimitError{
+		status:     resp.Status,
+		retryAfter: parseRetryAfter(resp.Header, time.Now()),
+		body:       string(body),
+	}
+}
+
+// parseRetryAfter reads the delay requested by a response, in milliseconds from
+// retry-after-ms, or in seconds or as a date from Retry-After
+func parseRetryAfter(h http.Header, now time.Time) time.Duration {
+	if ms, err := strconv.ParseFloat(h.Get("Retry-After-Ms"), 64); err == nil && ms > 0 {
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+
+	v := h.Get("Retry-After")
+	if secs, err := strconv.ParseFloat(v, 64); err == nil && secs > 0 {
+		return time.Duration(secs * float64(time.Second))
+	}
+	if at, err := http.ParseTime(v); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+
+	return 0
+}
+
+// retryDelay reports whether err rejects a request for exceeding rate limits and the
+// delay requested by the provider, zero if none
+func retryDelay(err error) (time.Duration, bool) {
+	var rl *rateLimitError
+	if errors.As(err, &rl) {
+		return rl.retryAfter, true
+	}
+
+	if ae, ok := apierror.FromError(err); ok {
+		if ae.GRPCStatus().Code() != codes.ResourceExhausted && ae.HTTPCode() != http.StatusTooManyRequests {
+			return 0, false
+		}
+
+		return ae.Details().RetryInfo.GetRetryDelay().AsDuration(), true
+	}
+
+	return 0, false
+}
+
+// rateLimitedEmbedder keeps an embedding function within the requests and tokens per
+// minute allowed by the provider. Documents are embedded in batches bounded by
+// batchSize texts and batchTokens tokens, rate limited requests are retried after the
+// delay requested by the provider, or with exponential backoff.
+type rateLimitedEmbedder struct {
+	ef       embeddings.EmbeddingFunction
+	provider string
+	log      *slog.Logger
+	count    func(text string) int
+
+	mu sync.Mutex
+	// the limits below may be changed by SetLimits while requests are sent
+	requests    *rate.Limiter
+	tokens      *rate.Limiter
+	batchSize   int
+	batchTokens int
+	maxRetries  int
+	backoff     time.Duration
+	pausedUntil time.Time
+	// lastErr is the error of the last request failing for reasons other than
+	// rate limits, reset by the next successful request
+	lastErr error
+}
+
+var _ embeddings.EmbeddingFunction = (*rateLimitedEmbedder)(nil)
+
+// perMinute returns a token bucket refilled with limit tokens a minute, nil if limit
+// is not positive
+func perMinute(limit int) *rate.Limiter {
+	if limit <= 0 {
+		return nil
+	}
+
+	return rate.NewLimiter(rate.Limit(float64(limit)/60), limit)
+}
+
+func (e *rateLimitedEmbedder) EmbedDocuments(ctx context.Context, texts []string) ([]embeddings.Embedding, error) {
+	res := make([]embeddings.Embedding, 0, len(texts))
+	for len(texts) > 0 {
+		n, tokens := e.nextBatch(texts)
+
+		var batch []embeddings.Embedding
+		err := e.call(ctx, tokens, func() (err error) {
+			batch, err = e.ef.EmbedDocuments(ctx, texts[:n])
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, batch...)
+		texts = texts[n:]
+	}
+
+	return res, nil
+}
+
+func (e *rateLimitedEmbedder) EmbedQuery(ctx context.Context, text string) (embeddings.Embedding, error) {
+	var res embeddings.Embedding
+	err := e.call(ctx, e.count(text), func() (err error) {
+		res, err = e.ef.EmbedQuery(ctx, text)
+		return err
+	})
+
+	return res, err
+}
+
+// SetLimits applies new rate limits, the buckets of the previous ones are dropped
+func (e *rateLimitedEmbedder) SetLimits(rl RateLimitConfig) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.requests = perMinute(rl.RequestsPerMinute)
+	e.tokens = perMinute(rl.TokensPerMinute)
+	e.batchSize = rl.BatchSize
+	e.batchTokens = rl.BatchTokens
+	e.maxRetries = rl.MaxRetries
+	// retrying at once is pointless, a zero backoff falls back to the default
+	e.backoff = cmp.Or(time.Duration(rl.BackoffMs)*time.Millisecond, defaultRateLimitBackoff)
+}
+
+// nextBatch returns the number of texts embedded by the next request and their tokens
+func (e *rateLimitedEmbedder) nextBatch(texts []string) (int, int) {
+	e.mu.Lock()
+	batchSize, batchTokens := e.batchSize, e.batchTokens
+	e.mu.Unlock()
+
+	n, tokens := 0, 0
+	for _, t := range texts {
+		c := e.count(t)
+		if n > 0 && (batchSize > 0 && n >= batchSize || batchTokens > 0 && tokens+c > batchTokens) {
+			break
+		}
+
+		n++
+		tokens += c
+	}
+
+	return n, tokens
+}
+
+func (e *rateLimitedEmbedder) call(ctx context.Context, tokens int, fn func() error) (err error) {
+	ctx, span := tracing.Start(ctx, "embed",
+		attribute.String("embedding.provider", e.provider),
+		attribute.Int("embedding.tokens", tokens),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	for attempt := 0; ; attempt++ {
+		if err := e.wait(ctx, tokens); err != nil {
+			return err
+		}
+
+		start := time.Now()
+		err := fn()
+		metrics.EmbeddingDuration.WithLabelValues(e.provider).Observe(time.Since(start).Seconds())
+		delay, limited := retryDelay(err)
+		if limited {
+			// a throttled provider is reachable
+			e.setLastErr(nil)
+		} else {
+			e.setLastErr(err)
+		}
+		if err == nil {
+			return nil
+		}
+
+		reason := "error"
+		if limited {
+			reason = "rate_limited"
+		}
+		metrics.EmbeddingErrors.WithLabelValues(e.provider, reason).Inc()
+
+		e.mu.Lock()
+		maxRetries, backoff := e.maxRetries, e.backoff
+		e.mu.Unlock()
+		if !limited || attempt >= maxRetries {
+			return err
+		}
+
+		if delay <= 0 {
+			delay = backoff << attempt
+		}
+
+		span.AddEvent("rate limited", trace.WithAttributes(attribute.Int64("retry_in_ms", delay.Milliseconds())))
+		e.log.WarnContext(ctx, "embedding request rate limited", "retry_in", delay.String(), "attempt", attempt+1, "error", err)
+		e.pause(delay)
+	}
+}
+
+// wait blocks until a request of the given number of tokens fits the rate limits
+func (e *rateLimitedEmbedder) wait(ctx context.Context, tokens int) error {
+	e.mu.Lock()
+	paused := time.Until(e.pausedUntil)
+	requests, tokenLimit := e.requests, e.tokens
+	e.mu.Unlock()
+
+	if paused > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(paused):
+		}
+	}
+
+	if requests != nil {
+		if err := requests.Wait(ctx); err != nil {
+			return err
+		}
+	}
+
+	if tokenLimit != nil && tokens > 0 {
+		// a request larger than the bucket waits for the bucket to be full
+		if err := tokenLimit.WaitN(ctx, min(tokens, tokenLimit.Burst())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// LastError returns the error of the last request failing for reasons other than
+// rate limits, nil if the provider answered the last request
+func (e *rateLimitedEmbedder) LastError() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.lastErr
+}
+
+func (e *rateLimitedEmbedder) setLastErr(err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.lastErr = err
+}
+
+// pause holds back all requests for the given delay
+func (e *rateLimitedEmbedder) pause(delay time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	until := time.Now().Add(delay)
+	if until.After(e.pausedUntil) {
+		e.pausedUntil = until
+	}
+}
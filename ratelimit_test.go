@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/amikos-tech/chroma-go/pkg/embeddings"
+	openai "github.com/amikos-tech/chroma-go/pkg/embeddings/openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// fakeEmbedder records the batches it embeds and fails with the queued errors first
+type fakeEmbedder struct {
+	mu      sync.Mutex
+	batches [][]string
+	errs    []error
+}
+
+func (e *fakeEmbedder) EmbedDocuments(ctx context.Context, texts []string) ([]embeddings.Embedding, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if len(e.errs) > 0 {
+		err := e.errs[0]
+		e.errs = e.errs[1:]
+		return nil, err
+	}
+
+	e.batches = append(e.batches, texts)
+	res := make([]embeddings.Embedding, len(texts))
+	for i := range texts {
+		res[i] = embeddings.NewEmbeddingFromFloat32([]float32{float32(i)})
+	}
+	return res, nil
+}
+
+func (e *fakeEmbedder) EmbedQuery(ctx context.Context, text string) (embeddings.Embedding, error) {
+	res, err := e.EmbedDocuments(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	return res[0], nil
+}
+
+func newTestEmbedder(ef embeddings.EmbeddingFunction) *rateLimitedEmbedder {
+	return &rateLimitedEmbedder{
+		ef:         ef,
+		log:        slog.New(slog.NewTextHandler(io.Discard, nil)),
+		count:      func(text string) int { return len(strings.Fields(text)) },
+		maxRetries: 2,
+		backoff:    time.Millisecond,
+	}
+}
+
+func Test_rateLimitedEmbedder_Batches(t *testing.T) {
+	ef := &fakeEmbedder{}
+	e := newTestEmbedder(ef)
+	e.batchSize = 3
+	e.batchTokens = 4
+
+	res, err := e.EmbedDocuments(context.Background(), []string{"a", "b", "c", "d", "e f g", "h i j k l"})
+	require.NoError(t, err)
+	assert.Len(t, res, 6)
+	assert.Equal(t, [][]string{{"a", "b", "c"}, {"d", "e f g"}, {"h i j k l"}}, ef.batches)
+}
+
+func Test_rateLimitedEmbedder_RetriesRateLimited(t *testing.T) {
+	ef := &fakeEmbedder{errs: []error{
+		&rateLimitError{status: "429 Too Many Requests", retryAfter: 20 * time.Millisecond},
+		&rateLimitError{status: "429 Too Many Requests"},
+	}}
+	e := newTestEmbedder(ef)
+
+	start := time.Now()
+	_, err := e.EmbedQuery(context.Background(), "hello")
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+	assert.Equal(t, [][]string{{"hello"}}, ef.batches)
+}
+
+func Test_rateLimitedEmbedder_GivesUp(t *testing.T) {
+	limited := &rateLimitError{status: "429 Too Many Requests"}
+	ef := &fakeEmbedder{errs: []error{limited, limited, limited}}
+	e := newTestEmbedder(ef)
+
+	_, err := e.EmbedDocuments(context.Background(), []string{"hello"})
+	assert.ErrorIs(t, err, limited)
+	assert.Empty(t, ef.batches)
+}
+
+func Test_rateLimitedEmbedder_NoRetries(t *testing.T) {
+	limited := &rateLimitError{status: "429 Too Many Requests"}
+	ef := &fakeEmbedder{errs: []error{limited, limited}}
+	e := newTestEmbedder(ef)
+	e.SetLimits(RateLimitConfig{MaxRetries: 0})
+
+	_, err := e.EmbedQuery(context.Background(), "hello")
+	assert.ErrorIs(t, err, limited)
+	assert.Len(t, ef.errs, 1)
+}
+
+func Test_retryAfterTransport_Unavailable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: &retryAfterTransport{base: http.DefaultTransport}}
+	resp, err := client.Get(srv.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}
+
+func Test_rateLimitedEmbedder_OtherErrorsNotRetried(t *testing.T) {
+	ef := &fakeEmbedder{errs: []error{errors.New("invalid api key")}}
+	e := newTestEmbedder(ef)
+
+	_, err := e.EmbedDocuments(context.Background(), []string{"hello"})
+	assert.EqualError(t, err, "invalid api key")
+	assert.Empty(t, ef.errs)
+	assert.EqualError(t, e.LastError(), "invalid api key")
+
+	_, err = e.EmbedQuery(context.Background(), "hello")
+	require.NoError(t, err)
+	assert.NoError(t, e.LastError())
+}
+
+func Test_rateLimitedEmbedder_TokensPerMinute(t *testing.T) {
+	e := newTestEmbedder(&fakeEmbedder{})
+	e.tokens = perMinute(60)
+
+	// the bucket starts full, the next token comes in after a second
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	_, err := e.EmbedDocuments(ctx, []string{strings.Repeat("word ", 60)})
+	require.NoError(t, err)
+
+	_, err = e.EmbedDocuments(ctx, []string{"one more"})
+	assert.Error(t, err)
+}
+
+func Test_parseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	header := func(kv ...string) http.Header {
+		h := http.Header{}
+		for i := 0; i < len(kv); i += 2 {
+			h.Set(kv[i], kv[i+1])
+		}
+		return h
+	}
+
+	assert.Equal(t, 2*time.Second, parseRetryAfter(header("Retry-After", "2"), now))
+	assert.Equal(t, 1500*time.Millisecond, parseRetryAfter(header("Retry-After-Ms", "1500", "Retry-After", "2"), now))
+	assert.Equal(t, 30*time.Second, parseRetryAfter(header("Retry-After", "Wed, 01 Jan 2025 12:00:30 GMT"), now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter(header(), now))
+}
+
+func Test_retryDelay_Grpc(t *testing.T) {
+	st, err := status.New(codes.ResourceExhausted, "quota exceeded").
+		WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(3 * time.Second)})
+	require.NoError(t, err)
+
+	delay, limited := retryDelay(fmt.Errorf("embed: %w", st.Err()))
+	assert.True(t, limited)
+	assert.Equal(t, 3*time.Second, delay)
+
+	_, limited = retryDelay(status.Error(codes.InvalidArgument, "bad request"))
+	assert.False(t, limited)
+}
+
+func Test_openAIEmbedder(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprint(w, `{"error":{"message":"Rate limit reached"}}`)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		assert.Contains(t, string(body), `"dimensions":256`)
+		fmt.Fprint(w, `{"data":[{"index":0,"embedding":[0.5,0.25]}]}`)
+	}))
+	defer srv.Close()
+
+	e, err := newOpenAIEmbedder("key", openai.WithBaseURL(srv.URL), openai.WithDimensions(256))
+	require.NoError(t, err)
+
+	_, err = e.EmbedQuery(context.Background(), "hello")
+	delay, limited := retryDelay(err)
+	assert.True(t, limited)
+	assert.Equal(t, 7*time.Second, delay)
+
+	emb, err := e.EmbedQuery(context.Background(), "hello")
+	require.NoError(t, err)
+	assert.Equal(t, []float32{0.5, 0.25}, emb.ContentAsFloat32())
+}
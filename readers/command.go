@@ -0,0 +1,192 @@
+package readers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// FileArg is replaced with the path of the file being read in CommandFileReader.Args
+const FileArg = "{file}"
+
+const maxStderr = 4096
+
+// commandWaitDelay bounds the wait for the output of processes left behind by a
+// command, such as background children holding stdout open
+const commandWaitDelay = time.Second
+
+var errOutputTooLarge = errors.New("command output exceeds size limit")
+
+// CommandFileReader converts files to text with an external command such as pandoc
+// or an OCR tool. The file is passed either as an argument, where Args contain
+// FileArg, or through stdin. The text is read from stdout.
+type CommandFileReader struct {
+	Name       string
+	Command    string
+	Args       []string
+	Extensions []string
+	MimeTypes  []string
+	// Stdin pipes the file content to the command instead of passing its path
+	Stdin bool
+	// Timeout kills the command if it runs longer, zero means no timeout
+	Timeout time.Duration
+	// MaxOutput limits the size of stdout in bytes, zero means no limit
+	MaxOutput int64
+	// ExitCodes lists exit codes treated as success, defaults to 0
+	ExitCodes []int
+}
+
+func (r *CommandFileReader) CanRead(path string) bool {
+	return r.CanReadExtension(path) || r.CanReadMIME(mimeHint(path))
+}
+
+// CanReadExtension reports whether the file is selected by its extension, whatever
+// its detected type
+func (r *CommandFileReader) CanReadExtension(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == "" {
+		return false
+	}
+
+	for _, e := range r.Extensions {
+		if strings.ToLower("."+strings.TrimPrefix(e, ".")) == ext {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *CommandFileReader) CanReadMIME(mimeType string) bool {
+	return mimeType != "" && MatchMimeType(r.MimeTypes, mimeType)
+}
+
+func (r *CommandFileReader) ReadMIME(path, mimeType string) ([]Document, error) {
+	text, err := r.ReadText(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return []Document{{Text: text}}, nil
+}
+
+func (r *CommandFileReader) ReadText(path string) (string, error) {
+	ctx := context.Background()
+	if r.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+
+	args := make([]string, len(r.Args))
+	for i, a := range r.Args {
+		args[i] = strings.ReplaceAll(a, FileArg, path)
+	}
+
+	cmd := exec.CommandContext(ctx, r.Command, args...)
+	stdout := &limitedBuffer{limit: r.MaxOutput}
+	stderr := &limitedBuffer{limit: maxStderr, truncate: true}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.WaitDelay = commandWaitDelay
+
+	if r.Stdin {
+		f, err := os.Open(path)
+		if err != nil {
+			return "", fmt.Errorf("%s: failed to open input: %w", r.Name, err)
+		}
+		defer f.Close()
+
+		cmd.Stdin = f
+	}
+
+	err := cmd.Run()
+	if errors.Is(err, exec.ErrWaitDelay) {
+		// the command itself succeeded, only its leftover processes were cut off
+		err = nil
+	}
+	if ctx.Err() != nil {
+		return "", fmt.Errorf("%s: command timed out after %s", r.Name, r.Timeout)
+	}
+	if stdout.exceeded {
+		return "", fmt.Errorf("%s: %w (%d bytes)", r.Name, errOutputTooLarge, r.MaxOutput)
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if !r.acceptsExitCode(exitErr.ExitCode()) {
+			return "", fmt.Errorf("%s: command exited with code %d: %s",
+				r.Name, exitErr.ExitCode(), strings.TrimSpace(stderr.String()))
+		}
+	} else if err != nil {
+		return "", fmt.Errorf("%s: failed to run command: %w", r.Name, err)
+	}
+
+	return stdout.String(), nil
+}
+
+func (r *CommandFileReader) acceptsExitCode(code int) bool {
+	if len(r.ExitCodes) == 0 {
+		return code == 0
+	}
+
+	return slices.Contains(r.ExitCodes, code)
+}
+
+// MatchMimeType reports whether mimeType matches any of the patterns,
+// patterns may use wildcard subtypes such as image/*
+func MatchMimeType(patterns []string, mimeType string) bool {
+	for _, p := range patterns {
+		p = strings.ToLower(p)
+		if p == mimeType {
+			return true
+		}
+
+		if prefix, ok := strings.CutSuffix(p, "/*"); ok && strings.HasPrefix(mimeType, prefix+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// limitedBuffer collects up to limit bytes. Once the limit is reached it either
+// drops the rest of the data or fails the write, stopping the producer.
+type limitedBuffer struct {
+	buf      bytes.Buffer
+	limit    int64
+	truncate bool
+	exceeded bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.limit <= 0 {
+		return b.buf.Write(p)
+	}
+
+	room := b.limit - int64(b.buf.Len())
+	if int64(len(p)) <= room {
+		return b.buf.Write(p)
+	}
+
+	b.exceeded = true
+	if room > 0 {
+		b.buf.Write(p[:room])
+	}
+	if b.truncate {
+		return len(p), nil
+	}
+
+	return int(max(room, 0)), errOutputTooLarge
+}
+
+func (b *limitedBuffer) String() string {
+	return b.buf.String()
+}
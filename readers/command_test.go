@@ -0,0 +1,107 @@
+package readers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_CommandFileReader_CanRead(t *testing.T) {
+	r := CommandFileReader{
+		Extensions: []string{"rst", ".ADOC"},
+		MimeTypes:  []string{"image/*", "application/json"},
+	}
+
+	assert.True(t, r.CanRead("docs/readme.rst"))
+	assert.True(t, r.CanRead("docs/readme.adoc"))
+	assert.True(t, r.CanRead("scans/page.PNG"))
+	assert.True(t, r.CanRead("data/config.json"))
+	assert.False(t, r.CanRead("docs/readme.txt"))
+	assert.False(t, r.CanRead("docs/README"))
+
+	assert.True(t, r.CanReadMIME("image/tiff"))
+	assert.True(t, r.CanReadMIME("application/json"))
+	assert.False(t, r.CanReadMIME(MimeText))
+}
+
+func Test_CommandFileReader_ReadText_FileArg(t *testing.T) {
+	r := CommandFileReader{
+		Name:    "cat",
+		Command: "cat",
+		Args:    []string{FileArg},
+	}
+
+	txt, err := r.ReadText("testdata/test.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", txt)
+}
+
+func Test_CommandFileReader_ReadText_Stdin(t *testing.T) {
+	r := CommandFileReader{
+		Name:    "upper",
+		Command: "tr",
+		Args:    []string{"a-z", "A-Z"},
+		Stdin:   true,
+	}
+
+	txt, err := r.ReadText("testdata/test.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "HELLO WORLD", txt)
+}
+
+func Test_CommandFileReader_ReadText_Timeout(t *testing.T) {
+	r := CommandFileReader{
+		Name:    "sleep",
+		Command: "sleep",
+		Args:    []string{"5"},
+		Timeout: 50 * time.Millisecond,
+	}
+
+	_, err := r.ReadText("testdata/test.txt")
+	assert.ErrorContains(t, err, "timed out")
+}
+
+func Test_CommandFileReader_ReadText_BackgroundChild(t *testing.T) {
+	r := CommandFileReader{
+		Name:    "sh",
+		Command: "sh",
+		Args:    []string{"-c", "sleep 60 & echo x"},
+		Timeout: 30 * time.Second,
+	}
+
+	start := time.Now()
+	txt, err := r.ReadText("testdata/test.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "x\n", txt)
+	assert.Less(t, time.Since(start), 10*time.Second)
+}
+
+func Test_CommandFileReader_ReadText_MaxOutput(t *testing.T) {
+	r := CommandFileReader{
+		Name:      "cat",
+		Command:   "cat",
+		Args:      []string{FileArg},
+		MaxOutput: 5,
+	}
+
+	_, err := r.ReadText("testdata/test.txt")
+	assert.ErrorIs(t, err, errOutputTooLarge)
+}
+
+func Test_CommandFileReader_ReadText_ExitCodes(t *testing.T) {
+	r := CommandFileReader{
+		Name:    "failing",
+		Command: "sh",
+		Args:    []string{"-c", "echo partial; echo broken >&2; exit 3"},
+	}
+
+	_, err := r.ReadText("testdata/test.txt")
+	assert.ErrorContains(t, err, "exited with code 3: broken")
+
+	r.ExitCodes = []int{0, 3}
+	txt, err := r.ReadText("testdata/test.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "partial\n", txt)
+}
@@ -0,0 +1,55 @@
+package readers
+
+import "strings"
+
+// Document is a logical document read from a file. Container formats such as mbox
+// produce several documents per file, each identified by its Name.
+type Document struct {
+	Name string
+	Text string
+	Meta map[string]string
+	// Sections optionally split Text into located parts, e.g. chapters or slides
+	Sections []Section
+	// MimeType is the detected type of the file the document was read from
+	MimeType string
+	// PackSections asks the chunker to keep sections whole where possible and
+	// to pack consecutive small sections into a single chunk
+	PackSections bool
+	// Reader names the reader the document was read with
+	Reader string
+}
+
+// Section is a part of a document with a human readable location usable in citations
+type Section struct {
+	Location string
+	Text     string
+}
+
+func newSectionedDocument(sections []Section, meta map[string]string) Document {
+	texts := make([]string, 0, len(sections))
+	for _, s := range sections {
+		texts = append(texts, s.Text)
+	}
+
+	return Document{
+		Text:     strings.Join(texts, "\n\n"),
+		Meta:     meta,
+		Sections: sections,
+	}
+}
+
+// documentText returns the text of the single document read from a file, empty if
+// the file holds none
+func documentText(docs []Document) string {
+	if len(docs) == 0 {
+		return ""
+	}
+
+	return docs[0].Text
+}
+
+// TextReader reads the plain text of the files it supports
+type TextReader interface {
+	CanRead(path string) bool
+	ReadText(path string) (string, error)
+}
@@ -0,0 +1,12 @@
+package readers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_documentText(t *testing.T) {
+	assert.Empty(t, documentText(nil))
+	assert.Equal(t, "slide", documentText([]Document{{Text: "slide"}}))
+}
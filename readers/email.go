@@ -0,0 +1,317 @@
+package readers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"code.sajari.com/docconv/v2"
+)
+
+// AttachmentReader reads the text of attached files, name is the file name of the
+// attachment. Attachments of unsupported types have no text.
+type AttachmentReader interface {
+	ReadAttachment(path, name string) (string, error)
+}
+
+// EmailFileReader reads .eml messages and .mbox mailboxes. Every message of a
+// mailbox is returned as a separate document.
+type EmailFileReader struct {
+	// Attachments reads attachments, attachments are skipped if nil
+	Attachments AttachmentReader
+	// Log reports the messages of a mailbox skipped as unreadable, if set
+	Log *slog.Logger
+}
+
+var emailHeaders = []string{"Subject", "From", "To", "Date"}
+
+func (r *EmailFileReader) CanRead(path string) bool {
+	return r.CanReadMIME(mimeHint(path))
+}
+
+func (r *EmailFileReader) CanReadMIME(mimeType string) bool {
+	return mimeType == MimeEmail || mimeType == MimeMbox
+}
+
+func (r *EmailFileReader) ReadText(path string) (string, error) {
+	docs, err := r.ReadDocuments(path)
+	if err != nil {
+		return "", err
+	}
+
+	texts := make([]string, 0, len(docs))
+	for _, d := range docs {
+		texts = append(texts, d.Text)
+	}
+
+	return strings.Join(texts, "\n\n"), nil
+}
+
+func (r *EmailFileReader) ReadDocuments(path string) ([]Document, error) {
+	return r.ReadMIME(path, mimeHint(path))
+}
+
+func (r *EmailFileReader) ReadMIME(path, mimeType string) ([]Document, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open email file: %w", err)
+	}
+	defer f.Close()
+
+	if mimeType != MimeMbox {
+		doc, err := r.readMessage(f)
+		if err != nil {
+			return nil, err
+		}
+
+		return []Document{doc}, nil
+	}
+
+	msgs, err := splitMbox(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mailbox: %w", err)
+	}
+
+	// a malformed message is skipped, so that it doesn't drop the rest of the mailbox
+	docs := make([]Document, 0, len(msgs))
+	var errs []error
+	for i, m := range msgs {
+		doc, err := r.readMessage(bytes.NewReader(m))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("message %d: %w", i+1, err))
+			if r.Log != nil {
+				r.Log.Warn("skipping unreadable mailbox message", "file", path, "message", i+1, "error", err)
+			}
+			continue
+		}
+
+		doc.Name = fmt.Sprintf("message-%d", i+1)
+		docs = append(docs, doc)
+	}
+
+	if len(docs) == 0 && len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return docs, nil
+}
+
+func (r *EmailFileReader) readMessage(in io.Reader) (Document, error) {
+	msg, err := mail.ReadMessage(in)
+	if err != nil {
+		return Document{}, fmt.Errorf("failed to parse email message: %w", err)
+	}
+
+	dec := mime.WordDecoder{CharsetReader: charsetReader}
+	meta := make(map[string]string)
+	var sb strings.Builder
+	for _, h := range emailHeaders {
+		v := msg.Header.Get(h)
+		if v == "" {
+			continue
+		}
+
+		if decoded, err := dec.DecodeHeader(v); err == nil {
+			v = decoded
+		}
+
+		meta[strings.ToLower(h)] = v
+		fmt.Fprintf(&sb, "%s: %s\n", h, v)
+	}
+
+	body, err := r.readPart(textproto.MIMEHeader(msg.Header), msg.Body)
+	if err != nil {
+		return Document{}, err
+	}
+
+	sb.WriteString("\n")
+	sb.WriteString(body)
+
+	return Document{
+		Text: sb.String(),
+		Meta: meta,
+	}, nil
+}
+
+func (r *EmailFileReader) readPart(header textproto.MIMEHeader, body io.Reader) (string, error) {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType = "text/plain"
+	}
+
+	body = decodeTransferEncoding(header.Get("Content-Transfer-Encoding"), body)
+	if name := attachmentName(header, params); name != "" {
+		return r.readAttachment(name, body)
+	}
+
+	// attachments are left as is, their readers handle their encoding
+	charset := params["charset"]
+	if strings.HasPrefix(mediaType, "text/") && charset != "" && !strings.EqualFold(charset, "utf-8") {
+		if dec, err := charsetReader(charset, body); err == nil {
+			body = dec
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(mediaType, "multipart/"):
+		return r.readMultipart(mediaType, params["boundary"], body)
+	case mediaType == "text/html":
+		text, err := docconv.HTMLToText(body)
+		if err != nil {
+			return "", fmt.Errorf("failed to convert html body: %w", err)
+		}
+
+		return text, nil
+	case strings.HasPrefix(mediaType, "text/"):
+		buf, err := io.ReadAll(body)
+		if err != nil {
+			return "", fmt.Errorf("failed to read text body: %w", err)
+		}
+
+		return string(buf), nil
+	}
+
+	return "", nil
+}
+
+func (r *EmailFileReader) readMultipart(mediaType, boundary string, body io.Reader) (string, error) {
+	mr := multipart.NewReader(body, boundary)
+	var texts []string
+	plain := -1
+
+	for {
+		p, err := mr.NextRawPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read multipart body: %w", err)
+		}
+
+		text, err := r.readPart(p.Header, p)
+		if err != nil {
+			return "", err
+		}
+		if text == "" {
+			continue
+		}
+
+		if ct, _, _ := mime.ParseMediaType(p.Header.Get("Content-Type")); ct == "text/plain" && plain < 0 {
+			plain = len(texts)
+		}
+		texts = append(texts, text)
+	}
+
+	// alternative parts carry the same content, prefer the plain text version
+	if mediaType == "multipart/alternative" && len(texts) > 0 {
+		if plain >= 0 {
+			return texts[plain], nil
+		}
+
+		return texts[0], nil
+	}
+
+	return strings.Join(texts, "\n\n"), nil
+}
+
+func (r *EmailFileReader) readAttachment(name string, body io.Reader) (string, error) {
+	if r.Attachments == nil {
+		return "", nil
+	}
+
+	tmp, err := os.CreateTemp("", "rag-mcp-*"+filepath.Ext(name))
+	if err != nil {
+		return "", fmt.Errorf("failed to create attachment file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, body)
+	tmp.Close()
+	if err != nil {
+		return "", fmt.Errorf("failed to extract attachment %s: %w", name, err)
+	}
+
+	text, err := r.Attachments.ReadAttachment(tmp.Name(), name)
+	if err != nil {
+		return "", fmt.Errorf("failed to read attachment %s: %w", name, err)
+	}
+	if text == "" {
+		return "", nil
+	}
+
+	return fmt.Sprintf("Attachment: %s\n%s", name, text), nil
+}
+
+func attachmentName(header textproto.MIMEHeader, contentParams map[string]string) string {
+	disposition, params, err := mime.ParseMediaType(header.Get("Content-Disposition"))
+	if err == nil && params["filename"] != "" {
+		return params["filename"]
+	}
+
+	if disposition == "attachment" {
+		return contentParams["name"]
+	}
+
+	return ""
+}
+
+func decodeTransferEncoding(encoding string, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	}
+
+	return body
+}
+
+// splitMbox splits a mailbox into raw messages, unescaping ">From " lines
+func splitMbox(in io.Reader) ([][]byte, error) {
+	var msgs [][]byte
+	var cur *bytes.Buffer
+
+	br := bufio.NewReader(in)
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			switch {
+			case bytes.HasPrefix(line, []byte("From ")):
+				if cur != nil {
+					msgs = append(msgs, cur.Bytes())
+				}
+				cur = new(bytes.Buffer)
+			case cur != nil:
+				if unquoted := bytes.TrimLeft(line, ">"); len(unquoted) < len(line) && bytes.HasPrefix(unquoted, []byte("From ")) {
+					line = line[1:]
+				}
+				cur.Write(line)
+			}
+		}
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cur != nil {
+		msgs = append(msgs, cur.Bytes())
+	}
+
+	return msgs, nil
+}
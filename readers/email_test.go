@@ -0,0 +1,137 @@
+package readers
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_EmailFileReader_CanRead(t *testing.T) {
+	r := EmailFileReader{}
+	assert.True(t, r.CanRead("some/file.eml"))
+	assert.True(t, r.CanRead("some/file.mbox"))
+	assert.False(t, r.CanRead("some/file.txt"))
+}
+
+// fakeAttachments reads .txt attachments as plain text and records the content
+// of every attachment
+type fakeAttachments struct {
+	content map[string][]byte
+}
+
+func (a *fakeAttachments) ReadAttachment(path, name string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	if a.content == nil {
+		a.content = make(map[string][]byte)
+	}
+	a.content[name] = b
+
+	if filepath.Ext(name) != ".txt" {
+		return "", nil
+	}
+
+	return string(b), nil
+}
+
+func Test_EmailFileReader_ReadDocuments_Eml(t *testing.T) {
+	r := EmailFileReader{Attachments: &fakeAttachments{}}
+
+	docs, err := r.ReadDocuments("testdata/test.eml")
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+
+	doc := docs[0]
+	assert.Empty(t, doc.Name)
+	assert.Equal(t, map[string]string{
+		"subject": "Project updäte",
+		"from":    "Alice <alice@example.com>",
+		"to":      "Bob <bob@example.com>",
+		"date":    "Mon, 2 Jun 2025 10:00:00 +0000",
+	}, doc.Meta)
+	assert.Contains(t, doc.Text, "Subject: Project updäte")
+	assert.Contains(t, doc.Text, "hello world")
+	assert.NotContains(t, doc.Text, "<b>")
+	assert.Contains(t, doc.Text, "Attachment: notes.txt\nattached notes")
+}
+
+func Test_EmailFileReader_ReadDocuments_SkipsAttachments(t *testing.T) {
+	r := EmailFileReader{}
+
+	docs, err := r.ReadDocuments("testdata/test.eml")
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	assert.NotContains(t, docs[0].Text, "attached notes")
+}
+
+func Test_EmailFileReader_ReadDocuments_BinaryAttachment(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "binary.eml")
+	require.NoError(t, os.WriteFile(path, []byte("Subject: Report\r\n"+
+		"Content-Type: multipart/mixed; boundary=b\r\n\r\n"+
+		"--b\r\nContent-Type: text/plain; charset=iso-8859-1\r\n\r\ncaf\xe9\r\n"+
+		"--b\r\nContent-Type: application/octet-stream; charset=iso-8859-1\r\n"+
+		"Content-Disposition: attachment; filename=report.bin\r\n"+
+		"Content-Transfer-Encoding: base64\r\n\r\n/wDp\r\n"+
+		"--b--\r\n"), 0o644))
+
+	attachments := &fakeAttachments{}
+	r := EmailFileReader{Attachments: attachments}
+
+	docs, err := r.ReadDocuments(path)
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	assert.Contains(t, docs[0].Text, "café")
+	assert.NotContains(t, docs[0].Text, "Attachment: report.bin")
+	assert.Equal(t, []byte{0xff, 0x00, 0xe9}, attachments.content["report.bin"])
+}
+
+func Test_EmailFileReader_ReadDocuments_Mbox(t *testing.T) {
+	r := EmailFileReader{}
+
+	docs, err := r.ReadDocuments("testdata/test.mbox")
+	require.NoError(t, err)
+	require.Len(t, docs, 2)
+
+	assert.Equal(t, "message-1", docs[0].Name)
+	assert.Equal(t, "First", docs[0].Meta["subject"])
+	assert.Contains(t, docs[0].Text, "first message\nFrom the archive")
+
+	assert.Equal(t, "message-2", docs[1].Name)
+	assert.Equal(t, "Second", docs[1].Meta["subject"])
+	assert.Equal(t, "second message", strings.TrimSpace(strings.SplitN(docs[1].Text, "\n\n", 2)[1]))
+}
+
+func Test_EmailFileReader_ReadDocuments_MalformedMessage(t *testing.T) {
+	r := EmailFileReader{}
+	path := filepath.Join(t.TempDir(), "broken.mbox")
+	require.NoError(t, os.WriteFile(path, []byte(
+		"From a@example.com Mon Jan  1 00:00:00 2024\nSubject: Good\n\nvalid message\n\n"+
+			"From b@example.com Mon Jan  1 00:00:00 2024\nnot a header\n\nbroken message\n"), 0o644))
+
+	docs, err := r.ReadDocuments(path)
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	assert.Equal(t, "message-1", docs[0].Name)
+	assert.Contains(t, docs[0].Text, "valid message")
+
+	require.NoError(t, os.WriteFile(path, []byte(
+		"From b@example.com Mon Jan  1 00:00:00 2024\nnot a header\n\nbroken message\n"), 0o644))
+	_, err = r.ReadDocuments(path)
+	assert.ErrorContains(t, err, "message 1")
+}
+
+func Test_EmailFileReader_ReadText(t *testing.T) {
+	r := EmailFileReader{}
+
+	txt, err := r.ReadText("testdata/test.mbox")
+	require.NoError(t, err)
+	assert.Contains(t, txt, "first message")
+	assert.Contains(t, txt, "second message")
+}
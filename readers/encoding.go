@@ -0,0 +1,144 @@
+package readers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/htmlindex"
+	xunicode "golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/encoding/unicode/utf32"
+	"golang.org/x/text/unicode/norm"
+)
+
+var (
+	bomUTF8    = []byte{0xef, 0xbb, 0xbf}
+	bomUTF16LE = []byte{0xff, 0xfe}
+	bomUTF16BE = []byte{0xfe, 0xff}
+	bomUTF32LE = []byte{0xff, 0xfe, 0x00, 0x00}
+	bomUTF32BE = []byte{0x00, 0x00, 0xfe, 0xff}
+)
+
+// DecodeText converts raw file content to UTF-8. The encoding is taken from the
+// byte order mark if there is one, UTF-16 without a BOM is recognized by its zero
+// bytes, and content that isn't valid UTF-8 is treated as Windows-1252, a superset
+// of Latin-1 commonly used by legacy documents.
+func DecodeText(buf []byte) (string, error) {
+	enc, bom := detectEncoding(buf)
+	buf = buf[bom:]
+	if enc == nil {
+		return string(buf), nil
+	}
+
+	res, err := enc.NewDecoder().Bytes(buf)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode text: %w", err)
+	}
+
+	return string(res), nil
+}
+
+// detectEncoding returns the encoding of buf, nil for UTF-8, and the length of
+// its byte order mark
+func detectEncoding(buf []byte) (encoding.Encoding, int) {
+	switch {
+	case bytes.HasPrefix(buf, bomUTF32LE):
+		return utf32.UTF32(utf32.LittleEndian, utf32.IgnoreBOM), len(bomUTF32LE)
+	case bytes.HasPrefix(buf, bomUTF32BE):
+		return utf32.UTF32(utf32.BigEndian, utf32.IgnoreBOM), len(bomUTF32BE)
+	case bytes.HasPrefix(buf, bomUTF8):
+		return nil, len(bomUTF8)
+	case bytes.HasPrefix(buf, bomUTF16LE):
+		return xunicode.UTF16(xunicode.LittleEndian, xunicode.IgnoreBOM), len(bomUTF16LE)
+	case bytes.HasPrefix(buf, bomUTF16BE):
+		return xunicode.UTF16(xunicode.BigEndian, xunicode.IgnoreBOM), len(bomUTF16BE)
+	}
+
+	if endian, ok := guessUTF16(buf); ok {
+		return xunicode.UTF16(endian, xunicode.IgnoreBOM), 0
+	}
+
+	if utf8.Valid(buf) {
+		return nil, 0
+	}
+
+	return charmap.Windows1252, 0
+}
+
+// guessUTF16 recognizes UTF-16 text without a BOM, where most characters are
+// ASCII and so every other byte is zero
+func guessUTF16(buf []byte) (xunicode.Endianness, bool) {
+	n := min(len(buf), sniffLength) &^ 1
+	if n < 4 {
+		return xunicode.BigEndian, false
+	}
+
+	var even, odd int
+	for i := 0; i < n; i += 2 {
+		if buf[i] == 0 {
+			even++
+		}
+		if buf[i+1] == 0 {
+			odd++
+		}
+	}
+
+	pairs := n / 2
+	switch {
+	case odd*10 >= pairs*7 && even*10 < pairs:
+		return xunicode.LittleEndian, true
+	case even*10 >= pairs*7 && odd*10 < pairs:
+		return xunicode.BigEndian, true
+	}
+
+	return xunicode.BigEndian, false
+}
+
+// charsetReader decodes content declared in the given charset (e.g. in an email
+// Content-Type) to UTF-8
+func charsetReader(charset string, in io.Reader) (io.Reader, error) {
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported charset %s: %w", charset, err)
+	}
+
+	return enc.NewDecoder().Reader(in), nil
+}
+
+// NormalizeText prepares extracted text for chunking and hashing: it drops byte
+// order marks, converts line endings to \n, applies Unicode NFC normalization and
+// collapses runs of other control characters to a single space
+func NormalizeText(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = norm.NFC.String(text)
+
+	var sb strings.Builder
+	sb.Grow(len(text))
+
+	inControl := false
+	for _, r := range text {
+		switch {
+		case r == '\uFEFF':
+			continue
+		case r == '\r':
+			r = '\n'
+		case r == '\n' || r == '\t':
+		case unicode.IsControl(r) || r == utf8.RuneError:
+			if !inControl {
+				sb.WriteByte(' ')
+			}
+			inControl = true
+			continue
+		}
+
+		inControl = false
+		sb.WriteRune(r)
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,52 @@
+package readers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_DecodeText(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []byte
+		out  string
+	}{
+		{name: "utf-8", in: []byte("grüße"), out: "grüße"},
+		{name: "utf-8 bom", in: []byte("\xef\xbb\xbfhello"), out: "hello"},
+		{name: "utf-16le bom", in: []byte("\xff\xfeh\x00i\x00\xe9\x00"), out: "hié"},
+		{name: "utf-16be bom", in: []byte("\xfe\xff\x00h\x00i\x00\xe9"), out: "hié"},
+		{name: "utf-16le without bom", in: []byte("h\x00e\x00l\x00l\x00o\x00"), out: "hello"},
+		{name: "utf-32le bom", in: []byte("\xff\xfe\x00\x00h\x00\x00\x00"), out: "h"},
+		{name: "latin-1", in: []byte("caf\xe9 na\xefve"), out: "café naïve"},
+		{name: "windows-1252", in: []byte("\x93quoted\x94"), out: "“quoted”"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := DecodeText(tt.in)
+			require.NoError(t, err)
+			assert.Equal(t, tt.out, out)
+		})
+	}
+}
+
+func Test_NormalizeText(t *testing.T) {
+	assert.Equal(t, "line 1\nline 2\nline 3", NormalizeText("line 1\r\nline 2\rline 3"))
+	assert.Equal(t, "caf\u00e9", NormalizeText("cafe\u0301"))
+	assert.Equal(t, "a b\tc", NormalizeText("a\x00\x01\x1bb\tc"))
+	assert.Equal(t, "zero width", NormalizeText("\ufeffzero width"))
+}
+
+func Test_TxtFileReader_ReadText_UTF16(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "utf16.txt")
+	require.NoError(t, os.WriteFile(path, []byte("\xff\xfeh\x00e\x00l\x00l\x00o\x00"), 0o644))
+
+	r := TxtFileReader{}
+	txt, err := r.ReadText(path)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", txt)
+}
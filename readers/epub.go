@@ -0,0 +1,259 @@
+package readers
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"code.sajari.com/docconv/v2"
+)
+
+// EpubFileReader reads EPUB books chapter by chapter in spine order
+type EpubFileReader struct{}
+
+type epubContainer struct {
+	Rootfiles []struct {
+		FullPath string `xml:"full-path,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+type epubPackage struct {
+	Title    string `xml:"metadata>title"`
+	Creator  string `xml:"metadata>creator"`
+	Manifest []struct {
+		ID         string `xml:"id,attr"`
+		Href       string `xml:"href,attr"`
+		Properties string `xml:"properties,attr"`
+	} `xml:"manifest>item"`
+	Spine struct {
+		Toc      string `xml:"toc,attr"`
+		ItemRefs []struct {
+			IDRef string `xml:"idref,attr"`
+		} `xml:"itemref"`
+	} `xml:"spine"`
+}
+
+type epubNavPoint struct {
+	Label   string `xml:"navLabel>text"`
+	Content struct {
+		Src string `xml:"src,attr"`
+	} `xml:"content"`
+	Points []epubNavPoint `xml:"navPoint"`
+}
+
+func (r *EpubFileReader) CanRead(path string) bool {
+	return strings.ToLower(filepath.Ext(path)) == ".epub"
+}
+
+func (r *EpubFileReader) CanReadMIME(mimeType string) bool {
+	return mimeType == MimeEpub
+}
+
+func (r *EpubFileReader) ReadMIME(path, mimeType string) ([]Document, error) {
+	return r.ReadDocuments(path)
+}
+
+func (r *EpubFileReader) ReadText(file string) (string, error) {
+	docs, err := r.ReadDocuments(file)
+	if err != nil {
+		return "", err
+	}
+
+	return documentText(docs), nil
+}
+
+func (r *EpubFileReader) ReadDocuments(file string) ([]Document, error) {
+	zr, err := zip.OpenReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open epub: %w", err)
+	}
+	defer zr.Close()
+
+	var container epubContainer
+	if err := decodeZipXML(&zr.Reader, "META-INF/container.xml", &container); err != nil {
+		return nil, err
+	}
+	if len(container.Rootfiles) == 0 {
+		return nil, errors.New("epub has no package document")
+	}
+
+	opfPath := container.Rootfiles[0].FullPath
+	var pkg epubPackage
+	if err := decodeZipXML(&zr.Reader, opfPath, &pkg); err != nil {
+		return nil, err
+	}
+
+	base := path.Dir(opfPath)
+	hrefs := make(map[string]string)
+	for _, item := range pkg.Manifest {
+		hrefs[item.ID] = path.Join(base, item.Href)
+	}
+
+	titles := r.readTitles(&zr.Reader, pkg, hrefs)
+
+	var sections []Section
+	for i, ref := range pkg.Spine.ItemRefs {
+		href, ok := hrefs[ref.IDRef]
+		if !ok {
+			continue
+		}
+
+		text, err := readZipHTML(&zr.Reader, href)
+		if err != nil {
+			return nil, err
+		}
+
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+
+		title := titles[href]
+		if title == "" {
+			title = fmt.Sprintf("chapter %d", i+1)
+		}
+
+		sections = append(sections, Section{
+			Location: title,
+			Text:     text,
+		})
+	}
+
+	meta := make(map[string]string)
+	if pkg.Title != "" {
+		meta["title"] = strings.TrimSpace(pkg.Title)
+	}
+	if pkg.Creator != "" {
+		meta["author"] = strings.TrimSpace(pkg.Creator)
+	}
+
+	return []Document{newSectionedDocument(sections, meta)}, nil
+}
+
+// readTitles maps chapter files to their titles taken from the EPUB 3 navigation
+// document or from the EPUB 2 NCX table of contents
+func (r *EpubFileReader) readTitles(zr *zip.Reader, pkg epubPackage, hrefs map[string]string) map[string]string {
+	titles := make(map[string]string)
+
+	for _, item := range pkg.Manifest {
+		if !strings.Contains(item.Properties, "nav") {
+			continue
+		}
+
+		navPath := hrefs[item.ID]
+		f, err := zr.Open(navPath)
+		if err != nil {
+			break
+		}
+
+		readNavTitles(f, path.Dir(navPath), titles)
+		f.Close()
+		return titles
+	}
+
+	ncxPath, ok := hrefs[pkg.Spine.Toc]
+	if !ok {
+		return titles
+	}
+
+	var ncx struct {
+		Points []epubNavPoint `xml:"navMap>navPoint"`
+	}
+	if err := decodeZipXML(zr, ncxPath, &ncx); err != nil {
+		return titles
+	}
+
+	var walk func(points []epubNavPoint)
+	walk = func(points []epubNavPoint) {
+		for _, p := range points {
+			src := path.Join(path.Dir(ncxPath), stripFragment(p.Content.Src))
+			if _, ok := titles[src]; !ok {
+				titles[src] = strings.TrimSpace(p.Label)
+			}
+			walk(p.Points)
+		}
+	}
+	walk(ncx.Points)
+
+	return titles
+}
+
+// readNavTitles collects the anchors of an EPUB 3 navigation document
+func readNavTitles(r io.Reader, base string, titles map[string]string) {
+	dec := xml.NewDecoder(r)
+	dec.Strict = false
+
+	var href string
+	var label strings.Builder
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Local == "a" {
+				href = ""
+				label.Reset()
+				for _, a := range t.Attr {
+					if a.Name.Local == "href" {
+						href = path.Join(base, stripFragment(a.Value))
+					}
+				}
+			}
+		case xml.CharData:
+			if href != "" {
+				label.Write(t)
+			}
+		case xml.EndElement:
+			if t.Name.Local == "a" && href != "" {
+				if _, ok := titles[href]; !ok {
+					titles[href] = strings.TrimSpace(label.String())
+				}
+				href = ""
+			}
+		}
+	}
+}
+
+func stripFragment(href string) string {
+	href, _, _ = strings.Cut(href, "#")
+	return href
+}
+
+func decodeZipXML(zr *zip.Reader, name string, v any) error {
+	f, err := zr.Open(name)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	defer f.Close()
+
+	dec := xml.NewDecoder(f)
+	dec.Strict = false
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+
+	return nil
+}
+
+func readZipHTML(zr *zip.Reader, name string) (string, error) {
+	f, err := zr.Open(name)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	defer f.Close()
+
+	text, err := docconv.HTMLToText(f)
+	if err != nil {
+		return "", fmt.Errorf("failed to convert %s: %w", name, err)
+	}
+
+	return text, nil
+}
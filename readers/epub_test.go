@@ -0,0 +1,29 @@
+package readers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_EpubFileReader_CanRead(t *testing.T) {
+	r := EpubFileReader{}
+	assert.True(t, r.CanRead("some/book.epub"))
+	assert.False(t, r.CanRead("some/book.pdf"))
+}
+
+func Test_EpubFileReader_ReadDocuments(t *testing.T) {
+	r := EpubFileReader{}
+
+	docs, err := r.ReadDocuments("testdata/test.epub")
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+
+	assert.Equal(t, map[string]string{"title": "Hello Book", "author": "Jane Doe"}, docs[0].Meta)
+	assert.Equal(t, []Section{
+		{Location: "Introduction", Text: "hello"},
+		{Location: "The World", Text: "world"},
+	}, docs[0].Sections)
+	assert.Equal(t, "hello\n\nworld", docs[0].Text)
+}
@@ -0,0 +1,165 @@
+package readers
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	MimeText         = "text/plain"
+	MimeXML          = "text/xml"
+	MimeHTML         = "text/html"
+	MimePDF          = "application/pdf"
+	MimeZip          = "application/zip"
+	MimeOctetStream  = "application/octet-stream"
+	MimeDocx         = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	MimePptx         = "application/vnd.openxmlformats-officedocument.presentationml.presentation"
+	MimeXlsx         = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	MimeOdt          = "application/vnd.oasis.opendocument.text"
+	MimeOdp          = "application/vnd.oasis.opendocument.presentation"
+	MimeEpub         = "application/epub+zip"
+	MimeEmail        = "message/rfc822"
+	MimeMbox         = "application/mbox"
+	MimeNotebook     = "application/x-ipynb+json"
+	MimeJSON         = "application/json"
+	sniffLength      = 512
+	zipMimetypeEntry = "mimetype"
+)
+
+// extensionHints map file extensions to MIME types. Hints are used when the content
+// alone is ambiguous, e.g. to tell a DOCX from a plain zip or markdown from text.
+var extensionHints = map[string]string{
+	".txt":   MimeText,
+	".md":    "text/markdown",
+	".csv":   "text/csv",
+	".xml":   MimeXML,
+	".html":  MimeHTML,
+	".htm":   MimeHTML,
+	".pdf":   MimePDF,
+	".zip":   MimeZip,
+	".docx":  MimeDocx,
+	".pptx":  MimePptx,
+	".xlsx":  MimeXlsx,
+	".odt":   MimeOdt,
+	".odp":   MimeOdp,
+	".epub":  MimeEpub,
+	".doc":   "application/msword",
+	".rtf":   "application/rtf",
+	".eml":   MimeEmail,
+	".mbox":  MimeMbox,
+	".ipynb": MimeNotebook,
+	".json":  MimeJSON,
+}
+
+// zip based formats recognized by their main part when the extension is missing
+var zipParts = map[string]string{
+	"word/document.xml":    MimeDocx,
+	"ppt/presentation.xml": MimePptx,
+	"xl/workbook.xml":      MimeXlsx,
+}
+
+// DetectMIME sniffs the MIME type of the file at path from its leading bytes. The
+// extension of name is used as a hint for formats the content can't tell apart.
+// Content wins over a conflicting extension, so a PDF named report.txt is detected
+// as application/pdf.
+func DetectMIME(path, name string) (string, error) {
+	hint := mimeHint(name)
+
+	f, err := os.Open(path)
+	if err != nil {
+		return hint, fmt.Errorf("failed to open file for type detection: %w", err)
+	}
+	defer f.Close()
+
+	head := make([]byte, sniffLength)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return hint, fmt.Errorf("failed to read file for type detection: %w", err)
+	}
+
+	sniffed, _, _ := mime.ParseMediaType(http.DetectContentType(head[:n]))
+
+	switch {
+	case sniffed == MimeZip:
+		return detectZip(path, hint), nil
+	case strings.HasPrefix(sniffed, "text/"):
+		if isTextual(hint) {
+			return hint, nil
+		}
+
+		return sniffed, nil
+	case sniffed == MimeOctetStream && hint != "":
+		return hint, nil
+	}
+
+	return sniffed, nil
+}
+
+// mimeHint guesses the MIME type from the file extension
+func mimeHint(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	if hint, ok := extensionHints[ext]; ok {
+		return hint
+	}
+
+	hint, _, _ := mime.ParseMediaType(mime.TypeByExtension(ext))
+	return hint
+}
+
+func isTextual(mimeType string) bool {
+	return strings.HasPrefix(mimeType, "text/") ||
+		mimeType == MimeEmail ||
+		mimeType == MimeMbox ||
+		mimeType == MimeJSON ||
+		mimeType == MimeNotebook ||
+		mimeType == "application/rtf"
+}
+
+func isZipBased(mimeType string) bool {
+	switch mimeType {
+	case MimeDocx, MimePptx, MimeXlsx, MimeOdt, MimeOdp, MimeEpub:
+		return true
+	}
+
+	return false
+}
+
+// detectZip tells office documents and books from plain zip archives
+func detectZip(path, hint string) string {
+	if isZipBased(hint) {
+		return hint
+	}
+
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return MimeZip
+	}
+	defer zr.Close()
+
+	for _, f := range zr.File {
+		if f.Name == zipMimetypeEntry {
+			rc, err := f.Open()
+			if err != nil {
+				break
+			}
+
+			buf, err := io.ReadAll(io.LimitReader(rc, 128))
+			rc.Close()
+			if err == nil && len(buf) > 0 {
+				return strings.TrimSpace(string(buf))
+			}
+		}
+
+		if mimeType, ok := zipParts[f.Name]; ok {
+			return mimeType
+		}
+	}
+
+	return MimeZip
+}
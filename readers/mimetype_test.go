@@ -0,0 +1,57 @@
+package readers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func copyTestFile(t *testing.T, src, name string) string {
+	t.Helper()
+
+	buf, err := os.ReadFile(src)
+	require.NoError(t, err)
+
+	dst := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(dst, buf, 0o644))
+	return dst
+}
+
+func Test_DetectMIME(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		file string
+		mime string
+	}{
+		{name: "pdf", src: "testdata/test.pdf", file: "test.pdf", mime: MimePDF},
+		{name: "uppercase extension", src: "testdata/test.pdf", file: "TEST.PDF", mime: MimePDF},
+		{name: "pdf named as text", src: "testdata/test.pdf", file: "report.txt", mime: MimePDF},
+		{name: "text without extension", src: "testdata/test.txt", file: "README", mime: MimeText},
+		{name: "markdown", src: "testdata/test.txt", file: "notes.md", mime: "text/markdown"},
+		{name: "docx without extension", src: "testdata/test.docx", file: "document", mime: MimeDocx},
+		{name: "odt by mimetype entry", src: "testdata/test.odt", file: "document.zip", mime: MimeOdt},
+		{name: "epub", src: "testdata/test.epub", file: "book", mime: MimeEpub},
+		{name: "pptx", src: "testdata/test.pptx", file: "slides.PPTX", mime: MimePptx},
+		{name: "email", src: "testdata/test.eml", file: "message.eml", mime: MimeEmail},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := copyTestFile(t, tt.src, tt.file)
+
+			mimeType, err := DetectMIME(path, tt.file)
+			require.NoError(t, err)
+			assert.Equal(t, tt.mime, mimeType)
+		})
+	}
+}
+
+func Test_DetectMIME_MissingFile(t *testing.T) {
+	mimeType, err := DetectMIME("testdata/missing.pdf", "missing.pdf")
+	assert.Error(t, err)
+	assert.Equal(t, MimePDF, mimeType)
+}
@@ -0,0 +1,146 @@
+package readers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// NotebookFileReader reads Jupyter notebooks cell by cell
+type NotebookFileReader struct {
+	// Outputs includes the text outputs of code cells
+	Outputs bool
+}
+
+type notebook struct {
+	Cells []struct {
+		CellType string           `json:"cell_type"`
+		Source   notebookText     `json:"source"`
+		Outputs  []notebookOutput `json:"outputs"`
+	} `json:"cells"`
+	Metadata struct {
+		Kernelspec struct {
+			Language string `json:"language"`
+		} `json:"kernelspec"`
+		LanguageInfo struct {
+			Name string `json:"name"`
+		} `json:"language_info"`
+	} `json:"metadata"`
+}
+
+type notebookOutput struct {
+	OutputType string                  `json:"output_type"`
+	Text       notebookText            `json:"text"`
+	Data       map[string]notebookText `json:"data"`
+	Ename      string                  `json:"ename"`
+	Evalue     string                  `json:"evalue"`
+}
+
+// notebookText is a multiline string stored either as a string or as a list of lines
+type notebookText string
+
+func (t *notebookText) UnmarshalJSON(b []byte) error {
+	var lines []string
+	if err := json.Unmarshal(b, &lines); err == nil {
+		*t = notebookText(strings.Join(lines, ""))
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		// non textual data such as images or JSON payloads
+		return nil
+	}
+
+	*t = notebookText(s)
+	return nil
+}
+
+func (r *NotebookFileReader) CanRead(path string) bool {
+	return strings.ToLower(filepath.Ext(path)) == ".ipynb"
+}
+
+func (r *NotebookFileReader) CanReadMIME(mimeType string) bool {
+	return mimeType == MimeNotebook
+}
+
+func (r *NotebookFileReader) ReadMIME(path, mimeType string) ([]Document, error) {
+	return r.ReadDocuments(path)
+}
+
+func (r *NotebookFileReader) ReadText(path string) (string, error) {
+	docs, err := r.ReadDocuments(path)
+	if err != nil {
+		return "", err
+	}
+
+	return documentText(docs), nil
+}
+
+func (r *NotebookFileReader) ReadDocuments(path string) ([]Document, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read notebook: %w", err)
+	}
+
+	var nb notebook
+	if err := json.Unmarshal(buf, &nb); err != nil {
+		return nil, fmt.Errorf("failed to parse notebook: %w", err)
+	}
+
+	var sections []Section
+	for i, cell := range nb.Cells {
+		if cell.CellType != "markdown" && cell.CellType != "code" {
+			continue
+		}
+
+		text := strings.TrimSpace(string(cell.Source))
+		if r.Outputs && cell.CellType == "code" {
+			if out := cellOutputs(cell.Outputs); out != "" {
+				text += "\n\nOutput:\n" + out
+			}
+		}
+		if text == "" {
+			continue
+		}
+
+		sections = append(sections, Section{
+			Location: fmt.Sprintf("cell %d (%s)", i+1, cell.CellType),
+			Text:     text,
+		})
+	}
+
+	meta := make(map[string]string)
+	if lang := nb.Metadata.Kernelspec.Language; lang != "" {
+		meta["language"] = lang
+	} else if lang := nb.Metadata.LanguageInfo.Name; lang != "" {
+		meta["language"] = lang
+	}
+
+	doc := newSectionedDocument(sections, meta)
+	doc.PackSections = true
+	return []Document{doc}, nil
+}
+
+func cellOutputs(outputs []notebookOutput) string {
+	var texts []string
+	for _, o := range outputs {
+		var text string
+		switch o.OutputType {
+		case "stream":
+			text = string(o.Text)
+		case "execute_result", "display_data":
+			text = string(o.Data["text/plain"])
+		case "error":
+			text = fmt.Sprintf("%s: %s", o.Ename, o.Evalue)
+		}
+
+		if text = strings.TrimSpace(text); text != "" {
+			texts = append(texts, text)
+		}
+	}
+
+	return strings.Join(texts, "\n")
+}
@@ -0,0 +1,44 @@
+package readers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_NotebookFileReader_CanRead(t *testing.T) {
+	r := NotebookFileReader{}
+	assert.True(t, r.CanRead("some/analysis.ipynb"))
+	assert.False(t, r.CanRead("some/analysis.py"))
+}
+
+func Test_NotebookFileReader_ReadDocuments(t *testing.T) {
+	r := NotebookFileReader{}
+
+	docs, err := r.ReadDocuments("testdata/test.ipynb")
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+
+	assert.True(t, docs[0].PackSections)
+	assert.Equal(t, map[string]string{"language": "python"}, docs[0].Meta)
+	assert.Equal(t, []Section{
+		{Location: "cell 1 (markdown)", Text: "# Analysis\nhello world"},
+		{Location: "cell 2 (code)", Text: "print('hello')"},
+		{Location: "cell 4 (code)", Text: "1 / 0"},
+	}, docs[0].Sections)
+}
+
+func Test_NotebookFileReader_ReadDocuments_Outputs(t *testing.T) {
+	r := NotebookFileReader{Outputs: true}
+
+	docs, err := r.ReadDocuments("testdata/test.ipynb")
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+
+	assert.Equal(t, []Section{
+		{Location: "cell 1 (markdown)", Text: "# Analysis\nhello world"},
+		{Location: "cell 2 (code)", Text: "print('hello')\n\nOutput:\nhello\n<Figure>"},
+		{Location: "cell 4 (code)", Text: "1 / 0\n\nOutput:\nZeroDivisionError: division by zero"},
+	}, docs[0].Sections)
+}
@@ -0,0 +1,333 @@
+package readers
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// PresentationFileReader reads PPTX and ODP slide decks slide by slide,
+// including speaker notes
+type PresentationFileReader struct{}
+
+type ooxmlRelationship struct {
+	ID     string `xml:"Id,attr"`
+	Type   string `xml:"Type,attr"`
+	Target string `xml:"Target,attr"`
+}
+
+type pptxPresentation struct {
+	Slides []struct {
+		RelID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sldIdLst>sldId"`
+}
+
+// slide is the text content of a single slide
+type slide struct {
+	title string
+	text  []string
+	notes []string
+}
+
+func (s slide) section(n int) Section {
+	location := fmt.Sprintf("slide %d", n)
+	if s.title != "" {
+		location += ": " + s.title
+	}
+
+	text := strings.Join(s.text, "\n")
+	if len(s.notes) > 0 {
+		text += "\n\nNotes:\n" + strings.Join(s.notes, "\n")
+	}
+
+	return Section{
+		Location: location,
+		Text:     text,
+	}
+}
+
+func (r *PresentationFileReader) CanRead(path string) bool {
+	return r.CanReadMIME(mimeHint(path))
+}
+
+func (r *PresentationFileReader) CanReadMIME(mimeType string) bool {
+	return mimeType == MimePptx || mimeType == MimeOdp
+}
+
+func (r *PresentationFileReader) ReadText(path string) (string, error) {
+	docs, err := r.ReadDocuments(path)
+	if err != nil {
+		return "", err
+	}
+
+	return documentText(docs), nil
+}
+
+func (r *PresentationFileReader) ReadDocuments(path string) ([]Document, error) {
+	return r.ReadMIME(path, mimeHint(path))
+}
+
+func (r *PresentationFileReader) ReadMIME(path, mimeType string) ([]Document, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open presentation: %w", err)
+	}
+	defer zr.Close()
+
+	var slides []slide
+	if mimeType == MimeOdp {
+		slides, err = readOdpSlides(&zr.Reader)
+	} else {
+		slides, err = readPptxSlides(&zr.Reader)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sections := make([]Section, 0, len(slides))
+	for i, s := range slides {
+		sections = append(sections, s.section(i+1))
+	}
+
+	return []Document{newSectionedDocument(sections, nil)}, nil
+}
+
+func readPptxSlides(zr *zip.Reader) ([]slide, error) {
+	var pres pptxPresentation
+	if err := decodeZipXML(zr, "ppt/presentation.xml", &pres); err != nil {
+		return nil, err
+	}
+
+	rels, err := readRelationships(zr, "ppt/presentation.xml")
+	if err != nil {
+		return nil, err
+	}
+
+	slides := make([]slide, 0, len(pres.Slides))
+	for _, s := range pres.Slides {
+		var slidePath string
+		for _, rel := range rels {
+			if rel.ID == s.RelID {
+				slidePath = rel.Target
+			}
+		}
+		if slidePath == "" {
+			return nil, fmt.Errorf("slide relationship %s not found", s.RelID)
+		}
+
+		sl, err := readPptxPart(zr, slidePath)
+		if err != nil {
+			return nil, err
+		}
+
+		slideRels, err := readRelationships(zr, slidePath)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, rel := range slideRels {
+			if !strings.HasSuffix(rel.Type, "/notesSlide") {
+				continue
+			}
+
+			notes, err := readPptxPart(zr, rel.Target)
+			if err != nil {
+				return nil, err
+			}
+			sl.notes = notes.text
+		}
+
+		slides = append(slides, sl)
+	}
+
+	return slides, nil
+}
+
+// readRelationships reads the relationships of an OOXML part with targets
+// resolved to paths inside the package
+func readRelationships(zr *zip.Reader, part string) ([]ooxmlRelationship, error) {
+	relsPath := path.Join(path.Dir(part), "_rels", path.Base(part)+".rels")
+
+	var rels struct {
+		Relationships []ooxmlRelationship `xml:"Relationship"`
+	}
+	err := decodeZipXML(zr, relsPath, &rels)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for i, rel := range rels.Relationships {
+		rels.Relationships[i].Target = path.Join(path.Dir(part), rel.Target)
+	}
+
+	return rels.Relationships, nil
+}
+
+// readPptxPart extracts the paragraphs of a slide or notes slide, skipping
+// slide number, date, header and footer placeholders
+func readPptxPart(zr *zip.Reader, name string) (slide, error) {
+	f, err := zr.Open(name)
+	if err != nil {
+		return slide{}, fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	defer f.Close()
+
+	var sl slide
+	var para strings.Builder
+	var shape []string
+	var placeholder string
+	inText := false
+
+	dec := xml.NewDecoder(f)
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return slide{}, fmt.Errorf("failed to parse %s: %w", name, err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "sp":
+				shape = nil
+				placeholder = ""
+			case "ph":
+				placeholder = attrValue(t, "type")
+			case "t":
+				inText = true
+			case "br":
+				para.WriteString("\n")
+			}
+		case xml.CharData:
+			if inText {
+				para.Write(t)
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				if para.Len() > 0 {
+					shape = append(shape, para.String())
+				}
+				para.Reset()
+			case "sp", "graphicFrame":
+				switch placeholder {
+				case "sldNum", "dt", "ftr", "hdr":
+				case "title", "ctrTitle":
+					sl.title = strings.Join(shape, " ")
+					sl.text = append(sl.text, shape...)
+				default:
+					sl.text = append(sl.text, shape...)
+				}
+				shape = nil
+				placeholder = ""
+			}
+		}
+	}
+
+	return sl, nil
+}
+
+// readOdpSlides extracts the pages of an OpenDocument presentation
+func readOdpSlides(zr *zip.Reader) ([]slide, error) {
+	f, err := zr.Open("content.xml")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open content.xml: %w", err)
+	}
+	defer f.Close()
+
+	var slides []slide
+	var cur *slide
+	var para strings.Builder
+	var frameClass string
+	inNotes := false
+	inPara := 0
+
+	dec := xml.NewDecoder(f)
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse content.xml: %w", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "page":
+				cur = &slide{}
+			case "notes":
+				inNotes = true
+			case "frame":
+				frameClass = attrValue(t, "class")
+			case "p", "h":
+				inPara++
+			case "s", "tab":
+				para.WriteString(" ")
+			case "line-break":
+				para.WriteString("\n")
+			}
+		case xml.CharData:
+			if inPara > 0 {
+				para.Write(t)
+			}
+		case xml.EndElement:
+			if cur == nil {
+				continue
+			}
+
+			switch t.Name.Local {
+			case "p", "h":
+				inPara--
+				if inPara > 0 || para.Len() == 0 {
+					continue
+				}
+
+				text := para.String()
+				para.Reset()
+				if inNotes {
+					cur.notes = append(cur.notes, text)
+					continue
+				}
+
+				if frameClass == "title" && cur.title == "" {
+					cur.title = text
+				}
+				cur.text = append(cur.text, text)
+			case "frame":
+				frameClass = ""
+			case "notes":
+				inNotes = false
+			case "page":
+				slides = append(slides, *cur)
+				cur = nil
+			}
+		}
+	}
+
+	return slides, nil
+}
+
+func attrValue(el xml.StartElement, local string) string {
+	for _, a := range el.Attr {
+		if a.Name.Local == local {
+			return a.Value
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,41 @@
+package readers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_PresentationFileReader_CanRead(t *testing.T) {
+	r := PresentationFileReader{}
+	assert.True(t, r.CanRead("some/deck.pptx"))
+	assert.True(t, r.CanRead("some/deck.odp"))
+	assert.False(t, r.CanRead("some/deck.ppt"))
+}
+
+func Test_PresentationFileReader_ReadDocuments_Pptx(t *testing.T) {
+	r := PresentationFileReader{}
+
+	docs, err := r.ReadDocuments("testdata/test.pptx")
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+
+	assert.Equal(t, []Section{
+		{Location: "slide 1: Greeting", Text: "Greeting\nhello\n\nNotes:\nsay hello first"},
+		{Location: "slide 2", Text: "world"},
+	}, docs[0].Sections)
+}
+
+func Test_PresentationFileReader_ReadDocuments_Odp(t *testing.T) {
+	r := PresentationFileReader{}
+
+	docs, err := r.ReadDocuments("testdata/test.odp")
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+
+	assert.Equal(t, []Section{
+		{Location: "slide 1: Greeting", Text: "Greeting\nhello there\n\nNotes:\nsay hello first"},
+		{Location: "slide 2", Text: "world"},
+	}, docs[0].Sections)
+}
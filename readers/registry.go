@@ -0,0 +1,111 @@
+package readers
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// plainTextExtensions are the extensions of the files read as plain text, along
+// with files without extension and the files of plainTextNames. Other files sniffed
+// as plain text, such as configuration files, are left to the readers selected by name.
+var plainTextExtensions = []string{".txt", ".text"}
+
+// plainTextNames are common text files read as plain text whatever their extension,
+// compared without extension and case
+var plainTextNames = []string{
+	"readme", "license", "licence", "copying", "authors", "changelog", "changes",
+	"contributing", "notice", "makefile", "dockerfile",
+}
+
+// secretNames and secretExtensions are never read as plain text, as they usually
+// hold credentials. Files named .env.* are excluded as well.
+var (
+	secretNames = []string{
+		".env", "id_rsa", "id_dsa", "id_ecdsa", "id_ed25519", ".netrc", ".pgpass",
+		".htpasswd", ".npmrc", ".pypirc", "credentials",
+	}
+	secretExtensions = []string{".key", ".pem"}
+)
+
+// MimeReader is implemented by readers selected by the detected MIME type of a
+// file rather than by its extension
+type MimeReader interface {
+	CanReadMIME(mimeType string) bool
+	ReadMIME(path, mimeType string) ([]Document, error)
+}
+
+// ExtensionReader is implemented by MIME readers also selected by the extension of
+// the file name, whatever its detected type
+type ExtensionReader interface {
+	CanReadExtension(name string) bool
+}
+
+// Registry selects readers for files. Readers with a higher priority are tried
+// first, readers with equal priority are tried in registration order.
+type Registry struct {
+	readers []registeredReader
+}
+
+type registeredReader struct {
+	reader   TextReader
+	priority int
+}
+
+func (r *Registry) Register(reader TextReader, priority int) {
+	i := slices.IndexFunc(r.readers, func(rr registeredReader) bool {
+		return rr.priority < priority
+	})
+	if i < 0 {
+		i = len(r.readers)
+	}
+
+	r.readers = slices.Insert(r.readers, i, registeredReader{
+		reader:   reader,
+		priority: priority,
+	})
+}
+
+// Find selects a reader for the file at path, named name in the documents tree,
+// and returns it with the detected MIME type. MIME readers are matched by the
+// sniffed type, other readers by name. Plain text is only matched by type for the
+// files passing readsAsPlainText.
+func (r *Registry) Find(path, name string) (TextReader, string, error) {
+	// detection only fails for unreadable files, those are reported by the reader
+	mimeType, _ := DetectMIME(path, name)
+	byContent := mimeType != MimeText || readsAsPlainText(name)
+
+	for _, rr := range r.readers {
+		if mr, ok := rr.reader.(MimeReader); ok {
+			if byContent && mr.CanReadMIME(mimeType) || canReadExtension(rr.reader, name) {
+				return rr.reader, mimeType, nil
+			}
+			continue
+		}
+
+		if rr.reader.CanRead(name) {
+			return rr.reader, mimeType, nil
+		}
+	}
+
+	return nil, mimeType, fmt.Errorf("unable to find reader for file: %s (%s)", name, mimeType)
+}
+
+// readsAsPlainText reports whether a file sniffed as plain text is matched by type:
+// files of plainTextExtensions or plainTextNames and files without extension,
+// unless they are known to hold secrets
+func readsAsPlainText(name string) bool {
+	base := strings.ToLower(filepath.Base(name))
+	ext := filepath.Ext(base)
+	if slices.Contains(secretNames, base) || strings.HasPrefix(base, ".env.") || slices.Contains(secretExtensions, ext) {
+		return false
+	}
+
+	return ext == "" || slices.Contains(plainTextExtensions, ext) || slices.Contains(plainTextNames, strings.TrimSuffix(base, ext))
+}
+
+func canReadExtension(reader TextReader, name string) bool {
+	er, ok := reader.(ExtensionReader)
+	return ok && er.CanReadExtension(name)
+}
@@ -0,0 +1,118 @@
+package readers
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type namedReader struct {
+	ext string
+}
+
+func (r *namedReader) CanRead(path string) bool {
+	return strings.HasSuffix(path, r.ext)
+}
+
+func (r *namedReader) ReadText(path string) (string, error) {
+	return "", nil
+}
+
+func Test_Registry_Find_ByContent(t *testing.T) {
+	var reg Registry
+	reg.Register(&TxtFileReader{}, 0)
+	reg.Register(&UniversalFileReader{}, 0)
+
+	path := copyTestFile(t, "testdata/test.pdf", "report.txt")
+	r, mimeType, err := reg.Find(path, "report.txt")
+	require.NoError(t, err)
+	assert.Equal(t, MimePDF, mimeType)
+	assert.IsType(t, &UniversalFileReader{}, r)
+
+	r, mimeType, err = reg.Find("testdata/test.txt", "test.txt")
+	require.NoError(t, err)
+	assert.Equal(t, MimeText, mimeType)
+	assert.IsType(t, &TxtFileReader{}, r)
+}
+
+func Test_Registry_Find_Priority(t *testing.T) {
+	override := &namedReader{ext: ".pdf"}
+
+	var reg Registry
+	reg.Register(&UniversalFileReader{}, 0)
+	reg.Register(override, 10)
+
+	r, _, err := reg.Find("testdata/test.pdf", "test.pdf")
+	require.NoError(t, err)
+	assert.Same(t, override, r)
+
+	r, _, err = reg.Find("testdata/test.docx", "test.docx")
+	require.NoError(t, err)
+	assert.IsType(t, &UniversalFileReader{}, r)
+}
+
+func Test_Registry_Find_RegistrationOrder(t *testing.T) {
+	first := &namedReader{ext: ".bin"}
+	second := &namedReader{ext: ".bin"}
+
+	var reg Registry
+	reg.Register(first, 0)
+	reg.Register(second, 0)
+
+	r, _, err := reg.Find("testdata/data.bin", "data.bin")
+	require.NoError(t, err)
+	assert.Same(t, first, r)
+}
+
+func Test_Registry_Find_Unsupported(t *testing.T) {
+	var reg Registry
+	reg.Register(&TxtFileReader{}, 0)
+
+	_, _, err := reg.Find("testdata/test.pdf", "test.pdf")
+	assert.Error(t, err)
+}
+
+func Test_Registry_Find_PlainTextExtensions(t *testing.T) {
+	var reg Registry
+	reg.Register(&TxtFileReader{}, 0)
+	reg.Register(&UniversalFileReader{}, 0)
+
+	for _, name := range []string{".env", ".env.local", "id_rsa", "deploy.key", "app.conf"} {
+		path := copyTestFile(t, "testdata/test.txt", name)
+		_, mimeType, err := reg.Find(path, name)
+		assert.Error(t, err, name)
+		assert.Equal(t, MimeText, mimeType, name)
+	}
+
+	for _, name := range []string{"notes.TXT", "notes", "README", "LICENSE.md", "Makefile", "docs.zip!/README"} {
+		path := copyTestFile(t, "testdata/test.txt", filepath.Base(name))
+		r, _, err := reg.Find(path, name)
+		require.NoError(t, err, name)
+		assert.IsType(t, &TxtFileReader{}, r, name)
+	}
+}
+
+func Test_Registry_Find_CommandReader(t *testing.T) {
+	ocr := &CommandFileReader{Name: "ocr", MimeTypes: []string{MimePDF}}
+	rst := &CommandFileReader{Name: "pandoc", Extensions: []string{".rst"}}
+
+	var reg Registry
+	reg.Register(&UniversalFileReader{}, 0)
+	reg.Register(ocr, 10)
+	reg.Register(rst, 10)
+
+	// sniffed type, whatever the extension
+	path := copyTestFile(t, "testdata/test.pdf", "scan.bin")
+	r, _, err := reg.Find(path, "scan.bin")
+	require.NoError(t, err)
+	assert.Same(t, ocr, r)
+
+	// configured extension, whatever the content
+	path = copyTestFile(t, "testdata/test.txt", "readme.rst")
+	r, _, err = reg.Find(path, "readme.rst")
+	require.NoError(t, err)
+	assert.Same(t, rst, r)
+}
@@ -4,20 +4,34 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 type TxtFileReader struct{}
 
 func (r *TxtFileReader) CanRead(path string) bool {
-	ext := filepath.Ext(path)
+	ext := strings.ToLower(filepath.Ext(path))
 	return ext == ".txt"
 }
 
+func (r *TxtFileReader) CanReadMIME(mimeType string) bool {
+	return mimeType == MimeText || mimeType == "text/markdown" || mimeType == "text/csv"
+}
+
+func (r *TxtFileReader) ReadMIME(path, mimeType string) ([]Document, error) {
+	text, err := r.ReadText(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return []Document{{Text: text}}, nil
+}
+
 func (r *TxtFileReader) ReadText(path string) (string, error) {
 	buf, err := os.ReadFile(path)
 	if err != nil {
 		return "", fmt.Errorf("reading text file: %w", err)
 	}
 
-	return string(buf), nil
+	return DecodeText(buf)
 }
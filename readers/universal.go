@@ -2,24 +2,68 @@ package readers
 
 import (
 	"fmt"
-	"path/filepath"
+	"os"
+	"slices"
 
 	"code.sajari.com/docconv/v2"
 )
 
+var universalMimeTypes = []string{MimeText, MimeXML, "application/xml", MimePDF, MimeDocx, MimeOdt}
+
+// UniversalFileReader reads common document formats. Books and slide decks are
+// read with format specific readers keeping chapter and slide locations.
 type UniversalFileReader struct {
+	epub         EpubFileReader
+	presentation PresentationFileReader
 }
 
 func (r *UniversalFileReader) CanRead(path string) bool {
-	ext := filepath.Ext(path)
-	return ext == ".txt" || ext == ".docx" || ext == ".odt" || ext == ".pdf" || ext == ".xml"
+	return r.CanReadMIME(mimeHint(path))
+}
+
+func (r *UniversalFileReader) CanReadMIME(mimeType string) bool {
+	return slices.Contains(universalMimeTypes, mimeType) ||
+		r.epub.CanReadMIME(mimeType) ||
+		r.presentation.CanReadMIME(mimeType)
 }
 
 func (r *UniversalFileReader) ReadText(path string) (string, error) {
-	res, err := docconv.ConvertPath(path)
+	docs, err := r.ReadDocuments(path)
+	if err != nil {
+		return "", err
+	}
+
+	return documentText(docs), nil
+}
+
+func (r *UniversalFileReader) ReadDocuments(path string) ([]Document, error) {
+	mimeType, err := DetectMIME(path, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read document: %w", err)
+	}
+
+	return r.ReadMIME(path, mimeType)
+}
+
+func (r *UniversalFileReader) ReadMIME(path, mimeType string) ([]Document, error) {
+	if r.epub.CanReadMIME(mimeType) {
+		return r.epub.ReadMIME(path, mimeType)
+	}
+
+	if r.presentation.CanReadMIME(mimeType) {
+		return r.presentation.ReadMIME(path, mimeType)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read document: %w", err)
+	}
+	defer f.Close()
+
+	res, err := docconv.Convert(f, mimeType, false)
 	if err != nil {
-		return "", fmt.Errorf("failed to read document: %w", err)
+		return nil, fmt.Errorf("failed to read document: %w", err)
 	}
 
-	return res.Body, nil
+	return []Document{{Text: res.Body}}, nil
 }
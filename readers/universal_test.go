@@ -15,6 +15,9 @@ func Test_UniversalFileReader_CanRead(t *testing.T) {
 	assert.True(t, r.CanRead("some/file.pdf"))
 	assert.True(t, r.CanRead("some/file.txt"))
 	assert.True(t, r.CanRead("some/file.xml"))
+	assert.True(t, r.CanRead("some/file.epub"))
+	assert.True(t, r.CanRead("some/file.pptx"))
+	assert.True(t, r.CanRead("some/file.odp"))
 }
 
 func Test_UniversalFileReader_ReadText(t *testing.T) {
@@ -40,3 +43,17 @@ func Test_UniversalFileReader_ReadText(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, "hello world", strings.TrimSpace(txt))
 }
+
+func Test_UniversalFileReader_ReadDocuments_Sections(t *testing.T) {
+	r := UniversalFileReader{}
+
+	docs, err := r.ReadDocuments("testdata/test.epub")
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	assert.Len(t, docs[0].Sections, 2)
+
+	docs, err = r.ReadDocuments("testdata/test.pptx")
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	assert.Len(t, docs[0].Sections, 2)
+}
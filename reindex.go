@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// indexStorer is implemented by stores recording the configuration their index was
+// built with, and able to rebuild the index in a shadow collection while serving
+// searches from the current one
+type indexStorer interface {
+	Fingerprint() string
+	SetFingerprint(ctx context.Context, fingerprint string) error
+	ResetIndex(ctx context.Context) error
+	BeginRebuild(ctx context.Context) error
+	CommitRebuild(ctx context.Context, fingerprint string) error
+	AbortRebuild(ctx context.Context) error
+}
+
+// indexFingerprint describes the configuration an index was built with. Vectors of
+// different embedding models can't be mixed, so an embedding change rebuilds the
+// whole index. Chunking changes are picked up per document by profile ids.
+type indexFingerprint struct {
+	Embedding string `json:"embedding"`
+	Chunking  string `json:"chunking"`
+}
+
+func (f indexFingerprint) isZero() bool {
+	return f == indexFingerprint{}
+}
+
+func (f indexFingerprint) String() string {
+	raw, _ := json.Marshal(f)
+	return string(raw)
+}
+
+func parseFingerprint(s string) (indexFingerprint, error) {
+	var f indexFingerprint
+	if err := json.Unmarshal([]byte(s), &f); err != nil {
+		return indexFingerprint{}, fmt.Errorf("invalid index fingerprint %q: %w", s, err)
+	}
+
+	return f, nil
+}
+
+// syncIndex syncs the documents, rebuilding the index first if it was built with
+// a different embedding configuration. Indexes without a fingerprint were built
+// before fingerprints were recorded and are assumed to match.
+func (dr *DocRegistry) syncIndex(ctx context.Context, is indexStorer) error {
+	stored := is.Fingerprint()
+	if stored == dr.fingerprint.String() {
+		dr.indexChunking = dr.fingerprint.Chunking
+		return dr.syncDocs(ctx)
+	}
+
+	dr.indexChunking = ""
+	if stored != "" {
+		f, err := parseFingerprint(stored)
+		if err != nil || f.Embedding != dr.fingerprint.Embedding {
+			dr.log.Warn("index configuration changed, rebuilding index",
+				"stored", stored, "current", dr.fingerprint.String(), "shadow", dr.rebuildInShadow)
+			return dr.rebuild(ctx, is)
+		}
+
+		dr.indexChunking = f.Chunking
+	}
+
+	if err := dr.syncDocs(ctx); err != nil {
+		return err
+	}
+
+	if err := is.SetFingerprint(ctx, dr.fingerprint.String()); err != nil {
+		return fmt.Errorf("record index fingerprint: %w", err)
+	}
+
+	return nil
+}
+
+// rebuild re-ingests all documents. In shadow mode the new index is built aside and
+// swapped in when complete, otherwise the current index is replaced with an empty
+// one first, as an index can't hold vectors of another dimensionality.
+func (dr *DocRegistry) rebuild(ctx context.Context, is indexStorer) error {
+	if !dr.rebuildInShadow {
+		if err := is.ResetIndex(ctx); err != nil {
+			return fmt.Errorf("reset index: %w", err)
+		}
+
+		if err := dr.syncDocs(ctx); err != nil {
+			return err
+		}
+
+		if err := is.SetFingerprint(ctx, dr.fingerprint.String()); err != nil {
+			return fmt.Errorf("record index fingerprint: %w", err)
+		}
+
+		return nil
+	}
+
+	return dr.rebuildShadow(ctx, is)
+}
+
+// Reindex rebuilds the whole index in a shadow collection, while searches are served
+// by the current one. The shadow collection replaces the current one once all
+// documents are ingested, on failure it is dropped and the current one is kept.
+func (dr *DocRegistry) Reindex(ctx context.Context) error {
+	dr.syncMu.Lock()
+	defer dr.syncMu.Unlock()
+
+	is, ok := dr.storer.(indexStorer)
+	if !ok {
+		return errors.New("store does not support reindexing")
+	}
+
+	err := ensureDir(dr.root)
+	if err != nil {
+		return fmt.Errorf("failed to create documents directory: %w", err)
+	}
+
+	return dr.rebuildShadow(ctx, is)
+}
+
+func (dr *DocRegistry) rebuildShadow(ctx context.Context, is indexStorer) error {
+	dr.log.Info("rebuilding index in shadow collection")
+	dr.setRebuilding(true)
+	defer dr.setRebuilding(false)
+
+	if err := is.BeginRebuild(ctx); err != nil {
+		return fmt.Errorf("begin rebuild: %w", err)
+	}
+
+	if err := dr.syncDocs(ctx); err != nil {
+		if abortErr := is.AbortRebuild(context.WithoutCancel(ctx)); abortErr != nil {
+			dr.log.Error("failed to abort rebuild", "error", abortErr)
+		}
+
+		return fmt.Errorf("rebuild aborted: %w", err)
+	}
+
+	if err := is.CommitRebuild(ctx, dr.fingerprint.String()); err != nil {
+		if abortErr := is.AbortRebuild(context.WithoutCancel(ctx)); abortErr != nil {
+			dr.log.Error("failed to abort rebuild", "error", abortErr)
+		}
+
+		return fmt.Errorf("commit rebuild: %w", err)
+	}
+
+	status := dr.Status()
+	dr.log.Info("index rebuilt",
+		"fingerprint", dr.fingerprint.String(),
+		"documents", status.Done,
+		"elapsed", time.Since(status.Started).Round(time.Second).String())
+	return nil
+}
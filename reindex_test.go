@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/gamma-omg/rag-mcp/docstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeIndexStore keeps the active and the shadow index in memory
+type fakeIndexStore struct {
+	fakeDocStore
+	fingerprint string
+	active      []docstore.IngestedDoc
+	rebuilding  bool
+	reset       bool
+	committed   bool
+	aborted     bool
+}
+
+func (s *fakeIndexStore) Fingerprint() string { return s.fingerprint }
+
+func (s *fakeIndexStore) SetFingerprint(ctx context.Context, fingerprint string) error {
+	s.fingerprint = fingerprint
+	return nil
+}
+
+func (s *fakeIndexStore) ResetIndex(ctx context.Context) error {
+	s.ingested = nil
+	s.fingerprint = ""
+	s.reset = true
+	return nil
+}
+
+func (s *fakeIndexStore) BeginRebuild(ctx context.Context) error {
+	s.active = s.ingested
+	s.ingested = nil
+	s.rebuilding = true
+	return nil
+}
+
+func (s *fakeIndexStore) CommitRebuild(ctx context.Context, fingerprint string) error {
+	s.active = nil
+	s.fingerprint = fingerprint
+	s.rebuilding = false
+	s.committed = true
+	return nil
+}
+
+func (s *fakeIndexStore) AbortRebuild(ctx context.Context) error {
+	s.ingested = s.active
+	s.rebuilding = false
+	s.aborted = true
+	return nil
+}
+
+func newReindexRegistry(t *testing.T, store docStorer, shadow bool) *DocRegistry {
+	t.Helper()
+
+	tmp := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tmp, "f1.txt"), []byte("first"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(tmp, "f2.txt"), []byte("second"), 0o644))
+
+	reg := &DocRegistry{
+		log:             slog.New(slog.NewTextHandler(io.Discard, nil)),
+		root:            tmp,
+		storer:          store,
+		chunkifier:      &DefaultChunkfier{chunkSize: 16},
+		fingerprint:     indexFingerprint{Embedding: "openai/text-embedding-3-large/0", Chunking: "default@1"},
+		rebuildInShadow: shadow,
+	}
+	reg.RegisterReader(&mockTextReader{})
+	return reg
+}
+
+func Test_Sync_RecordsFingerprint(t *testing.T) {
+	store := &fakeIndexStore{}
+	reg := newReindexRegistry(t, store, true)
+
+	require.NoError(t, reg.Sync(context.Background()))
+
+	assert.Equal(t, reg.fingerprint.String(), store.fingerprint)
+	assert.ElementsMatch(t, []string{"f1.txt", "f2.txt"}, store.getIngestCalls())
+	assert.False(t, store.committed)
+}
+
+func Test_Sync_EmbeddingChange_Shadow(t *testing.T) {
+	store := &fakeIndexStore{
+		fingerprint: indexFingerprint{Embedding: "openai/text-embedding-3-small/0", Chunking: "default@1"}.String(),
+		fakeDocStore: fakeDocStore{
+			ingested: []docstore.IngestedDoc{{File: "f1.txt", Crc: 1}},
+		},
+	}
+	reg := newReindexRegistry(t, store, true)
+
+	require.NoError(t, reg.Sync(context.Background()))
+
+	assert.True(t, store.committed)
+	assert.Equal(t, reg.fingerprint.String(), store.fingerprint)
+	assert.ElementsMatch(t, []string{"f1.txt", "f2.txt"}, store.getIngestCalls())
+	assert.Empty(t, store.getForgetCalls())
+}
+
+func Test_Sync_EmbeddingChange_InPlace(t *testing.T) {
+	store := &fakeIndexStore{
+		fingerprint: indexFingerprint{Embedding: "gemini/text-embedding-004"}.String(),
+		fakeDocStore: fakeDocStore{
+			ingested: []docstore.IngestedDoc{{File: "f1.txt", Crc: 1}, {File: "old.txt", Crc: 2}},
+		},
+	}
+	reg := newReindexRegistry(t, store, false)
+
+	require.NoError(t, reg.Sync(context.Background()))
+
+	assert.False(t, store.committed)
+	assert.True(t, store.reset)
+	assert.Equal(t, reg.fingerprint.String(), store.fingerprint)
+	assert.Empty(t, store.getForgetCalls())
+	assert.ElementsMatch(t, []string{"f1.txt", "f2.txt"}, store.getIngestCalls())
+}
+
+func Test_Sync_ChunkingChange_NoRebuild(t *testing.T) {
+	store := &fakeIndexStore{
+		fingerprint: indexFingerprint{Embedding: "openai/text-embedding-3-large/0", Chunking: "default@0"}.String(),
+	}
+	reg := newReindexRegistry(t, store, true)
+
+	require.NoError(t, reg.Sync(context.Background()))
+
+	assert.False(t, store.committed)
+	assert.Equal(t, reg.fingerprint.String(), store.fingerprint)
+}
+
+func Test_Sync_ChunkingChange_LegacyDocs(t *testing.T) {
+	crc := func(s string) uint32 { return crc32.ChecksumIEEE([]byte(s)) }
+	legacy := []docstore.IngestedDoc{
+		{File: "f1.txt", Crc: crc("first")},
+		{File: "f2.txt", Crc: crc("second")},
+	}
+
+	for chunking, reingested := range map[string][]string{
+		"default@1": nil,
+		"default@0": {"f1.txt", "f2.txt"},
+	} {
+		store := &fakeIndexStore{
+			fakeDocStore: fakeDocStore{ingested: slices.Clone(legacy)},
+			fingerprint:  indexFingerprint{Embedding: "openai/text-embedding-3-large/0", Chunking: chunking}.String(),
+		}
+		reg := newReindexRegistry(t, store, true)
+		reg.defaultProfile = "default@1"
+
+		require.NoError(t, reg.Sync(context.Background()))
+
+		assert.False(t, store.committed, chunking)
+		assert.ElementsMatch(t, reingested, store.getIngestCalls(), chunking)
+	}
+}
+
+func Test_Sync_RebuildAborted(t *testing.T) {
+	stored := indexFingerprint{Embedding: "openai/text-embedding-3-small/0"}.String()
+	store := &fakeIndexStore{
+		fingerprint: stored,
+		fakeDocStore: fakeDocStore{
+			ingested:   []docstore.IngestedDoc{{File: "f1.txt", Crc: 1}},
+			failIngest: true,
+		},
+	}
+	reg := newReindexRegistry(t, store, true)
+
+	assert.Error(t, reg.Sync(context.Background()))
+
+	assert.True(t, store.aborted)
+	assert.False(t, store.committed)
+	assert.Equal(t, stored, store.fingerprint)
+	assert.Equal(t, []docstore.IngestedDoc{{File: "f1.txt", Crc: 1}}, store.ingested)
+}
+
+func Test_Reindex(t *testing.T) {
+	store := &fakeIndexStore{
+		fingerprint: indexFingerprint{Embedding: "openai/text-embedding-3-large/0", Chunking: "default@1"}.String(),
+		fakeDocStore: fakeDocStore{
+			ingested: []docstore.IngestedDoc{{File: "f1.txt", Crc: 1}},
+		},
+	}
+	reg := newReindexRegistry(t, store, false)
+
+	require.NoError(t, reg.Reindex(context.Background()))
+
+	assert.True(t, store.committed)
+	assert.Empty(t, store.getForgetCalls())
+	assert.ElementsMatch(t, []string{"f1.txt", "f2.txt"}, store.getIngestCalls())
+
+	status := reg.Status()
+	assert.False(t, status.Rebuilding)
+	assert.Equal(t, 2, status.Total)
+	assert.Equal(t, 2, status.Done)
+}
+
+func Test_Reindex_Cancelled(t *testing.T) {
+	store := &fakeIndexStore{
+		fakeDocStore: fakeDocStore{
+			ingested: []docstore.IngestedDoc{{File: "f1.txt", Crc: 1}},
+		},
+	}
+	reg := newReindexRegistry(t, store, true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.ErrorIs(t, reg.Reindex(ctx), context.Canceled)
+	assert.True(t, store.aborted)
+	assert.False(t, store.committed)
+	assert.False(t, reg.Status().Rebuilding)
+	assert.Equal(t, []docstore.IngestedDoc{{File: "f1.txt", Crc: 1}}, store.ingested)
+}
+
+func Test_Reindex_Unsupported(t *testing.T) {
+	reg := newReindexRegistry(t, &fakeDocStore{}, true)
+	assert.Error(t, reg.Reindex(context.Background()))
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/amikos-tech/chroma-go/pkg/embeddings"
+	"github.com/fsnotify/fsnotify"
+	"gopkg.in/yaml.v3"
+)
+
+// reloadDelay waits for an editor to be done saving the config file
+const reloadDelay = 500 * time.Millisecond
+
+var (
+	// liveSettings are applied while serving, as YAML paths or prefixes of paths
+	liveSettings = []string{"results", "log_level", "auth", "open_ai.rate_limit", "gemini.rate_limit"}
+	// reindexSettings change the chunks or vectors of documents already ingested
+	reindexSettings = []string{
+		"chunk_size", "chunk_overlap", "chunk_unit", "parent_chunk_size", "parent_chunk_overlap",
+		"tokenizer", "max_tokens", "chunk_profiles", "command_readers", "archives", "email",
+		"notebook", "open_ai.model", "open_ai.dimensions", "gemini.model",
+	}
+)
+
+// configChanges lists the settings changed in the config file by how they take effect
+type configChanges struct {
+	Live    []string
+	Restart []string
+	Reindex []string
+}
+
+func (c configChanges) empty() bool {
+	return len(c.Live) == 0 && len(c.Restart) == 0 && len(c.Reindex) == 0
+}
+
+// diffConfig compares two configurations setting by setting, lists are compared
+// as a whole
+func diffConfig(old, cur *Config) (configChanges, error) {
+	before, err := flattenConfig(old)
+	if err != nil {
+		return configChanges{}, err
+	}
+	after, err := flattenConfig(cur)
+	if err != nil {
+		return configChanges{}, err
+	}
+
+	keys := make(map[string]struct{})
+	for k := range before {
+		keys[k] = struct{}{}
+	}
+	for k := range after {
+		keys[k] = struct{}{}
+	}
+
+	var changes configChanges
+	for k := range keys {
+		if reflect.DeepEqual(before[k], after[k]) {
+			continue
+		}
+
+		switch {
+		case matchesSetting(k, liveSettings):
+			changes.Live = append(changes.Live, k)
+		case matchesSetting(k, reindexSettings):
+			changes.Reindex = append(changes.Reindex, k)
+		default:
+			changes.Restart = append(changes.Restart, k)
+		}
+	}
+	slices.Sort(changes.Live)
+	slices.Sort(changes.Restart)
+	slices.Sort(changes.Reindex)
+
+	return changes, nil
+}
+
+func matchesSetting(key string, settings []string) bool {
+	return slices.ContainsFunc(settings, func(s string) bool {
+		return key == s || strings.HasPrefix(key, s+".")
+	})
+}
+
+// flattenConfig maps the YAML paths of the settings to their values
+func flattenConfig(cfg *Config) (map[string]any, error) {
+	raw, err := yaml.Marshal(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode config: %w", err)
+	}
+
+	var tree map[string]any
+	if err := yaml.Unmarshal(raw, &tree); err != nil {
+		return nil, fmt.Errorf("failed to encode config: %w", err)
+	}
+
+	res := make(map[string]any)
+	var walk func(prefix string, m map[string]any)
+	walk = func(prefix string, m map[string]any) {
+		for k, v := range m {
+			if sub, ok := v.(map[string]any); ok {
+				walk(prefix+k+".", sub)
+				continue
+			}
+			res[prefix+k] = v
+		}
+	}
+	walk("", tree)
+
+	return res, nil
+}
+
+type resultsSetter interface {
+	SetResults(n int)
+}
+
+type rateLimitSetter interface {
+	SetLimits(rl RateLimitConfig)
+}
+
+type keySetter interface {
+	SetKeys(keys []APIKeyConfig)
+}
+
+// configReloader reads the config file again when it changes or on SIGHUP, applies
+// the settings safe to change while serving and reports the others
+type configReloader struct {
+	path  string
+	log   *slog.Logger
+	level *slog.LevelVar
+	store resultsSetter
+	ef    embeddings.EmbeddingFunction
+	auth  keySetter
+
+	mu      sync.Mutex
+	current *Config
+}
+
+// Reload applies the changes of the config file. Invalid files are rejected as a
+// whole, keeping the current settings.
+func (r *configReloader) Reload() (configChanges, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cfg, err := readConfig(r.path)
+	if err != nil {
+		return configChanges{}, err
+	}
+
+	changes, err := diffConfig(r.current, cfg)
+	if err != nil {
+		return configChanges{}, err
+	}
+
+	// the other settings keep their startup values, so that they are reported by
+	// every reload until the restart
+	r.current = mergeLive(r.current, cfg)
+
+	r.level.Set(r.current.logLevel())
+	r.store.SetResults(r.current.Results)
+	if r.auth != nil {
+		r.auth.SetKeys(r.current.Auth.Keys)
+	}
+	if rl, ok := r.ef.(rateLimitSetter); ok {
+		switch {
+		case r.current.OpenAI != nil:
+			rl.SetLimits(r.current.OpenAI.RateLimit)
+		case r.current.Gemini != nil:
+			rl.SetLimits(r.current.Gemini.RateLimit)
+		}
+	}
+
+	return changes, nil
+}
+
+// mergeLive returns the current configuration updated with the live settings of cfg.
+// Rate limits are only taken from the provider in use.
+func mergeLive(current, cfg *Config) *Config {
+	merged := *current
+	merged.Results = cfg.Results
+	merged.LogLevel = cfg.LogLevel
+	merged.Auth = cfg.Auth
+	if merged.OpenAI != nil && cfg.OpenAI != nil {
+		openAI := *merged.OpenAI
+		openAI.RateLimit = cfg.OpenAI.RateLimit
+		merged.OpenAI = &openAI
+	}
+	if merged.Gemini != nil && cfg.Gemini != nil {
+		gemini := *merged.Gemini
+		gemini.RateLimit = cfg.Gemini.RateLimit
+		merged.Gemini = &gemini
+	}
+
+	return &merged
+}
+
+func (r *configReloader) reload(trigger string) {
+	changes, err := r.Reload()
+	if err != nil {
+		r.log.Error("config not reloaded, keeping the current settings", "trigger", trigger, "error", err)
+		return
+	}
+
+	if changes.empty() {
+		r.log.Info("config reloaded, nothing changed", "trigger", trigger)
+		return
+	}
+	if len(changes.Live) > 0 {
+		r.log.Info("config reloaded", "trigger", trigger, "applied", changes.Live)
+	}
+	if len(changes.Restart) > 0 {
+		r.log.Warn("config changes apply after a restart", "settings", changes.Restart)
+	}
+	if len(changes.Reindex) > 0 {
+		r.log.Warn("config changes apply after a restart with -reindex", "settings", changes.Reindex)
+	}
+}
+
+// Run reloads the config on SIGHUP and when the file changes, until ctx is done.
+// The directory of the file is watched, as editors and mounted volumes replace it.
+func (r *configReloader) Run(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var events <-chan fsnotify.Event
+	var errs <-chan error
+	w, err := fsnotify.NewWatcher()
+	if err == nil {
+		defer w.Close()
+		err = w.Add(filepath.Dir(r.path))
+	}
+	if err != nil {
+		r.log.Warn("not watching the config file, send SIGHUP to reload it", "error", err)
+	} else {
+		events, errs = w.Events, w.Errors
+	}
+
+	file := filepath.Clean(r.path)
+	var changed <-chan time.Time
+	for {
+		select {
+		case e := <-events:
+			if filepath.Clean(e.Name) == file && e.Op != fsnotify.Chmod {
+				changed = time.After(reloadDelay)
+			}
+		case <-changed:
+			changed = nil
+			r.reload("file")
+		case err := <-errs:
+			r.log.Warn("error watching the config file", "error", err)
+		case <-hup:
+			r.reload("SIGHUP")
+		case <-ctx.Done():
+			return
+		}
+	}
+}
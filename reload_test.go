@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const reloadConfig = `
+log_level: info
+results: 5
+chunk_size: 512
+server_addr: ":3001"
+open_ai:
+  model: text-embedding-3-small
+  api_key: key
+  rate_limit:
+    requests_per_minute: 100
+`
+
+type fakeResults struct {
+	n atomic.Int64
+}
+
+func (r *fakeResults) SetResults(n int) {
+	r.n.Store(int64(n))
+}
+
+func newTestReloader(t *testing.T) (*configReloader, *fakeResults, *rateLimitedEmbedder) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(reloadConfig), 0o644))
+
+	cfg, err := readConfig(path)
+	require.NoError(t, err)
+
+	store := &fakeResults{}
+	ef := &rateLimitedEmbedder{}
+	ef.SetLimits(cfg.OpenAI.RateLimit)
+	r := &configReloader{
+		path:    path,
+		log:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+		level:   new(slog.LevelVar),
+		store:   store,
+		ef:      ef,
+		current: cfg,
+	}
+
+	return r, store, ef
+}
+
+func Test_diffConfig(t *testing.T) {
+	old, err := parseConfig([]byte(reloadConfig), env(nil))
+	require.NoError(t, err)
+	cur, err := parseConfig([]byte(reloadConfig), env(map[string]string{
+		"RAG_RESULTS": "10",
+		"RAG_OPEN_AI_RATE_LIMIT_TOKENS_PER_MINUTE": "5000",
+		"RAG_CHUNK_SIZE":    "256",
+		"RAG_SERVER_ADDR":   ":4000",
+		"RAG_OPEN_AI_MODEL": "text-embedding-3-large",
+	}))
+	require.NoError(t, err)
+
+	changes, err := diffConfig(old, cur)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"open_ai.rate_limit.tokens_per_minute", "results"}, changes.Live)
+	assert.Equal(t, []string{"server_addr"}, changes.Restart)
+	assert.Equal(t, []string{"chunk_size", "open_ai.model"}, changes.Reindex)
+
+	changes, err = diffConfig(old, old)
+	require.NoError(t, err)
+	assert.True(t, changes.empty())
+}
+
+func Test_configReloader_Reload(t *testing.T) {
+	r, store, ef := newTestReloader(t)
+
+	updated := `
+log_level: debug
+results: 8
+chunk_size: 256
+server_addr: ":3001"
+open_ai:
+  model: text-embedding-3-small
+  api_key: key
+  rate_limit:
+    requests_per_minute: 100
+    batch_size: 16
+`
+	require.NoError(t, os.WriteFile(r.path, []byte(updated), 0o644))
+
+	changes, err := r.Reload()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"log_level", "open_ai.rate_limit.batch_size", "results"}, changes.Live)
+	assert.Equal(t, []string{"chunk_size"}, changes.Reindex)
+	assert.Equal(t, int64(8), store.n.Load())
+	assert.Equal(t, slog.LevelDebug, r.level.Level())
+	assert.Equal(t, 16, ef.batchSize)
+
+	// settings needing a restart are reported until the restart
+	changes, err = r.Reload()
+	require.NoError(t, err)
+	assert.Empty(t, changes.Live)
+	assert.Equal(t, []string{"chunk_size"}, changes.Reindex)
+	assert.Equal(t, 512, r.current.ChunkSize)
+}
+
+func Test_configReloader_Reload_Invalid(t *testing.T) {
+	r, store, _ := newTestReloader(t)
+	r.level.Set(slog.LevelInfo)
+
+	require.NoError(t, os.WriteFile(r.path, []byte("results: 0\nlog_level: debug\n"), 0o644))
+	_, err := r.Reload()
+	assert.Error(t, err)
+	assert.Zero(t, store.n.Load())
+	assert.Equal(t, slog.LevelInfo, r.level.Level())
+	assert.Equal(t, 5, r.current.Results)
+}
+
+func Test_configReloader_Run(t *testing.T) {
+	r, store, _ := newTestReloader(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Run(ctx)
+
+	// give the watcher time to start
+	time.Sleep(100 * time.Millisecond)
+	updated := strings.Replace(reloadConfig, "results: 5", "results: 3", 1)
+	require.NoError(t, os.WriteFile(r.path, []byte(updated), 0o644))
+
+	assert.Eventually(t, func() bool { return store.n.Load() == 3 }, 5*time.Second, 50*time.Millisecond)
+}
@@ -5,16 +5,26 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"time"
 
 	"github.com/gamma-omg/rag-mcp/docstore"
+	"github.com/gamma-omg/rag-mcp/metrics"
+	"github.com/gamma-omg/rag-mcp/tracing"
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 )
 
 type docRetriever interface {
 	Retrieve(ctx context.Context, query string) ([]docstore.SearchResult, error)
 }
 
+type queueAdmin interface {
+	Jobs() (pending, dead []queueJob)
+	Retry(path string) (int, error)
+}
+
 func NewRagServer(retriever docRetriever, logger *slog.Logger) *server.MCPServer {
 	tool := mcp.NewTool("RAG tool",
 		mcp.WithDescription("This tool allows searching user documents and get results for RAG"),
@@ -24,30 +34,25 @@ func NewRagServer(retriever docRetriever, logger *slog.Logger) *server.MCPServer
 		))
 
 	srv := server.NewMCPServer("RAG", "0.0.1", server.WithToolCapabilities(false))
-	srv.AddTool(tool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	srv.AddTool(tool, instrument(tool.Name, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		q, err := request.RequireString("query")
 		if err != nil {
 			return mcp.NewToolResultError(err.Error()), nil
 		}
 
-		logger.Info("search tool invoked", "query", q)
+		logger.InfoContext(ctx, "search tool invoked", "client", clientName(ctx), "query", q)
 
 		res, err := retriever.Retrieve(ctx, q)
 		if err != nil {
 			return mcp.NewToolResultError(err.Error()), nil
 		}
 
+		_, span := tracing.Start(ctx, "format results")
+		defer span.End()
+
 		var response string
 		for _, r := range res {
-			raw, err := json.Marshal(struct {
-				Score float32 `json:"score"`
-				File  string  `json:"file"`
-				Text  string  `json:"text"`
-			}{
-				Score: r.Score,
-				File:  r.File,
-				Text:  r.Text,
-			})
+			raw, err := json.Marshal(newSearchHit(r))
 			if err != nil {
 				return mcp.NewToolResultError(err.Error()), nil
 			}
@@ -56,7 +61,89 @@ func NewRagServer(retriever docRetriever, logger *slog.Logger) *server.MCPServer
 		}
 
 		return mcp.NewToolResultText(response), nil
-	})
+	}))
 
 	return srv
 }
+
+// searchHit is the JSON form of a search result
+type searchHit struct {
+	Score    float32           `json:"score"`
+	File     string            `json:"file"`
+	Location string            `json:"location,omitempty"`
+	MimeType string            `json:"mime_type,omitempty"`
+	Meta     map[string]string `json:"meta,omitempty"`
+	Text     string            `json:"text"`
+}
+
+func newSearchHit(r docstore.SearchResult) searchHit {
+	return searchHit{
+		Score:    r.Score,
+		File:     r.File,
+		Location: r.Location,
+		MimeType: r.MimeType,
+		Meta:     r.Meta,
+		Text:     r.Text,
+	}
+}
+
+// instrument records the calls and latency of a tool handler
+func instrument(name string, handler server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		ctx, span := tracing.Start(ctx, "tool "+name, attribute.String("mcp.tool", name))
+		defer span.End()
+
+		start := time.Now()
+		res, err := handler(ctx, request)
+		metrics.ToolDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+
+		status := "ok"
+		if err != nil || res != nil && res.IsError {
+			status = "error"
+			span.SetStatus(codes.Error, "tool call failed")
+		}
+		metrics.ToolCalls.WithLabelValues(name, status).Inc()
+		return res, err
+	}
+}
+
+// addQueueTools exposes the ingestion queue, so that files failing to ingest can be
+// inspected and retried
+func addQueueTools(srv *server.MCPServer, queue queueAdmin, logger *slog.Logger) {
+	list := mcp.NewTool("Ingestion queue",
+		mcp.WithDescription("Lists the file changes waiting to be indexed and the ones that failed permanently"))
+
+	srv.AddTool(list, instrument(list.Name, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		pending, dead := queue.Jobs()
+		raw, err := json.Marshal(struct {
+			Pending []queueJob `json:"pending"`
+			Dead    []queueJob `json:"dead"`
+		}{
+			Pending: pending,
+			Dead:    dead,
+		})
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		return mcp.NewToolResultText(string(raw)), nil
+	}))
+
+	retry := mcp.NewTool("Retry ingestion",
+		mcp.WithDescription("Queues permanently failed file changes again"),
+		mcp.WithString("file",
+			mcp.Description("Path of the file to retry, all failed files are retried if omitted"),
+		))
+
+	srv.AddTool(retry, instrument(retry.Name, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		file := request.GetString("file", "")
+		logger.InfoContext(ctx, "retry ingestion tool invoked", "client", clientName(ctx), "file", file)
+
+		n, err := queue.Retry(file)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		return mcp.NewToolResultText(fmt.Sprintf("%d file(s) queued for retry", n)), nil
+	}))
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// newSampler keeps the given share of the traces, the ratio defaults to 1 when the
+// setting is left out, while an explicit 0 keeps none
+func newSampler(ratio float64) sdktrace.Sampler {
+	switch {
+	case ratio <= 0:
+		return sdktrace.NeverSample()
+	case ratio >= 1:
+		return sdktrace.AlwaysSample()
+	}
+
+	return sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))
+}
+
+// initTracing installs the tracer provider exporting the spans of the server, and
+// returns the function flushing and closing it. No exporter leaves tracing off.
+func initTracing(ctx context.Context, cfg TracingConfig) (func(context.Context) error, error) {
+	exporter, closeExporter, err := createSpanExporter(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if exporter == nil {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", cmp.Or(cfg.ServiceName, "rag-mcp")),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tracing resource: %w", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(newSampler(cfg.SampleRatio)),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	return func(ctx context.Context) error {
+		return errors.Join(tp.Shutdown(ctx), closeExporter())
+	}, nil
+}
+
+func createSpanExporter(ctx context.Context, cfg TracingConfig) (sdktrace.SpanExporter, func() error, error) {
+	noClose := func() error { return nil }
+
+	switch cfg.Exporter {
+	case "", "none":
+		return nil, noClose, nil
+	case "otlp":
+		exporter, err := createOTLPExporter(ctx, cfg)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+		}
+
+		return exporter, noClose, nil
+	case "file":
+		if cfg.File == "" {
+			return nil, nil, errors.New("tracing file exporter requires a file")
+		}
+
+		f, err := os.OpenFile(cfg.File, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0o644)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open trace file: %w", err)
+		}
+
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			f.Close()
+			return nil, nil, fmt.Errorf("failed to create file exporter: %w", err)
+		}
+
+		return exporter, f.Close, nil
+	}
+
+	return nil, nil, fmt.Errorf("unknown tracing exporter %q", cfg.Exporter)
+}
+
+func createOTLPExporter(ctx context.Context, cfg TracingConfig) (sdktrace.SpanExporter, error) {
+	switch cfg.Protocol {
+	case "", "grpc":
+		var opts []otlptracegrpc.Option
+		if cfg.Endpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+
+		return otlptracegrpc.New(ctx, opts...)
+	case "http":
+		var opts []otlptracehttp.Option
+		if cfg.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+
+		return otlptracehttp.New(ctx, opts...)
+	}
+
+	return nil, fmt.Errorf("unknown OTLP protocol %q", cfg.Protocol)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gamma-omg/rag-mcp/tracing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+)
+
+func Test_initTracing_File(t *testing.T) {
+	prev := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	file := filepath.Join(t.TempDir(), "traces.json")
+	shutdown, err := initTracing(context.Background(), TracingConfig{Exporter: "file", File: file, SampleRatio: 1})
+	require.NoError(t, err)
+
+	_, span := tracing.Start(context.Background(), "Retrieve")
+	span.End()
+	require.NoError(t, shutdown(context.Background()))
+
+	raw, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Contains(t, string(raw), `"Name":"Retrieve"`)
+	assert.Contains(t, string(raw), `"Value":"rag-mcp"`)
+}
+
+func Test_newSampler(t *testing.T) {
+	assert.Equal(t, "AlwaysOffSampler", newSampler(0).Description())
+	assert.Equal(t, "AlwaysOnSampler", newSampler(1).Description())
+	assert.Contains(t, newSampler(0.5).Description(), "TraceIDRatioBased{0.5}")
+}
+
+func Test_initTracing_Invalid(t *testing.T) {
+	_, err := initTracing(context.Background(), TracingConfig{Exporter: "zipkin"})
+	assert.Error(t, err)
+
+	_, err = initTracing(context.Background(), TracingConfig{Exporter: "file"})
+	assert.Error(t, err)
+
+	_, err = initTracing(context.Background(), TracingConfig{Exporter: "otlp", Protocol: "thrift"})
+	assert.Error(t, err)
+}
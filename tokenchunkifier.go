@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/gamma-omg/rag-mcp/docstore"
+	"github.com/gamma-omg/rag-mcp/readers"
+	"github.com/pkoukk/tiktoken-go"
+	tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
+)
+
+const defaultTokenizer = "cl100k_base"
+
+// modelMaxTokens are the input limits of known embedding models. Gemini models use
+// their own tokenizer, cl100k counts are close enough for typical text.
+var modelMaxTokens = map[string]int{
+	"text-embedding-3-large": 8191,
+	"text-embedding-3-small": 8191,
+	"text-embedding-ada-002": 8191,
+	"text-embedding-004":     2048,
+	"gemini-embedding-001":   2048,
+	"embedding-001":          2048,
+}
+
+var setOfflineLoader sync.Once
+
+type tokenizer interface {
+	EncodeOrdinary(text string) []int
+	Decode(tokens []int) string
+}
+
+// TokenChunkifier splits texts into chunks measured in tokens of a BPE vocabulary.
+// No chunk exceeds maxTokens, even where a chunk tokenizes differently on its own
+// than as a part of the whole text.
+type TokenChunkifier struct {
+	tokenizer    tokenizer
+	chunkSize    int
+	chunkOverlap int
+	maxTokens    int
+}
+
+// newTokenizer loads a BPE vocabulary bundled with the binary, so no download
+// happens at runtime
+func newTokenizer(encoding string) (tokenizer, error) {
+	setOfflineLoader.Do(func() {
+		tiktoken.SetBpeLoader(tiktoken_loader.NewOfflineLoader())
+	})
+
+	if encoding == "" {
+		encoding = defaultTokenizer
+	}
+
+	t, err := tiktoken.GetEncoding(encoding)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tokenizer %s: %w", encoding, err)
+	}
+
+	return t, nil
+}
+
+func (c *TokenChunkifier) Chunkify(text string) []string {
+	if len(text) == 0 {
+		return []string{}
+	}
+
+	size := c.chunkSize
+	if c.maxTokens > 0 {
+		size = min(size, c.maxTokens)
+	}
+
+	tokens := c.tokenizer.EncodeOrdinary(text)
+	offsets := c.tokenOffsets(tokens, text)
+	n := len(tokens)
+
+	// tokens may end in the middle of a multibyte character, chunk boundaries
+	// are moved forward to the start of the next character
+	slice := func(from, to int) string {
+		return text[runeStart(text, offsets[from]):runeStart(text, offsets[to])]
+	}
+
+	var res []string
+	pos := 0
+	for {
+		end := min(pos+size, n)
+		chunk := slice(pos, end)
+		for c.maxTokens > 0 && end > pos+1 && c.Count(chunk) > c.maxTokens {
+			end--
+			chunk = slice(pos, end)
+		}
+
+		if chunk != "" {
+			res = append(res, chunk)
+		}
+		if end >= n {
+			break
+		}
+
+		pos = max(end-c.chunkOverlap, pos+1)
+	}
+
+	return res
+}
+
+// ChunkifySections packs consecutive sections into chunks of up to chunkSize tokens
+// without splitting them. Sections larger than a chunk are split as plain text.
+func (c *TokenChunkifier) ChunkifySections(sections []readers.Section) []docstore.Chunk {
+	size := c.chunkSize
+	if c.maxTokens > 0 {
+		size = min(size, c.maxTokens)
+	}
+
+	return packSections(sections, size, c.Count, c.Chunkify)
+}
+
+// Count returns the number of tokens in text
+func (c *TokenChunkifier) Count(text string) int {
+	return len(c.tokenizer.EncodeOrdinary(text))
+}
+
+// tokenOffsets returns the byte offset of every token in text, followed by the
+// length of text
+func (c *TokenChunkifier) tokenOffsets(tokens []int, text string) []int {
+	offsets := make([]int, len(tokens)+1)
+	pos := 0
+	for i, t := range tokens {
+		offsets[i] = pos
+		pos += len(c.tokenizer.Decode([]int{t}))
+	}
+	offsets[len(tokens)] = min(pos, len(text))
+
+	return offsets
+}
+
+func runeStart(text string, pos int) int {
+	for pos < len(text) && !utf8.RuneStart(text[pos]) {
+		pos++
+	}
+
+	return pos
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/gamma-omg/rag-mcp/readers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestTokenChunkifier(t *testing.T, size, overlap, maxTokens int) *TokenChunkifier {
+	t.Helper()
+
+	tok, err := newTokenizer(defaultTokenizer)
+	require.NoError(t, err)
+
+	return &TokenChunkifier{
+		tokenizer:    tok,
+		chunkSize:    size,
+		chunkOverlap: overlap,
+		maxTokens:    maxTokens,
+	}
+}
+
+func Test_TokenChunkifier_Chunkify(t *testing.T) {
+	c := newTestTokenChunkifier(t, 4, 0, 0)
+
+	out := c.Chunkify("one two three four five six seven eight nine")
+	assert.Equal(t, []string{"one two three four", " five six seven eight", " nine"}, out)
+	assert.Equal(t, []string{}, c.Chunkify(""))
+}
+
+func Test_TokenChunkifier_Chunkify_Overlap(t *testing.T) {
+	c := newTestTokenChunkifier(t, 4, 2, 0)
+
+	out := c.Chunkify("one two three four five six")
+	assert.Equal(t, []string{"one two three four", " three four five six"}, out)
+}
+
+func Test_TokenChunkifier_Chunkify_Multibyte(t *testing.T) {
+	text := strings.Repeat("日本語のテキストを分割する。", 20)
+	c := newTestTokenChunkifier(t, 7, 0, 0)
+
+	out := c.Chunkify(text)
+	require.Greater(t, len(out), 1)
+	for _, chunk := range out {
+		assert.True(t, utf8.ValidString(chunk), chunk)
+	}
+	assert.Equal(t, text, strings.Join(out, ""))
+}
+
+func Test_TokenChunkifier_MaxTokens(t *testing.T) {
+	text := strings.Repeat("grüße, 你好 and emoji 🎉 ", 200)
+	c := newTestTokenChunkifier(t, 1000, 0, 50)
+
+	out := c.Chunkify(text)
+	for _, chunk := range out {
+		assert.LessOrEqual(t, c.Count(chunk), 50)
+	}
+	assert.Equal(t, text, strings.Join(out, ""))
+}
+
+func Test_TokenChunkifier_ChunkifySections(t *testing.T) {
+	c := newTestTokenChunkifier(t, 6, 0, 0)
+
+	out := c.ChunkifySections([]readers.Section{
+		{Location: "cell 1", Text: "one two"},
+		{Location: "cell 2", Text: "three"},
+		{Location: "cell 3", Text: "four five six seven eight nine ten"},
+	})
+
+	require.Len(t, out, 3)
+	assert.Equal(t, "one two\n\nthree", out[0].Text)
+	assert.Equal(t, "cell 1 - cell 2", out[0].Location)
+	assert.Equal(t, "cell 3", out[1].Location)
+	assert.Equal(t, "cell 3", out[2].Location)
+}
@@ -0,0 +1,62 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func useRecorder(t *testing.T) *tracetest.SpanRecorder {
+	rec := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+	return rec
+}
+
+func Test_LogHandler(t *testing.T) {
+	useRecorder(t)
+
+	var buf bytes.Buffer
+	logger := slog.New(LogHandler(slog.NewJSONHandler(&buf, nil))).With("component", "test")
+
+	ctx, span := Start(context.Background(), "op")
+	logger.InfoContext(ctx, "traced")
+	span.End()
+
+	var rec map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &rec))
+	assert.Equal(t, span.SpanContext().TraceID().String(), rec["trace_id"])
+	assert.Equal(t, span.SpanContext().SpanID().String(), rec["span_id"])
+	assert.Equal(t, "test", rec["component"])
+
+	buf.Reset()
+	logger.Info("untraced")
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &rec))
+	assert.NotContains(t, buf.String(), "trace_id")
+}
+
+func Test_End(t *testing.T) {
+	rec := useRecorder(t)
+
+	_, ok := Start(context.Background(), "ok")
+	End(ok, nil)
+	_, failed := Start(context.Background(), "failed")
+	End(failed, errors.New("boom"))
+
+	spans := rec.Ended()
+	require.Len(t, spans, 2)
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+	assert.Equal(t, "boom", spans[1].Status().Description)
+}